@@ -8,11 +8,14 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/muktihari/xmltokenizer"
 	"github.com/muktihari/xmltokenizer/internal/gpx"
+	"github.com/muktihari/xmltokenizer/internal/tcx"
 	"github.com/muktihari/xmltokenizer/internal/xlsx"
 )
 
@@ -109,6 +112,27 @@ func BenchmarkUnmarshalGPX(b *testing.B) {
 	})
 }
 
+func BenchmarkUnmarshalTCX(b *testing.B) {
+	path := filepath.Join("testdata", "ride_bedugul_laps.tcx")
+	name := strings.TrimPrefix(path, "testdata/")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+
+	b.Run(fmt.Sprintf("stdlib.xml:%q", name), func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = tcx.UnmarshalWithStdlibXML(bytes.NewReader(data))
+		}
+	})
+	b.Run(fmt.Sprintf("xmltokenizer:%q", name), func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = tcx.UnmarshalWithXMLTokenizer(bytes.NewReader(data))
+		}
+	})
+}
+
 func BenchmarkUnmarshalXLSX(b *testing.B) {
 	path := filepath.Join("testdata", "xlsx_sheet1.xml")
 	name := strings.TrimPrefix(path, "testdata/")
@@ -129,3 +153,432 @@ func BenchmarkUnmarshalXLSX(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkLazyAttrs(b *testing.B) {
+	path := filepath.Join("testdata", "xlsx_sheet1.xml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, lazy := range []bool{false, true} {
+		b.Run(fmt.Sprintf("lazy=%t", lazy), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tok := xmltokenizer.New(bytes.NewReader(data), xmltokenizer.WithLazyAttrs(lazy))
+				for {
+					token, err := tok.Token()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+					if string(token.Name.Local) == "c" {
+						_ = token.AttrValue("r")
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNamesOnly(b *testing.B) {
+	path := filepath.Join("testdata", "xlsx_sheet1.xml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, namesOnly := range []bool{false, true} {
+		b.Run(fmt.Sprintf("namesOnly=%t", namesOnly), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tok := xmltokenizer.New(bytes.NewReader(data), xmltokenizer.WithNamesOnly(namesOnly))
+				var n int
+				for {
+					token, err := tok.Token()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+					if !token.IsEndElement && len(token.Name.Full) > 0 {
+						n++
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNoCDATA(b *testing.B) {
+	path := filepath.Join("testdata", "ride_sembalun.gpx") // CDATA-free.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, noCDATA := range []bool{false, true} {
+		b.Run(fmt.Sprintf("noCDATA=%t", noCDATA), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tok := xmltokenizer.New(bytes.NewReader(data), xmltokenizer.WithNoCDATA(noCDATA))
+				for {
+					_, err := tok.Token()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNameMatcher(b *testing.B) {
+	path := filepath.Join("testdata", "xlsx_sheet1.xml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+
+	names := []string{"worksheet", "sheetData", "row", "c", "v", "f", "is", "t"}
+
+	b.Run("switch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var n int
+			tok := xmltokenizer.New(bytes.NewReader(data))
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+				switch string(token.Name.Local) {
+				case "worksheet", "sheetData", "row", "c", "v", "f", "is", "t":
+					n++
+				}
+			}
+			_ = n
+		}
+	})
+	b.Run("NameMatcher", func(b *testing.B) {
+		m := xmltokenizer.NewNameMatcher(names...)
+		for i := 0; i < b.N; i++ {
+			var n int
+			tok := xmltokenizer.New(bytes.NewReader(data))
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+				if m.Match(token.Name.Local) >= 0 {
+					n++
+				}
+			}
+			_ = n
+		}
+	})
+}
+
+func BenchmarkAttrIndex(b *testing.B) {
+	const n = 500
+	var sb strings.Builder
+	sb.WriteString("<snp")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, ` a%d="%d"`, i, i)
+	}
+	sb.WriteString("/>")
+	data := []byte(sb.String())
+
+	locals := make([]string, n)
+	for i := range locals {
+		locals[i] = fmt.Sprintf("a%d", i)
+	}
+
+	for _, index := range []bool{false, true} {
+		b.Run(fmt.Sprintf("index=%t", index), func(b *testing.B) {
+			b.ReportAllocs()
+			r := bytes.NewReader(data)
+			tok := xmltokenizer.New(r, xmltokenizer.WithAttrIndex(index))
+			for i := 0; i < b.N; i++ {
+				r.Reset(data)
+				tok.Reset(r, xmltokenizer.WithAttrIndex(index))
+				token, err := tok.Token()
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, local := range locals {
+					_, _ = token.Attr(local)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkStringInterner(b *testing.B) {
+	path := filepath.Join("testdata", "xlsx_sheet1.xml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, interner := range []bool{false, true} {
+		b.Run(fmt.Sprintf("interner=%t", interner), func(b *testing.B) {
+			b.ReportAllocs()
+			r := bytes.NewReader(data)
+			tok := xmltokenizer.New(r, xmltokenizer.WithStringInterner(interner))
+			for i := 0; i < b.N; i++ {
+				r.Reset(data)
+				tok.Reset(r, xmltokenizer.WithStringInterner(interner))
+				for {
+					token, err := tok.Token()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+					for _, local := range [...]string{"s", "t", "ht", "hidden", "customFormat"} {
+						_ = token.AttrValueString(local)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReaderBufferReuse(b *testing.B) {
+	path := filepath.Join("testdata", "hike_mt_prau.gpx")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, reuse := range []bool{false, true} {
+		b.Run(fmt.Sprintf("reuse=%t", reuse), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			r := bytes.NewReader(data)
+			tok := xmltokenizer.New(r)
+			for i := 0; i < b.N; i++ {
+				r.Reset(data)
+				tok.Reset(r, xmltokenizer.WithReaderBufferReuse(reuse))
+				for {
+					_, err := tok.Token()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+var localSink string
+
+func BenchmarkLocalNameDispatch(b *testing.B) {
+	path := filepath.Join("testdata", "xlsx_sheet1.xml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+
+	b.Run("switch string(Name.Local)", func(b *testing.B) {
+		b.ReportAllocs()
+		r := bytes.NewReader(data)
+		tok := xmltokenizer.New(r)
+		for i := 0; i < b.N; i++ {
+			r.Reset(data)
+			tok.Reset(r)
+			var n int
+			for {
+				token, err := tok.Token()
+				if err != nil {
+					break
+				}
+				switch string(token.Name.Local) { // The compiler does not allocate the string.
+				case "row", "c", "v":
+					n++
+				}
+			}
+			_ = n
+		}
+	})
+	b.Run("LocalString", func(b *testing.B) {
+		b.ReportAllocs()
+		r := bytes.NewReader(data)
+		tok := xmltokenizer.New(r)
+		for i := 0; i < b.N; i++ {
+			r.Reset(data)
+			tok.Reset(r)
+			var n int
+			for {
+				token, err := tok.Token()
+				if err != nil {
+					break
+				}
+				switch token.LocalString() {
+				case "row", "c", "v":
+					n++
+				}
+			}
+			_ = n
+		}
+	})
+	b.Run("LocalStringCopy", func(b *testing.B) {
+		b.ReportAllocs()
+		r := bytes.NewReader(data)
+		tok := xmltokenizer.New(r)
+		for i := 0; i < b.N; i++ {
+			r.Reset(data)
+			tok.Reset(r)
+			var n int
+			for {
+				token, err := tok.Token()
+				if err != nil {
+					break
+				}
+				switch token.Name.LocalStringCopy() {
+				case "row", "c", "v":
+					n++
+				}
+			}
+			_ = n
+		}
+	})
+	b.Run("string copy", func(b *testing.B) {
+		b.ReportAllocs()
+		r := bytes.NewReader(data)
+		tok := xmltokenizer.New(r)
+		for i := 0; i < b.N; i++ {
+			r.Reset(data)
+			tok.Reset(r)
+			var n int
+			for {
+				token, err := tok.Token()
+				if err != nil {
+					break
+				}
+				localSink = string(token.Name.Local) // Escapes, so it allocates.
+				switch localSink {
+				case "row", "c", "v":
+					n++
+				}
+			}
+			_ = n
+		}
+	})
+}
+
+func BenchmarkNameEquals(b *testing.B) {
+	path := filepath.Join("testdata", "ride_sembalun.gpx")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+
+	b.Run("switch string(Name.Local)", func(b *testing.B) {
+		b.ReportAllocs()
+		r := bytes.NewReader(data)
+		tok := xmltokenizer.New(r)
+		for i := 0; i < b.N; i++ {
+			r.Reset(data)
+			tok.Reset(r)
+			var n int
+			for {
+				token, err := tok.Token()
+				if err != nil {
+					break
+				}
+				switch string(token.Name.Local) {
+				case "trkpt":
+					n++
+				}
+			}
+			_ = n
+		}
+	})
+	b.Run("LocalEquals", func(b *testing.B) {
+		b.ReportAllocs()
+		r := bytes.NewReader(data)
+		tok := xmltokenizer.New(r)
+		for i := 0; i < b.N; i++ {
+			r.Reset(data)
+			tok.Reset(r)
+			var n int
+			for {
+				token, err := tok.Token()
+				if err != nil {
+					break
+				}
+				if token.Name.LocalEquals("trkpt") {
+					n++
+				}
+			}
+			_ = n
+		}
+	})
+}
+
+// slowReader simulates a slow reader, e.g. a network stream, every Read takes at least delay.
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.r.Read(p)
+}
+
+func BenchmarkReadAhead(b *testing.B) {
+	path := filepath.Join("testdata", "hike_mt_prau.gpx")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+
+	// Every token is processed for a while, so the reads can be overlapped with the processing.
+	// The tail latency of the Token invocations is reported along with the throughput.
+	const delay, work = 100 * time.Microsecond, 2 * time.Microsecond
+	for _, readAhead := range []bool{false, true} {
+		b.Run(fmt.Sprintf("readAhead=%t", readAhead), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			var latencies []time.Duration
+			tok := xmltokenizer.New(nil)
+			for i := 0; i < b.N; i++ {
+				tok.Reset(&slowReader{r: bytes.NewReader(data), delay: delay}, xmltokenizer.WithReadAhead(readAhead))
+				for {
+					start := time.Now()
+					_, err := tok.Token()
+					latencies = append(latencies, time.Since(start))
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+					for start = time.Now(); time.Since(start) < work; {
+					}
+				}
+			}
+			b.StopTimer()
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(latencies[len(latencies)*99/100]), "p99-ns/token")
+			b.ReportMetric(float64(latencies[len(latencies)*999/1000]), "p99.9-ns/token")
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package xmltokenizer
+
+import "encoding/xml"
+
+// ToStartElement converts t into encoding/xml's StartElement. Namespace is not
+// resolved: Name.Space holds the prefix, just like xml.Decoder's RawToken does.
+// Entities in the attribute values are not decoded. When WithSeparateNamespaceDecls
+// is enabled, the namespace declarations are placed after the other attributes, so
+// their order may differ from the source and from xml.Decoder's.
+func (t Token) ToStartElement() xml.StartElement {
+	se := xml.StartElement{Name: t.Name.toXML()}
+	if attrsRaw := t.lazyAttrs(); attrsRaw != nil {
+		s := attrScanner{b: attrsRaw}
+		for attr, ok := s.next(); ok; attr, ok = s.next() {
+			se.Attr = append(se.Attr, attr.toXML())
+		}
+		return se
+	}
+	nsDecls := t.NamespaceDecls()
+	if n := len(t.Attrs) + len(nsDecls); n > 0 {
+		se.Attr = make([]xml.Attr, 0, n)
+	}
+	for i := range t.Attrs {
+		se.Attr = append(se.Attr, t.Attrs[i].toXML())
+	}
+	for i := range nsDecls {
+		se.Attr = append(se.Attr, nsDecls[i].toXML())
+	}
+	return se
+}
+
+// ToEndElement converts t into encoding/xml's EndElement, t may either be an
+// end element or a self-closing element. Name.Space holds the prefix.
+func (t Token) ToEndElement() xml.EndElement {
+	return xml.EndElement{Name: t.Name.toXML()}
+}
+
+// ToCharData converts t's Data into encoding/xml's CharData. Unlike Data,
+// the returned CharData is a copy, so it remains valid after next Token
+// invocation. Entities are not decoded.
+func (t Token) ToCharData() xml.CharData {
+	if len(t.Data) == 0 {
+		return nil
+	}
+	return xml.CharData(append([]byte(nil), t.Data...))
+}
+
+func (n *Name) toXML() xml.Name {
+	return xml.Name{Space: string(n.Prefix), Local: string(n.Local)}
+}
+
+func (a *Attr) toXML() xml.Attr {
+	return xml.Attr{Name: a.Name.toXML(), Value: string(a.Value)}
+}
@@ -0,0 +1,117 @@
+package xmltokenizer_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/muktihari/xmltokenizer"
+)
+
+func TestConvertToStdlibTypes(t *testing.T) {
+	filenames := []string{
+		"hike_mt_prau.gpx",
+		"xlsx_sheet1.xml",
+		"self_closing.xml",
+		"cdata.xml",
+	}
+
+	for _, filename := range filenames {
+		t.Run(filename, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var expecteds []xml.Token
+			dec := xml.NewDecoder(bytes.NewReader(data))
+			for {
+				token, err := dec.RawToken()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				switch elem := token.(type) {
+				case xml.StartElement:
+					if elem = elem.Copy(); len(elem.Attr) == 0 {
+						elem.Attr = nil
+					}
+					expecteds = append(expecteds, elem)
+				case xml.EndElement:
+					expecteds = append(expecteds, elem)
+				case xml.CharData:
+					if elem = bytes.TrimSpace(elem); len(elem) > 0 {
+						expecteds = append(expecteds, xml.CopyToken(elem))
+					}
+				}
+			}
+
+			var results []xml.Token
+			tok := xmltokenizer.New(bytes.NewReader(data))
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(token.Name.Full) == 0 { // ProcInst, Directive or Comment
+					continue
+				}
+				if token.IsEndElement {
+					results = append(results, token.ToEndElement())
+					continue
+				}
+				results = append(results, token.ToStartElement())
+				if cd := token.ToCharData(); cd != nil {
+					results = append(results, cd)
+				}
+				if token.SelfClosing {
+					results = append(results, token.ToEndElement())
+				}
+			}
+
+			if len(results) != len(expecteds) {
+				t.Fatalf("expected len: %d, got: %d", len(expecteds), len(results))
+			}
+			for i := range expecteds {
+				if reflect.DeepEqual(results[i], expecteds[i]) {
+					continue
+				}
+				t.Fatalf("%d: %s", i, cmp.Diff(results[i], expecteds[i]))
+			}
+		})
+	}
+}
+
+func TestConvertWithSeparateNamespaceDecls(t *testing.T) {
+	const data = `<a xmlns:x="ns1" b="2" xmlns="ns2" x:c="3"/>`
+
+	tok := xmltokenizer.New(strings.NewReader(data), xmltokenizer.WithSeparateNamespaceDecls(true))
+	token, err := tok.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := xml.StartElement{
+		Name: xml.Name{Local: "a"},
+		Attr: []xml.Attr{ // Namespace declarations come after the other attributes.
+			{Name: xml.Name{Local: "b"}, Value: "2"},
+			{Name: xml.Name{Space: "x", Local: "c"}, Value: "3"},
+			{Name: xml.Name{Space: "xmlns", Local: "x"}, Value: "ns1"},
+			{Name: xml.Name{Local: "xmlns"}, Value: "ns2"},
+		},
+	}
+	if diff := cmp.Diff(token.ToStartElement(), expected); diff != "" {
+		t.Fatal(diff)
+	}
+}
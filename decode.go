@@ -0,0 +1,286 @@
+package xmltokenizer
+
+import (
+	"encoding"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidDecodeTarget is returned by DecodeInto when v is not a non-nil pointer to
+// a struct, or a field's type is not supported.
+const ErrInvalidDecodeTarget = errorString("invalid decode target")
+
+// TokenUnmarshaler is implemented by a type that unmarshals itself from the tokens, it is
+// invoked by DecodeInto right after Token returns the start element se of the type's element.
+type TokenUnmarshaler interface {
+	UnmarshalToken(tok *Tokenizer, se *Token) error
+}
+
+// DecodeInto decodes the start element se and all of its children into v, a pointer to a struct,
+// using reflection on the `xml:"..."` struct tags, so no UnmarshalToken needs to be written by hand.
+// It is convenient for prototyping but much slower than a hand-written UnmarshalToken. It advances
+// the Tokenizer past the se's end element, so it must be invoked right after Token returns se.
+//
+// Only the common subset of encoding/xml's struct tags is supported:
+//   - `xml:"name,attr"` is decoded from the se's attribute whose Name.Local is name.
+//   - `xml:",chardata"` is decoded from the se's Data.
+//   - `xml:"name"` is decoded from the child element whose Name.Local is name, a slice field
+//     is appended with every such child, and a struct field is decoded recursively.
+//   - `xml:"a>b>c"` is decoded from the element c nested in the child a and the grandchild b.
+//   - `xml:"-"` and the unexported fields are ignored, a field without a tag is named after the field.
+//
+// The "omitempty" option is ignored, and the fields of xml.Name type, the embedded structs and
+// the other options, e.g. "innerxml", are not decoded. A field is decoded from the element's Data
+// as a string, a []byte, a bool, an integer or a floating-point number, unless it implements
+// encoding.TextUnmarshaler, e.g. time.Time. A field that implements TokenUnmarshaler decodes itself,
+// v itself is always decoded using reflection, so DecodeInto can be used to implement UnmarshalToken.
+// The entities are decoded only when the Tokenizer is created using WithEntityDecoding(true).
+func (t *Tokenizer) DecodeInto(v any, se *Token) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%T: %w", v, ErrInvalidDecodeTarget)
+	}
+	if se.IsEndElement {
+		return nil
+	}
+	return t.decodeStruct(rv.Elem(), se)
+}
+
+// decodeField is a struct field that DecodeInto decodes.
+type decodeField struct {
+	name     string   // the field's name, for the error message
+	index    int      // the field's index in the struct
+	path     []string // the element's path, e.g. extensions>TrackPointExtension, or the attribute's name
+	attr     bool     // true when the field is decoded from an attribute
+	charData bool     // true when the field is decoded from the Data
+}
+
+var decodeFieldsCache sync.Map // map[reflect.Type][]decodeField
+
+// decodeFieldsOf returns the fields of the struct type typ that DecodeInto decodes.
+func decodeFieldsOf(typ reflect.Type) []decodeField {
+	if fields, ok := decodeFieldsCache.Load(typ); ok {
+		return fields.([]decodeField)
+	}
+	var fields []decodeField
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() || sf.Anonymous || sf.Type == reflect.TypeOf(xml.Name{}) {
+			continue
+		}
+		tag := sf.Tag.Get("xml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		field := decodeField{name: sf.Name, index: i}
+		var unsupported bool // e.g. innerxml, comment or any.
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "attr":
+				field.attr = true
+			case "chardata":
+				field.charData = true
+			case "", "omitempty":
+			default:
+				unsupported = true
+			}
+		}
+		if unsupported {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		field.path = strings.Split(name, ">")
+		fields = append(fields, field)
+	}
+	fields = fields[:len(fields):len(fields)]
+	decodeFieldsCache.Store(typ, fields)
+	return fields
+}
+
+// decodeStruct decodes the start element se into rv, a struct.
+func (t *Tokenizer) decodeStruct(rv reflect.Value, se *Token) error {
+	fields := decodeFieldsOf(rv.Type())
+	for i := range fields { // Before reading the children, se's bytes are overwritten then.
+		field := &fields[i]
+		switch {
+		case field.charData:
+			if se.SelfClosing {
+				continue
+			}
+			if err := setValue(rv.Field(field.index), se.Data); err != nil {
+				return fmt.Errorf("%s: %w", field.name, err)
+			}
+		case field.attr:
+			attr, ok := se.Attr(field.path[0])
+			if !ok {
+				continue
+			}
+			if err := setValue(rv.Field(field.index), attr.Value); err != nil {
+				return fmt.Errorf("%s: %w", field.name, err)
+			}
+		}
+	}
+	return t.decodeFields(rv, fields, 0, se)
+}
+
+// decodeFields decodes the children of se into the fields of rv, a struct, whose path
+// at the given level is the child's name. The other children are skipped.
+func (t *Tokenizer) decodeFields(rv reflect.Value, fields []decodeField, level int, se *Token) error {
+	if se.SelfClosing {
+		return nil
+	}
+	depth := t.depth
+	for {
+		token, err := t.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if t.depth < depth { // se's end element, since the children are decoded entirely.
+			return nil
+		}
+		if token.IsEndElement || len(token.Name.Full) == 0 {
+			continue
+		}
+
+		local := string(token.Name.Local)
+		var field *decodeField
+		var nested []decodeField // the fields whose path continues under this child
+		for i := range fields {
+			f := &fields[i]
+			if f.attr || f.charData || len(f.path) <= level || f.path[level] != local {
+				continue
+			}
+			if len(f.path) == level+1 {
+				field = f
+				break
+			}
+			nested = append(nested, *f)
+		}
+
+		switch {
+		case field != nil:
+			if err = t.decodeElement(rv.Field(field.index), &token); err != nil {
+				return fmt.Errorf("%s: %w", field.name, err)
+			}
+		case len(nested) > 0:
+			if err = t.decodeFields(rv, nested, level+1, &token); err != nil {
+				return err
+			}
+		default:
+			if err = t.Skip(&token); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+var (
+	tokenUnmarshalerType = reflect.TypeOf((*TokenUnmarshaler)(nil)).Elem()
+	textUnmarshalerType  = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// decodeElement decodes the start element se into fv, the field of the se's name.
+func (t *Tokenizer) decodeElement(fv reflect.Value, se *Token) error {
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		elem := reflect.New(fv.Type().Elem()).Elem()
+		if err := t.decodeElement(elem, se); err != nil {
+			return err
+		}
+		fv.Set(reflect.Append(fv, elem))
+		return nil
+	}
+	if fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+
+	switch {
+	case reflect.PointerTo(fv.Type()).Implements(tokenUnmarshalerType):
+		se := GetToken().Copy(*se) // So the IsEndElementOf(se) works after the buffer is overwritten.
+		err := fv.Addr().Interface().(TokenUnmarshaler).UnmarshalToken(t, se)
+		PutToken(se)
+		return err
+	case fv.Kind() == reflect.Struct && !reflect.PointerTo(fv.Type()).Implements(textUnmarshalerType):
+		return t.decodeStruct(fv, se)
+	}
+
+	var data []byte
+	if !se.SelfClosing {
+		data = se.Data
+	}
+	if err := setValue(fv, data); err != nil {
+		return err
+	}
+	return t.Skip(se)
+}
+
+// setValue sets b, the Data or the attribute's value, into fv.
+func setValue(fv reflect.Value, b []byte) error {
+	if fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+	if fv.CanAddr() && reflect.PointerTo(fv.Type()).Implements(textUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(b)
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(string(b))
+		return nil
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			fv.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+	}
+
+	if len(b) == 0 { // e.g. <ele/>, the zero value is kept.
+		return nil
+	}
+	s := string(b)
+	switch fv.Kind() {
+	case reflect.Bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(v)
+	default:
+		return fmt.Errorf("%s: %w", fv.Type(), ErrInvalidDecodeTarget)
+	}
+	return nil
+}
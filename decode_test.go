@@ -0,0 +1,155 @@
+package xmltokenizer_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/muktihari/xmltokenizer"
+	"github.com/muktihari/xmltokenizer/internal/gpx/schema"
+)
+
+func TestDecodeIntoGPXWaypoint(t *testing.T) {
+	waypoints := func(decode func(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token, w *schema.Waypoint) error) []schema.Waypoint {
+		f, err := os.Open(filepath.Join("testdata", "ride_dps_bedugul.gpx"))
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+
+		var ws []schema.Waypoint
+		tok := xmltokenizer.New(f)
+		for {
+			token, err := tok.Token()
+			if err == io.EOF {
+				return ws
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(token.Name.Local) != "trkpt" {
+				continue
+			}
+			var w schema.Waypoint
+			if err = decode(tok, &token, &w); err != nil {
+				t.Fatal(err)
+			}
+			ws = append(ws, w)
+		}
+	}
+
+	expected := waypoints(func(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token, w *schema.Waypoint) error {
+		se = xmltokenizer.GetToken().Copy(*se)
+		defer xmltokenizer.PutToken(se)
+		return w.UnmarshalToken(tok, se)
+	})
+	result := waypoints(func(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token, w *schema.Waypoint) error {
+		return tok.DecodeInto(w, se)
+	})
+
+	if len(expected) == 0 {
+		t.Fatalf("expected trkpts")
+	}
+	if diff := cmp.Diff(result, expected, cmpopts.EquateNaNs()); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	type Link struct {
+		Href string `xml:"href,attr"`
+		Text string `xml:",chardata"`
+	}
+	type Doc struct {
+		ID      int       `xml:"id,attr"`
+		Missing string    `xml:"missing,attr"`
+		Title   string    `xml:"title"`
+		Draft   bool      `xml:"draft"`
+		Score   float32   `xml:"meta>score"`
+		Created time.Time `xml:"meta>dates>created"`
+		Tags    []string  `xml:"tags>tag"`
+		Links   []Link    `xml:"link"`
+		Author  *Link     `xml:"author"`
+		Raw     []byte    `xml:"raw"`
+		Count   uint8
+		Ignored string `xml:"-"`
+		private string
+	}
+
+	const xml = `<doc id="7" xmlns:x="ns">
+	<title>Hello</title>
+	<draft>true</draft>
+	<unknown><title>not mine</title></unknown>
+	<meta><score>4.5</score><dates><created>2023-10-22T02:55:22Z</created></dates></meta>
+	<tags><tag>a</tag><other/><tag>b</tag></tags>
+	<link href="/1">one</link><link href="/2"/>
+	<x:author href="/me">me</x:author>
+	<raw>bytes</raw>
+	<Count>3</Count>
+	<Ignored>x</Ignored>
+</doc><next/>`
+
+	tok := xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithReadBufferSize(1))
+	token, err := tok.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc Doc
+	if err = tok.DecodeInto(&doc, &token); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Doc{
+		ID:      7,
+		Title:   "Hello",
+		Draft:   true,
+		Score:   4.5,
+		Created: time.Date(2023, 10, 22, 2, 55, 22, 0, time.UTC),
+		Tags:    []string{"a", "b"},
+		Links:   []Link{{Href: "/1", Text: "one"}, {Href: "/2"}},
+		Author:  &Link{Href: "/me", Text: "me"},
+		Raw:     []byte("bytes"),
+		Count:   3,
+	}
+	if diff := cmp.Diff(doc, expected, cmpopts.IgnoreUnexported(Doc{})); diff != "" {
+		t.Fatal(diff)
+	}
+	if token, err = tok.Token(); err != nil || string(token.Name.Local) != "next" {
+		t.Fatalf("expected <next/>, got: %q, %v", token.Name.Full, err)
+	}
+
+	t.Run("invalid target", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<a>1</a>"))
+		token, _ := tok.Token()
+		var n int
+		for _, v := range []any{nil, doc, &n, (*Doc)(nil)} {
+			if err := tok.DecodeInto(v, &token); !errors.Is(err, xmltokenizer.ErrInvalidDecodeTarget) {
+				t.Fatalf("%T: expected: %v, got: %v", v, xmltokenizer.ErrInvalidDecodeTarget, err)
+			}
+		}
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<doc><Count>300</Count></doc>"))
+		token, _ := tok.Token()
+		var doc Doc
+		if err := tok.DecodeInto(&doc, &token); err == nil || !strings.HasPrefix(err.Error(), "Count: ") {
+			t.Fatalf("expected Count's error, got: %v", err)
+		}
+	})
+
+	t.Run("unexpected EOF", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<doc><title>"))
+		token, _ := tok.Token()
+		var doc Doc
+		if err := tok.DecodeInto(&doc, &token); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected: %v, got: %v", io.ErrUnexpectedEOF, err)
+		}
+	})
+}
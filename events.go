@@ -0,0 +1,320 @@
+package xmltokenizer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// ErrInvalidEvents is returned by Replayer when the input is not an event stream
+// produced by EncodeEvents or it is produced by an incompatible version.
+const ErrInvalidEvents = errorString("invalid event stream")
+
+// eventsMagic is the header of the event stream, its last byte is the format version.
+const eventsMagic = "xte\x03"
+
+// The event's flags.
+const (
+	eventSelfClosing = 1 << iota
+	eventIsEndElement
+	eventIsCDATA
+)
+
+// EncodeEvents reads the tokens until the end of the input and writes them into w as
+// a compact binary event stream, so the same tokens can be replayed later using
+// Replayer without parsing the XML again. The events are buffered, so w receives large
+// writes, and flushed when the end of the input is reached. The format is the eventsMagic
+// header, followed by the events, each one is prefixed by its length in uvarint:
+//
+//	flags    byte                      // eventSelfClosing | eventIsEndElement | eventIsCDATA
+//	name     name                      // Token's Name
+//	attrs    uvarint, [name, bytes]... // Token's Attrs
+//	nsdecls  uvarint, [name, bytes]... // Token's NamespaceDecls
+//	data     bytes                     // Token's Data
+//	rawdata  bytes                     // Token's RawData
+//	raw      bytes                     // Token's Raw
+//	entities uvarint, [bytes]...       // Token's Entities
+//
+// where bytes is a uvarint length followed by the bytes, and name is the Full as bytes
+// followed by the lengths of the Prefix and the Local in uvarint. The Attrs parsed on
+// demand by WithLazyAttrs are not encoded.
+func (t *Tokenizer) EncodeEvents(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(eventsMagic); err != nil {
+		return err
+	}
+
+	var buf []byte
+	for {
+		token, err := t.Token()
+		if err == io.EOF {
+			return bw.Flush()
+		}
+		if err != nil {
+			return err
+		}
+
+		buf = appendEvent(buf[:0], &token)
+		if _, err = bw.Write(buf); err != nil {
+			return err
+		}
+	}
+}
+
+// appendEvent appends the length-prefixed event of token into dst.
+func appendEvent(dst []byte, token *Token) []byte {
+	var size [binary.MaxVarintLen64]byte
+	begin := len(dst)
+	dst = append(dst, size[:]...) // Reserve the length prefix, the event is moved once the size is known.
+	start := len(dst)
+
+	var flags byte
+	if token.SelfClosing {
+		flags |= eventSelfClosing
+	}
+	if token.IsEndElement {
+		flags |= eventIsEndElement
+	}
+	if token.IsCDATA {
+		flags |= eventIsCDATA
+	}
+	dst = append(dst, flags)
+	dst = appendEventName(dst, token.Name)
+	dst = appendEventAttrs(dst, token.Attrs)
+	dst = appendEventAttrs(dst, token.NamespaceDecls())
+	dst = appendEventBytes(dst, token.Data)
+	dst = appendEventBytes(dst, token.RawData())
+	dst = appendEventBytes(dst, token.Raw())
+	entities := token.Entities()
+	dst = binary.AppendUvarint(dst, uint64(len(entities)))
+	for i := range entities {
+		dst = appendEventBytes(dst, entities[i])
+	}
+
+	n := binary.PutUvarint(size[:], uint64(len(dst)-start))
+	pos := start - n
+	copy(dst[pos:], size[:n])
+	return dst[:begin+copy(dst[begin:], dst[pos:])]
+}
+
+func appendEventAttrs(dst []byte, attrs []Attr) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(attrs)))
+	for i := range attrs {
+		dst = appendEventName(dst, attrs[i].Name)
+		dst = appendEventBytes(dst, attrs[i].Value)
+	}
+	return dst
+}
+
+func appendEventName(dst []byte, name Name) []byte {
+	dst = appendEventBytes(dst, name.Full)
+	dst = binary.AppendUvarint(dst, uint64(len(name.Prefix)))
+	return binary.AppendUvarint(dst, uint64(len(name.Local)))
+}
+
+func appendEventBytes(dst, b []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(b)))
+	return append(dst, b...)
+}
+
+// Replayer replays the tokens of an event stream produced by EncodeEvents.
+type Replayer struct {
+	r     io.Reader
+	br    io.ByteReader
+	err   error
+	start bool   // true once the header is validated
+	buf   []byte // the current event, the returned token is aliasing it
+	token Token
+}
+
+// NewEventReplayer creates new Replayer that reads the event stream from r.
+// The r is buffered unless it implements io.ByteReader.
+func NewEventReplayer(r io.Reader) *Replayer {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		b := bufio.NewReader(r)
+		r, br = b, b
+	}
+	return &Replayer{r: r, br: br}
+}
+
+// Token returns the next token, the same as the Tokenizer's Token returned while
+// encoding the event stream. Like the Tokenizer, the token is only valid before the
+// next Token invocation. It returns io.EOF at the end of the event stream.
+func (p *Replayer) Token() (token Token, err error) {
+	if p.err != nil {
+		return Token{}, p.err
+	}
+	if token, err = p.next(); err != nil {
+		p.err = err
+	}
+	return token, err
+}
+
+func (p *Replayer) next() (Token, error) {
+	if !p.start {
+		var magic [len(eventsMagic)]byte
+		if _, err := io.ReadFull(p.r, magic[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = ErrInvalidEvents
+			}
+			return Token{}, err
+		}
+		if string(magic[:]) != eventsMagic {
+			return Token{}, ErrInvalidEvents
+		}
+		p.start = true
+	}
+
+	size, err := binary.ReadUvarint(p.br)
+	if err != nil {
+		return Token{}, err // io.EOF when there is no more event.
+	}
+	if size > uint64(maxEventSize) {
+		return Token{}, ErrInvalidEvents
+	}
+	if p.buf, err = p.read(p.buf[:0], int(size)); err != nil {
+		return Token{}, err
+	}
+
+	d := eventDecoder{b: p.buf}
+	token := &p.token
+	flags := d.byte()
+	token.SelfClosing = flags&eventSelfClosing != 0
+	token.IsEndElement = flags&eventIsEndElement != 0
+	token.IsCDATA = flags&eventIsCDATA != 0
+	token.Name = d.name()
+	token.Attrs = d.attrs(token.Attrs[:0])
+	var nsDecls []Attr
+	var entities [][]byte
+	if token.x != nil {
+		nsDecls, entities = token.x.nsDecls[:0], token.x.entities[:0]
+	}
+	nsDecls = d.attrs(nsDecls)
+	token.Data = d.bytes()
+	rawData := d.bytes()
+	raw := d.bytes()
+	n := d.uvarint()
+	for i := uint64(0); i < n && !d.invalid; i++ {
+		entities = append(entities, d.bytes())
+	}
+	if raw != nil || rawData != nil || len(nsDecls) > 0 || len(entities) > 0 || token.x != nil {
+		x := token.extra()
+		x.raw, x.rawData, x.nsDecls, x.entities = raw, rawData, nsDecls, entities
+	}
+	if d.invalid || len(d.b) > 0 {
+		return Token{}, ErrInvalidEvents
+	}
+
+	result := *token
+	if len(result.Attrs) == 0 {
+		result.Attrs = nil
+	}
+	return result, nil
+}
+
+// read reads the next size bytes of the event stream into dst. The buffer grows by at most
+// eventReadChunk at a time as the bytes arrive, so a corrupted size can not force a large
+// allocation when the stream is shorter than that.
+func (p *Replayer) read(dst []byte, size int) ([]byte, error) {
+	for len(dst) < size {
+		n := size - len(dst)
+		if n > eventReadChunk {
+			n = eventReadChunk
+		}
+		if cap(dst)-len(dst) < n {
+			c := 2*cap(dst) + n
+			if c > size {
+				c = size
+			}
+			grown := make([]byte, len(dst), c)
+			copy(grown, dst)
+			dst = grown
+		}
+		m, err := io.ReadFull(p.r, dst[len(dst):len(dst)+n])
+		dst = dst[:len(dst)+m]
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+const (
+	// maxEventSize is the maximum size of an event, a larger size indicates a corrupted stream.
+	maxEventSize = 1 << 30
+	// eventReadChunk is the maximum number of bytes read at a time, see Replayer's read.
+	eventReadChunk = 64 << 10
+)
+
+// eventDecoder decodes an event, invalid is set when the event is malformed.
+type eventDecoder struct {
+	b       []byte
+	invalid bool
+}
+
+func (d *eventDecoder) byte() byte {
+	if len(d.b) == 0 {
+		d.invalid = true
+		return 0
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c
+}
+
+func (d *eventDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.invalid = true
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// bytes returns the next bytes, it returns nil for empty bytes as the Tokenizer does.
+func (d *eventDecoder) bytes() []byte {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.invalid = true
+		return nil
+	}
+	if n == 0 {
+		return nil
+	}
+	b := d.b[:n:n]
+	d.b = d.b[n:]
+	return b
+}
+
+// name returns the next name, the Prefix and the Local are subslices of the Full.
+func (d *eventDecoder) name() Name {
+	full := d.bytes()
+	prefix, local := d.uvarint(), d.uvarint()
+	if prefix > uint64(len(full)) || local > uint64(len(full))-prefix {
+		d.invalid = true
+		return Name{}
+	}
+	var name Name
+	name.Full = full
+	if prefix > 0 {
+		name.Prefix = full[:prefix:prefix]
+	}
+	if local > 0 {
+		name.Local = full[uint64(len(full))-local:]
+	}
+	return name
+}
+
+func (d *eventDecoder) attrs(attrs []Attr) []Attr {
+	n := d.uvarint()
+	for i := uint64(0); i < n && !d.invalid; i++ {
+		name := d.name()
+		attrs = append(attrs, Attr{Name: name, Value: d.bytes()})
+	}
+	return attrs
+}
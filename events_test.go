@@ -0,0 +1,231 @@
+package xmltokenizer_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/muktihari/xmltokenizer"
+)
+
+func TestEncodeEventsRoundTrip(t *testing.T) {
+	filenames, err := filepath.Glob(filepath.Join("testdata", "*.*"))
+	if err != nil {
+		panic(err)
+	}
+
+	opts := []xmltokenizer.Option{
+		xmltokenizer.WithKeepRaw(true),
+		xmltokenizer.WithSeparateNamespaceDecls(true),
+	}
+
+	for _, filename := range filenames {
+		t.Run(filepath.Base(filename), func(t *testing.T) {
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				panic(err)
+			}
+			if len(data) > 64<<10 {
+				t.Skip("comparing every token of a large file is slow")
+			}
+
+			var buf bytes.Buffer
+			if err = xmltokenizer.New(bytes.NewReader(data), opts...).EncodeEvents(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			tok := xmltokenizer.New(bytes.NewReader(data), opts...)
+			replayer := xmltokenizer.NewEventReplayer(&buf)
+			for i := 0; ; i++ {
+				expected, err := tok.Token()
+				if err != nil && err != io.EOF {
+					t.Fatal(err)
+				}
+				token, rerr := replayer.Token()
+				if rerr != err {
+					t.Fatalf("[%d] expected error: %v, got: %v", i, err, rerr)
+				}
+				if err == io.EOF {
+					break
+				}
+				if diff := cmp.Diff(token, expected, ignoreUnexported); diff != "" {
+					t.Fatalf("[%d] %s", i, diff)
+				}
+				if diff := cmp.Diff(token.NamespaceDecls(), expected.NamespaceDecls()); diff != "" {
+					t.Fatalf("[%d] NamespaceDecls: %s", i, diff)
+				}
+				if string(token.Raw()) != string(expected.Raw()) {
+					t.Fatalf("[%d] expected Raw: %q, got: %q", i, expected.Raw(), token.Raw())
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeEventsBuffered(t *testing.T) {
+	xml := "<a>" + strings.Repeat(`<b c="d">e</b>`, 100) + "</a>"
+
+	var buf bytes.Buffer
+	var writes int
+	w := writerFunc(func(p []byte) (int, error) {
+		writes++
+		return buf.Write(p)
+	})
+	if err := xmltokenizer.New(strings.NewReader(xml)).EncodeEvents(w); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 1 {
+		t.Fatalf("expected writes: 1, got: %d", writes)
+	}
+
+	replayer := xmltokenizer.NewEventReplayer(&buf)
+	var n int
+	for {
+		if _, err := replayer.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 202 {
+		t.Fatalf("expected tokens: 202, got: %d", n)
+	}
+}
+
+func TestEventReplayerInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	tok := xmltokenizer.New(bytes.NewReader([]byte(`<a b="c">d</a>`)))
+	if err := tok.EncodeEvents(&buf); err != nil {
+		t.Fatal(err)
+	}
+	events := buf.Bytes()
+
+	tt := []struct {
+		name   string
+		events []byte
+		err    error
+	}{
+		{name: "empty", events: nil, err: xmltokenizer.ErrInvalidEvents},
+		{name: "wrong header", events: []byte("<a>d</a>"), err: xmltokenizer.ErrInvalidEvents},
+		{name: "truncated", events: events[:len(events)-1], err: io.ErrUnexpectedEOF},
+		{name: "malformed event", events: append(append([]byte{}, events[:4]...), 2, 0, 9), err: xmltokenizer.ErrInvalidEvents},
+		{name: "size too large", events: binary.AppendUvarint(append([]byte{}, events[:4]...), 1<<31), err: xmltokenizer.ErrInvalidEvents},
+		{name: "size larger than the stream", events: append(binary.AppendUvarint(append([]byte{}, events[:4]...), 1<<29), 0, 0, 0), err: io.ErrUnexpectedEOF},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			replayer := xmltokenizer.NewEventReplayer(bytes.NewReader(tc.events))
+			var err error
+			for err == nil {
+				_, err = replayer.Token()
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if _, err2 := replayer.Token(); err2 != err {
+				t.Fatalf("expected the error to be latched, got: %v", err2)
+			}
+		})
+	}
+}
+
+func TestEventReplayerEntities(t *testing.T) {
+	xml := `<a>b &amp; c &#169;</a><d>e</d>`
+	opts := []xmltokenizer.Option{xmltokenizer.WithCollectEntities(true)}
+
+	var buf bytes.Buffer
+	if err := xmltokenizer.New(strings.NewReader(xml), opts...).EncodeEvents(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	tok := xmltokenizer.New(strings.NewReader(xml), opts...)
+	replayer := xmltokenizer.NewEventReplayer(&buf)
+	var entities int
+	for i := 0; ; i++ {
+		expected, err := tok.Token()
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		token, rerr := replayer.Token()
+		if rerr != err {
+			t.Fatalf("[%d] expected error: %v, got: %v", i, err, rerr)
+		}
+		if err == io.EOF {
+			break
+		}
+		if diff := cmp.Diff(token.Entities(), expected.Entities()); diff != "" {
+			t.Fatalf("[%d] Entities: %s", i, diff)
+		}
+		entities += len(token.Entities())
+	}
+	if entities != 2 {
+		t.Fatalf("expected entities: 2, got: %d", entities)
+	}
+}
+
+func TestEventReplayerRawData(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "cdata.xml"))
+	if err != nil {
+		panic(err)
+	}
+	opts := []xmltokenizer.Option{xmltokenizer.WithRawCharData(true)}
+
+	var buf bytes.Buffer
+	if err = xmltokenizer.New(bytes.NewReader(data), opts...).EncodeEvents(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	tok := xmltokenizer.New(bytes.NewReader(data), opts...)
+	replayer := xmltokenizer.NewEventReplayer(&buf)
+	var rawData int
+	for i := 0; ; i++ {
+		expected, err := tok.Token()
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		token, rerr := replayer.Token()
+		if rerr != err {
+			t.Fatalf("[%d] expected error: %v, got: %v", i, err, rerr)
+		}
+		if err == io.EOF {
+			break
+		}
+		if diff := cmp.Diff(token, expected, ignoreUnexported); diff != "" {
+			t.Fatalf("[%d] %s", i, diff)
+		}
+		if string(token.RawData()) != string(expected.RawData()) {
+			t.Fatalf("[%d] expected RawData: %q, got: %q", i, expected.RawData(), token.RawData())
+		}
+		if len(token.RawData()) > 0 {
+			rawData++
+		}
+	}
+	if rawData != 3 {
+		t.Fatalf("expected tokens with RawData: 3, got: %d", rawData)
+	}
+}
+
+func TestEventReplayerLargeSizeAllocation(t *testing.T) {
+	events := binary.AppendUvarint([]byte("xte\x03"), 1<<29)
+	events = append(events, "truncated"...)
+
+	var err error
+	allocs := testing.AllocsPerRun(10, func() {
+		replayer := xmltokenizer.NewEventReplayer(bytes.NewReader(events))
+		_, err = replayer.Token()
+	})
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected error: %v, got: %v", io.ErrUnexpectedEOF, err)
+	}
+	if allocs > 10 {
+		t.Fatalf("expected at most 10 allocs, got: %v", allocs)
+	}
+}
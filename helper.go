@@ -0,0 +1,781 @@
+package xmltokenizer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CopyText writes the CharData of the start element se into w and advances
+// the Tokenizer past the se's end element, child elements are skipped and
+// their CharData is not written, while the CharData following each child,
+// e.g. " z" of <a>x <b>y</b> z</a>, is. Every CharData is written as it is
+// in Token's Data, so it is trimmed according to WithTrimMode, and the
+// whitespace around the children is only kept using TrimNone.
+// It must be invoked right after Token returns se.
+//
+// When the CharData is too large to fit in the buffer (exceeding the limit set by
+// WithAutoGrowBufferMaxLimitSize), instead of returning an error, the CharData is
+// read in chunks of the read buffer size and written to w without accumulating it,
+// so the memory is kept bounded. Streaming is only supported for CharData, a CDATA
+// section must still fit in the buffer.
+func (t *Tokenizer) CopyText(se *Token, w io.Writer) (n int64, err error) {
+	if se.SelfClosing || se.IsEndElement {
+		return 0, nil
+	}
+
+	depth := t.depth
+	if t.textPending {
+		if n, err = t.streamText(w); err != nil {
+			t.err = err
+			return n, err
+		}
+	} else if len(se.Data) > 0 {
+		nn, err := w.Write(se.Data)
+		n += int64(nn)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	for t.depth >= depth {
+		token, err := t.Token()
+		if err != nil {
+			return n, err
+		}
+		if t.depth != depth || (len(token.Name.Full) == 0 && token.SelfClosing) { // e.g. <!-- comment -->
+			continue
+		}
+		// The CharData following a direct child is the Data of its end element or of the child itself
+		// if it is self-closing, otherwise, it is a standalone CharData, e.g. after a comment.
+		if t.textPending {
+			nn, err := t.streamText(w)
+			n += nn
+			if err != nil {
+				t.err = err
+				return n, err
+			}
+			continue
+		}
+		if len(token.Data) == 0 {
+			continue
+		}
+		nn, err := w.Write(token.Data)
+		n += int64(nn)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// TextReader returns a reader that reads the CharData of the start element se, including
+// the CharData of its child elements, decoded as in WithEntityDecoding and untrimmed as in
+// WithTrimMode(TrimNone) regardless of the options, so the whitespace between the children
+// is kept, e.g. "a b c" of <a>a <b>b</b> c</a>. The Tokenizer is advanced lazily on every
+// Read invocation, and the reader returns
+// io.EOF once the se's end element is reached. It must be invoked right after Token returns
+// se, and the Tokenizer must not be used by others until the reader returns an error.
+// Like CopyText, the CharData that is too large to fit in the buffer is streamed in chunks.
+func (t *Tokenizer) TextReader(se *Token) io.Reader {
+	r := &textReader{t: t, depth: t.depth}
+	if se.SelfClosing || se.IsEndElement {
+		r.err = io.EOF
+		return r
+	}
+	if t.textPending {
+		r.startStreaming()
+		return r
+	}
+	r.setText(t.charData)
+	return r
+}
+
+// textReader is the io.Reader returned by TextReader.
+type textReader struct {
+	t         *Tokenizer
+	depth     int    // the depth of the start element
+	buf       []byte // the unread bytes of the current chunk
+	err       error  // latched error, returned once buf is fully read
+	streaming bool   // true when the pending CharData is being streamed
+	tw        textWriter
+	dw        decodeWriter
+}
+
+func (r *textReader) Read(p []byte) (n int, err error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+	n = copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// fill reads the next chunk of the CharData into buf.
+func (r *textReader) fill() {
+	t := r.t
+	if r.streaming {
+		b, last, err := t.nextTextChunk()
+		if err != nil {
+			r.err = err
+			return
+		}
+		r.dw.buf = r.dw.buf[:0]
+		if r.err = r.tw.write(b); r.err != nil {
+			return
+		}
+		if last {
+			r.streaming = false
+			r.dw.flush()
+		}
+		r.buf = r.dw.buf
+		return
+	}
+
+	if t.depth < r.depth {
+		r.err = io.EOF
+		return
+	}
+
+	token, err := t.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		r.err = err
+		return
+	}
+	if t.depth < r.depth { // The CharData after the se's end element is not included.
+		r.err = io.EOF
+		return
+	}
+	if t.textPending {
+		r.startStreaming()
+		return
+	}
+	if len(token.Name.Full) == 0 && token.SelfClosing { // e.g. <!-- comment -->
+		return
+	}
+	r.setText(t.charData)
+}
+
+// setText sets buf to the untransformed CharData b decoded and untrimmed, regardless of
+// the Tokenizer's options. The text is decoded through dw, while the content of a CDATA
+// section is kept as is. Like Token's Data, the whitespace surrounding a sole CDATA section
+// is insignificant.
+func (r *textReader) setText(b []byte) {
+	const prefix, suffix = "<![CDATA[", "]]>"
+	r.dw.buf, r.dw.carry = r.dw.buf[:0], r.dw.carry[:0]
+	if c := r.t.ws.trim(b); bytes.HasPrefix(c, []byte(prefix)) &&
+		bytes.Index(c, []byte(suffix)) == len(c)-len(suffix) {
+		b = c
+	}
+	for len(b) > 0 {
+		i := bytes.Index(b, []byte(prefix))
+		if i < 0 {
+			r.dw.Write(b)
+			break
+		}
+		r.dw.Write(b[:i])
+		r.dw.flush()
+		b = b[i+len(prefix):]
+		end := bytes.Index(b, []byte(suffix))
+		if end < 0 {
+			r.dw.buf = append(r.dw.buf, b...)
+			break
+		}
+		r.dw.buf = append(r.dw.buf, b[:end]...)
+		b = b[end+len(suffix):]
+	}
+	r.dw.flush()
+	r.buf = r.dw.buf
+}
+
+// startStreaming starts streaming the pending CharData of current token.
+func (r *textReader) startStreaming() {
+	r.t.textPending, r.t.err = false, nil
+	r.streaming = true
+	r.dw.carry = r.dw.carry[:0]
+	r.tw = textWriter{w: &r.dw, mode: TrimNone, ws: r.t.ws}
+}
+
+// decodeWriter decodes the entities of the written bytes into buf, an entity that
+// is split across two writes is held in carry until the next write or flush.
+type decodeWriter struct {
+	buf   []byte
+	carry []byte
+}
+
+func (w *decodeWriter) Write(b []byte) (n int, err error) {
+	const maxLen = len("&#x10FFFF;")
+	n = len(b)
+	if len(w.carry) > 0 {
+		w.carry = append(w.carry, b...)
+		b = w.carry
+	}
+	var rest []byte
+	if i := bytes.LastIndexByte(b, '&'); i >= 0 && len(b)-i < maxLen && bytes.IndexByte(b[i:], ';') < 0 {
+		b, rest = b[:i], b[i:]
+	}
+	w.buf = appendDecoded(w.buf, b)
+	w.carry = append(w.carry[:0], rest...) // rest may overlap carry, append copies it forward.
+	return n, nil
+}
+
+// flush writes the held bytes into buf as is, since they are not a valid entity.
+func (w *decodeWriter) flush() {
+	w.buf = append(w.buf, w.carry...)
+	w.carry = w.carry[:0]
+}
+
+// CollectText collects the CharData of every direct child element of the start element se
+// whose Name.Local is equal to local, e.g. "a" and "b" of <keywords><k>a</k><k>b</k></keywords>,
+// other children are skipped. It advances the Tokenizer past the se's end element, so it must
+// be invoked right after Token returns se. A self-closing child yields an empty text.
+// The CharData is as it is in Token's Data, while the returned texts are copies that are owned
+// by the caller since the buffer is reused while reading the next tokens.
+func (t *Tokenizer) CollectText(se *Token, local string) ([][]byte, error) {
+	if se.SelfClosing || se.IsEndElement {
+		return nil, nil
+	}
+
+	var buf []byte
+	var ends []int
+	depth := t.depth
+	for t.depth >= depth {
+		token, err := t.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if token.IsEndElement || string(token.Name.Local) != local {
+			continue
+		}
+		if (token.SelfClosing && t.depth == depth) || (!token.SelfClosing && t.depth == depth+1) {
+			buf = append(buf, token.Data...)
+			ends = append(ends, len(buf))
+		}
+	}
+
+	texts := make([][]byte, len(ends))
+	var start int
+	for i, end := range ends {
+		texts[i] = buf[start:end:end]
+		start = end
+	}
+	return texts, nil
+}
+
+// Skip advances the Tokenizer past the end element of the start element se, including
+// all of its children. It must be invoked right after Token returns se. It does nothing
+// if se is a self-closing element or an end element.
+func (t *Tokenizer) Skip(se *Token) error {
+	if se.SelfClosing || se.IsEndElement {
+		return nil
+	}
+	depth := t.depth
+	for t.depth >= depth {
+		if _, err := t.Token(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadElement advances the Tokenizer past the end element of the start element se, including
+// all of its children, and returns the end element, e.g. to record the element's byte span using
+// InputOffset. It must be invoked right after Token returns se. It is Skip that returns the end
+// element instead of discarding it. If se is a self-closing element, it returns the synthetic end
+// element of WithSyntheticEndElements, consuming it, or without the option, a synthetic end element
+// of se's name without advancing. If se is an end element, it returns se itself.
+func (t *Tokenizer) ReadElement(se *Token) (end Token, err error) {
+	if se.IsEndElement {
+		return *se, nil
+	}
+	if se.SelfClosing {
+		if t.endPending {
+			return t.Token()
+		}
+		return Token{Name: se.Name, IsEndElement: true}, nil
+	}
+	depth := t.depth
+	for {
+		token, err := t.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return Token{}, err
+		}
+		if t.depth < depth {
+			return token, nil
+		}
+	}
+}
+
+// CountChildren advances the Tokenizer past the end element of the start element se, including
+// all of its children, and returns the number of the se's direct child elements, e.g. the number
+// of <row> in <sheetData>. It must be invoked right after Token returns se. It returns zero
+// without advancing if se is a self-closing element or an end element.
+func (t *Tokenizer) CountChildren(se *Token) (n int, err error) {
+	if se.SelfClosing || se.IsEndElement {
+		return 0, nil
+	}
+	depth := t.depth
+	for {
+		token, err := t.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		if t.depth < depth {
+			return n, nil
+		}
+		if token.IsEndElement || len(token.Name.Full) == 0 {
+			continue
+		}
+		if (token.SelfClosing && t.depth == depth) || (!token.SelfClosing && t.depth == depth+1) {
+			n++
+		}
+	}
+}
+
+// SkipSiblings skips the next n elements at the current depth, including all of their
+// children, e.g. skipping n <row> elements after Token returns <sheetData>. It returns the
+// number of the skipped elements, which is less than n when the parent's end element is
+// reached first, the parent's end element is consumed in that case. Reaching the end of
+// the input returns io.ErrUnexpectedEOF, or io.EOF when the current depth is the top-level.
+func (t *Tokenizer) SkipSiblings(n int) (skipped int, err error) {
+	depth := t.depth
+	for skipped < n {
+		token, err := t.Token()
+		if err != nil {
+			if err == io.EOF && depth > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return skipped, err
+		}
+		if token.IsEndElement {
+			if t.depth < depth {
+				return skipped, nil // The parent's end element, since the siblings are skipped entirely.
+			}
+			continue // The synthetic end element of a self-closing sibling, see WithSyntheticEndElements.
+		}
+		if len(token.Name.Full) == 0 { // CharData, Comment, ProcInst, etc.
+			continue
+		}
+		if err = t.Skip(&token); err != nil {
+			return skipped, err
+		}
+		if token.SelfClosing {
+			t.endPending = false // The synthetic end element, if any, is skipped along with its sibling.
+		}
+		skipped++
+	}
+	return skipped, nil
+}
+
+// Each reads the tokens until the end of the input and invokes fn for every start element,
+// at any depth, whose Name.Local is equal to local, e.g. every <sheetData> of a workbook.
+// The se is a copy that remains valid during the fn invocation, while its Attrs are only
+// shallow copied. The fn typically consumes the element using an UnmarshalToken or Skip,
+// otherwise, Each continues with the element's children. Any error returned by fn stops
+// Each and is returned as is. Each returns nil when the end of the input is reached.
+func (t *Tokenizer) Each(local string, fn func(se *Token) error) error {
+	for {
+		token, err := t.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if token.IsEndElement || string(token.Name.Local) != local {
+			continue
+		}
+		se := GetToken().Copy(token)
+		err = fn(se)
+		PutToken(se)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Find reads the tokens until it finds the first start element matching the path of Name.Local,
+// e.g. Find("trk", "trkseg", "trkpt"), and returns it, positioned for its UnmarshalToken. The
+// first element of the path is searched at any depth, every following element must be a direct
+// child of the previous one, the other children of a matched element are skipped using Skip.
+// The returned token is only valid before next Token or RawToken method invocation, so it
+// should be copied using GetToken().Copy before being unmarshaled. If no element matches
+// the path before the end of the input, it returns an error wrapping ErrNotFound.
+func (t *Tokenizer) Find(path ...string) (*Token, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty path: %w", ErrNotFound)
+	}
+
+	var depths []int // the depths right after the matched elements of the path
+	for {
+		token, err := t.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s: %w", strings.Join(path, "/"), ErrNotFound)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if token.IsEndElement {
+			if n := len(depths); n > 0 && t.depth < depths[n-1] {
+				depths = depths[:n-1] // The matched element ends without the rest of the path.
+			}
+			continue
+		}
+		if len(token.Name.Full) == 0 {
+			continue
+		}
+
+		level := len(depths)
+		if string(token.Name.Local) != path[level] {
+			if level > 0 { // Not a part of the path, only the direct children are matched.
+				if err = t.Skip(&token); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if level == len(path)-1 {
+			return &token, nil
+		}
+		if !token.SelfClosing {
+			depths = append(depths, t.depth)
+		}
+	}
+}
+
+// Walk reads the tokens until the end of the input, invoking enter for every start element and
+// exit for every end element, a visitor over the element tree without building it in memory.
+// The se is a copy that remains valid during the enter invocation, while its Attrs are only
+// shallow copied. The enter decides whether to descend into se's children, otherwise, the
+// children are skipped using Skip, so enter must not advance the Tokenizer itself. The exit is
+// invoked for every entered element, including a self-closing or skipped one, right after its
+// children, the name is only valid during the exit invocation. The exit may be nil. Any error
+// returned by enter or exit stops Walk and is returned as is. Walk returns nil when the end
+// of the input is reached, or io.ErrUnexpectedEOF if there are unclosed elements. When Walk is
+// invoked inside an element, e.g. right after Token returns the root start element, it only walks
+// that element's children and returns nil after its end element, without invoking exit for it.
+func (t *Tokenizer) Walk(enter func(se *Token) (descend bool, err error), exit func(name Name) error) error {
+	depth := t.depth
+	for {
+		token, err := t.Token()
+		if err == io.EOF {
+			if t.depth > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(token.Name.Full) == 0 { // CharData, Comment, ProcInst, etc.
+			continue
+		}
+		if token.IsEndElement {
+			if t.depth < depth { // The end element of the element Walk is invoked in.
+				return nil
+			}
+			if exit != nil {
+				if err = exit(token.Name); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		se := GetToken().Copy(token)
+		err = t.walkElement(se, enter, exit)
+		PutToken(se)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// walkElement invokes enter for the start element se, the exit is invoked right away
+// if se is a self-closing element or its children are skipped.
+func (t *Tokenizer) walkElement(se *Token, enter func(se *Token) (descend bool, err error), exit func(name Name) error) error {
+	descend, err := enter(se)
+	if err != nil {
+		return err
+	}
+	if descend && !se.SelfClosing { // exit is invoked on its end element.
+		return nil
+	}
+	if err = t.Skip(se); err != nil {
+		return err
+	}
+	if se.SelfClosing {
+		t.endPending = false // The synthetic end element, if any, is consumed since exit is invoked here.
+	}
+	if exit != nil {
+		return exit(se.Name)
+	}
+	return nil
+}
+
+// Prolog reads the tokens preceding the root element, e.g. the XML declaration, the ProcInsts such as
+// <?xml-stylesheet ?>, the DOCTYPE and the comments, and returns them in order along with the root's
+// start element. It must be invoked before the first Token invocation. The returned tokens are deep
+// copies owned by the caller, so they remain valid after the Tokenizer reads the next tokens, and
+// the Tokenizer is then positioned for the root's children, e.g. for its UnmarshalToken. If the input
+// ends before the root element, it returns the tokens read so far and io.ErrUnexpectedEOF.
+func (t *Tokenizer) Prolog() (prolog []Token, root *Token, err error) {
+	var arena []byte // Grows at most once per copy, the earlier copies are never moved.
+	for {
+		token, err := t.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return prolog, nil, err
+		}
+		if len(token.Name.Full) > 0 && !token.IsEndElement {
+			return prolog, new(Token).CopyDeepInto(token, &arena), nil
+		}
+		prolog = append(prolog, Token{})
+		prolog[len(prolog)-1].CopyDeepInto(token, &arena)
+	}
+}
+
+// IndexIDs reads the tokens until the end of the input and returns the InputOffset of every
+// start element that has the attribute whose Name.Full is equal to idAttr, e.g. "xml:id" or "id",
+// indexed by the attribute's value, so an element can be found by the id that cross-references it.
+// The offset is relative to where the Tokenizer starts reading, to tokenize the element later,
+// e.g. seek the reader to the offset and create a new Tokenizer with it. Only the first element
+// of a duplicate id is indexed. The elements read using WithNamesOnly have no attribute.
+func (t *Tokenizer) IndexIDs(idAttr string) (map[string]int64, error) {
+	ids := make(map[string]int64)
+	for {
+		token, err := t.Token()
+		if err == io.EOF {
+			return ids, nil
+		}
+		if err != nil {
+			return ids, err
+		}
+		if token.IsEndElement || len(token.Name.Full) == 0 {
+			continue
+		}
+
+		attrs := token.Attrs
+		if attrsRaw := token.lazyAttrs(); attrsRaw != nil { // WithLazyAttrs
+			attrs = attrs[:0]
+			s := attrScanner{b: attrsRaw}
+			for attr, ok := s.next(); ok; attr, ok = s.next() {
+				attrs = append(attrs, attr)
+			}
+		}
+		for i := range attrs {
+			if string(attrs[i].Name.Full) != idAttr {
+				continue
+			}
+			if _, ok := ids[string(attrs[i].Value)]; !ok {
+				ids[string(attrs[i].Value)] = t.InputOffset()
+			}
+			break
+		}
+	}
+}
+
+// streamText streams the pending CharData into w, it reuses the buffer
+// for every chunk since the previous chunks are no longer needed.
+func (t *Tokenizer) streamText(w io.Writer) (n int64, err error) {
+	t.textPending, t.err = false, nil
+
+	tw := textWriter{w: w, mode: t.options.trimMode, ws: t.ws}
+	for {
+		b, last, err := t.nextTextChunk()
+		if err != nil {
+			return tw.n, err
+		}
+		if err = tw.write(b); err != nil {
+			return tw.n, err
+		}
+		if last {
+			return tw.n, nil
+		}
+	}
+}
+
+// nextTextChunk returns the next chunk of the pending CharData, last is true if it is
+// the final chunk. The chunk is only valid before the next nextTextChunk invocation.
+func (t *Tokenizer) nextTextChunk() (b []byte, last bool, err error) {
+	if t.textStart < 0 { // The previous chunk is consumed, refill the buffer.
+		t.countLines(t.n)
+		t.buf, t.cur, t.textStart = t.buf[:0], 0, 0
+		if err = t.manageBuffer(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, false, err
+		}
+	}
+	b = t.buf[t.textStart:]
+	if i := bytes.IndexByte(b, '<'); i >= 0 {
+		t.cur = t.textStart + i
+		return b[:i], true, nil
+	}
+	t.textStart = -1
+	return b, false, nil
+}
+
+// textWriter writes CharData chunks into w applying the trimming policy.
+type textWriter struct {
+	w       io.Writer
+	mode    TrimMode
+	n       int64
+	started bool   // true when a non-whitespace char has been found
+	pending []byte // whitespace held until a non-whitespace char is found, dropped if none
+	ws      *whitespace
+}
+
+func (tw *textWriter) write(b []byte) error {
+	if !tw.started && (tw.mode == TrimBoth || tw.mode == TrimLeading) {
+		if b = tw.ws.trimPrefix(b); len(b) == 0 {
+			return nil
+		}
+	}
+	if tw.mode == TrimNone || tw.mode == TrimLeading {
+		tw.started = true
+		return tw.emit(b)
+	}
+
+	body := tw.ws.trimSuffix(b)
+	if len(body) == 0 {
+		tw.pending = append(tw.pending, b...)
+		return nil
+	}
+	tw.started = true
+	if err := tw.emit(tw.pending); err != nil {
+		return err
+	}
+	if err := tw.emit(body); err != nil {
+		return err
+	}
+	tw.pending = append(tw.pending[:0], b[len(body):]...)
+	return nil
+}
+
+func (tw *textWriter) emit(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	n, err := tw.w.Write(b)
+	tw.n += int64(n)
+	return err
+}
+
+// Expect reads the next token and returns it only if it is a start element
+// (including a self-closing one) whose Name.Local is equal to local, otherwise,
+// it returns an error wrapping ErrUnexpectedElement describing the actual token
+// and its byte position. Reaching the end of the input returns io.ErrUnexpectedEOF.
+// Note that any token such as a comment or a processing instruction is not skipped.
+func (t *Tokenizer) Expect(local string) (Token, error) {
+	token, err := t.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return token, err
+	}
+	if token.IsEndElement || string(token.Name.Local) != local {
+		return token, fmt.Errorf("byte pos %d: expected <%s>, got %s: %w",
+			t.offset, local, describe(&token), ErrUnexpectedElement)
+	}
+	return token, nil
+}
+
+// ReadEmpty reads the next token and returns it only if it is an empty element whose Name.Local
+// is equal to local, e.g. a flag such as <true/>, consuming the element entirely. Both <true/> and
+// <true></true> are empty, as well as <true>  </true> unless WithPreserveWhitespace is enabled,
+// the synthetic end element of WithSyntheticEndElements is consumed as well. If the next token is
+// not a start element of the given name, it returns an error like Expect, and if the element has
+// a CharData or a child, it returns an error wrapping ErrNotEmpty without consuming the rest of it.
+// The returned token is only valid before next Token or RawToken method invocation.
+func (t *Tokenizer) ReadEmpty(local string) (Token, error) {
+	token, err := t.Expect(local)
+	if err != nil {
+		return token, err
+	}
+	if token.SelfClosing {
+		t.endPending = false // The synthetic end element, if any, is consumed without being returned.
+		return token, nil
+	}
+	if len(token.Data) > 0 || t.textPending {
+		return token, fmt.Errorf("byte pos %d: <%s> has CharData: %w", t.offset, local, ErrNotEmpty)
+	}
+
+	t.empty.Copy(token).CopyAttrs() // token is overwritten once its end element is read.
+	offset := t.offset
+	end, err := t.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return t.empty, err
+	}
+	if !end.IsEndElement {
+		t.Unread() // Not consumed, e.g. a child element.
+		return t.empty, fmt.Errorf("byte pos %d: <%s> has %s: %w", offset, local, describe(&end), ErrNotEmpty)
+	}
+	return t.empty, nil
+}
+
+// describe describes the token for error messages.
+func describe(token *Token) string {
+	switch {
+	case len(token.Name.Full) == 0:
+		return fmt.Sprintf("%q", token.Data)
+	case token.IsEndElement:
+		return "</" + string(token.Name.Full) + ">"
+	default:
+		return "<" + string(token.Name.Full) + ">"
+	}
+}
+
+// ReadUntil reads the tokens until it encounters a start element whose Name.Local
+// is equal to local, it returns the raw bytes preceding the start element as they
+// are in the input, byte for byte, and the start element. It is useful for splitting
+// a stream on record boundaries. The CharData right after the start element is its
+// Data, so it is not included in the raw bytes returned by the next invocation.
+// The returned bytes are owned by the caller, while the returned token is only
+// valid before next Token or RawToken method invocation. If the start element
+// never appears, it returns the accumulated bytes and io.EOF.
+func (t *Tokenizer) ReadUntil(local string) ([]byte, *Token, error) {
+	t.keepLead = true
+	defer func() { t.keepLead = false }()
+
+	var b []byte
+	for {
+		token, err := t.Token()
+		b = append(b, t.lead...) // The whitespace that is not a part of any token, e.g. <?xml ?>\n<a>
+		t.lead = t.lead[:0]
+		if err != nil {
+			return b, nil, err
+		}
+		if !token.IsEndElement && string(token.Name.Local) == local {
+			return b, &token, nil
+		}
+		b = append(b, t.raw...)
+	}
+}
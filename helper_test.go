@@ -0,0 +1,1174 @@
+package xmltokenizer_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/muktihari/xmltokenizer"
+)
+
+func TestCopyText(t *testing.T) {
+	blob := strings.Repeat("QUJDRA==", 512<<10) // 4 MB
+
+	tt := []struct {
+		name     string
+		xml      string
+		opts     []xmltokenizer.Option
+		expected string
+	}{
+		{
+			name:     "small text",
+			xml:      "<root><blob>\n  small <b>child</b> tail\n</blob><next>ok</next></root>",
+			expected: "smalltail",
+		},
+		{
+			name:     "text following the children",
+			xml:      "<root><blob>x &amp; <b>y</b> z<c/> w<!-- c --> v<d><e>f</e></d></blob><next>ok</next></root>",
+			opts:     []xmltokenizer.Option{xmltokenizer.WithTrimMode(xmltokenizer.TrimNone)},
+			expected: "x &amp;  z w v",
+		},
+		{
+			name: "text following the children with synthetic end elements",
+			xml:  "<root><blob>x &amp; <b>y</b> z<c/> w<!-- c --> v<d><e>f</e></d></blob><next>ok</next></root>",
+			opts: []xmltokenizer.Option{
+				xmltokenizer.WithTrimMode(xmltokenizer.TrimNone),
+				xmltokenizer.WithSyntheticEndElements(true),
+			},
+			expected: "x &amp;  z w v",
+		},
+		{
+			name: "large text following a child streamed with bounded buffer",
+			xml:  "<root><blob>a<b/>\n  " + blob + "  \n</blob><next>ok</next></root>",
+			opts: []xmltokenizer.Option{
+				xmltokenizer.WithReadBufferSize(1 << 10),
+				xmltokenizer.WithAutoGrowBufferMaxLimitSize(64 << 10),
+			},
+			expected: "a" + blob,
+		},
+		{
+			name: "large text streamed with bounded buffer",
+			xml:  "<root><blob>\n  " + blob + "  \n</blob><next>ok</next></root>",
+			opts: []xmltokenizer.Option{
+				xmltokenizer.WithReadBufferSize(1 << 10),
+				xmltokenizer.WithAutoGrowBufferMaxLimitSize(64 << 10),
+			},
+			expected: blob,
+		},
+		{
+			name: "large text streamed without trimming",
+			xml:  "<root><blob>\n  " + blob + "  \n</blob><next>ok</next></root>",
+			opts: []xmltokenizer.Option{
+				xmltokenizer.WithReadBufferSize(1 << 10),
+				xmltokenizer.WithAutoGrowBufferMaxLimitSize(64 << 10),
+				xmltokenizer.WithTrimMode(xmltokenizer.TrimNone),
+			},
+			expected: "\n  " + blob + "  \n",
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(tc.xml), tc.opts...)
+
+			var buf bytes.Buffer
+			var next string
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				switch string(token.Name.Local) {
+				case "blob":
+					n, err := tok.CopyText(&token, &buf)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if n != int64(buf.Len()) {
+						t.Fatalf("expected n: %d, got: %d", buf.Len(), n)
+					}
+				case "next":
+					if !token.IsEndElement {
+						next = string(token.Data)
+					}
+				}
+			}
+
+			if buf.String() != tc.expected {
+				t.Fatalf("expected len: %d, got len: %d", len(tc.expected), buf.Len())
+			}
+			if diff := cmp.Diff(next, "ok"); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestCollectText(t *testing.T) {
+	for _, size := range []int{1, 4096} {
+		t.Run(fmt.Sprintf("read buffer size %d", size), func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", "repeated_children.xml"))
+			if err != nil {
+				panic(err)
+			}
+			defer f.Close()
+
+			tok := xmltokenizer.New(f, xmltokenizer.WithReadBufferSize(size))
+
+			var results [][]string
+			var authors string
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				switch string(token.Name.Local) {
+				case "keywords":
+					texts, err := tok.CollectText(&token, "k")
+					if err != nil {
+						t.Fatal(err)
+					}
+					var result []string
+					for _, text := range texts {
+						result = append(result, string(text))
+					}
+					results = append(results, result)
+				case "name":
+					if !token.IsEndElement {
+						authors = string(token.Data)
+					}
+				}
+			}
+
+			expected := [][]string{{"xml", "tokenizer", "", "go &amp; fast"}, nil}
+			if diff := cmp.Diff(results, expected); diff != "" {
+				t.Fatal(diff)
+			}
+			if authors != "a" {
+				t.Fatalf("expected the Tokenizer to continue after the se's end element, got: %q", authors)
+			}
+		})
+	}
+
+	t.Run("unexpected EOF", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<keywords><k>a</k>"))
+		token, _ := tok.Token()
+		if _, err := tok.CollectText(&token, "k"); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected: %v, got: %v", io.ErrUnexpectedEOF, err)
+		}
+	})
+}
+
+func TestTextReader(t *testing.T) {
+	blob := strings.Repeat("x &amp; &#169; ", 64<<10) // 1 MB
+
+	tt := []struct {
+		name     string
+		xml      string
+		opts     []xmltokenizer.Option
+		expected string
+	}{
+		{
+			name:     "text of children is concatenated and decoded",
+			xml:      "<root><blob>\n  a &lt; <b>&#x62;<!-- c --><c/>c</b> <![CDATA[&amp;]]> </blob><next>ok</next></root>",
+			expected: "\n  a < bc&amp;", // The whitespace surrounding a CDATA section is insignificant.
+		},
+		{
+			name:     "self-closing",
+			xml:      "<root><blob/><next>ok</next></root>",
+			expected: "",
+		},
+		{
+			name:     "entity decoding enabled",
+			xml:      "<root><blob>&amp;<b>&#38;</b></blob><next>ok</next></root>",
+			opts:     []xmltokenizer.Option{xmltokenizer.WithEntityDecoding(true)},
+			expected: "&&",
+		},
+		{
+			name: "large text streamed with bounded buffer",
+			xml:  "<root><blob>\n  " + blob + "\n</blob><next>ok</next></root>",
+			opts: []xmltokenizer.Option{
+				xmltokenizer.WithReadBufferSize(1 << 10),
+				xmltokenizer.WithAutoGrowBufferMaxLimitSize(64 << 10),
+			},
+			expected: "\n  " + strings.Repeat("x & © ", 64<<10) + "\n",
+		},
+		{
+			name:     "whitespace between children is kept regardless of trim mode",
+			xml:      "<root><blob>a <b>b</b> c</blob><next>ok</next></root>",
+			opts:     []xmltokenizer.Option{xmltokenizer.WithTrimMode(xmltokenizer.TrimBoth)},
+			expected: "a b c",
+		},
+		{
+			name:     "options are unchanged after reading",
+			xml:      "<root><blob> a &amp; </blob><next> ok </next></root>",
+			expected: " a & ",
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(tc.xml), tc.opts...)
+
+			var result []byte
+			var next string
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				switch string(token.Name.Local) {
+				case "blob":
+					if token.IsEndElement {
+						t.Fatalf("expected the reader to consume the end element")
+					}
+					r := tok.TextReader(&token)
+					p := make([]byte, 3)
+					for {
+						n, err := r.Read(p)
+						result = append(result, p[:n]...)
+						if err == io.EOF {
+							break
+						}
+						if err != nil {
+							t.Fatal(err)
+						}
+					}
+				case "next":
+					if !token.IsEndElement {
+						next = string(token.Data)
+					}
+				}
+			}
+
+			if string(result) != tc.expected {
+				if len(result) > 64 || len(tc.expected) > 64 {
+					t.Fatalf("expected len: %d, got len: %d", len(tc.expected), len(result))
+				}
+				t.Fatalf("expected: %q, got: %q", tc.expected, result)
+			}
+			if next != "ok" {
+				t.Fatalf("expected the Tokenizer to continue after the se's end element, got: %q", next)
+			}
+		})
+	}
+
+	t.Run("unexpected EOF", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<blob>a<b>b</b>"))
+		token, _ := tok.Token()
+		if _, err := io.ReadAll(tok.TextReader(&token)); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected: %v, got: %v", io.ErrUnexpectedEOF, err)
+		}
+	})
+}
+
+func TestReadElement(t *testing.T) {
+	const xml = `<a><b x="1"><c>text</c><b>nested</b></b><d/></a>`
+
+	tok := xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithReadBufferSize(1))
+	tok.Token() // <a>
+	se, err := tok.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := tok.InputOffset()
+
+	end, err := tok.ReadElement(&se)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !end.IsEndElement || string(end.Name.Full) != "b" {
+		t.Fatalf("expected </b>, got: %s", end)
+	}
+	const span = `<b x="1"><c>text</c><b>nested</b></b>`
+	if off := tok.InputOffset() + int64(len("</b>")); xml[start:off] != span {
+		t.Fatalf("expected span: %q, got: %q", span, xml[start:off])
+	}
+
+	token, err := tok.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end, err = tok.ReadElement(&token); err != nil || !end.IsEndElement || string(end.Name.Full) != "d" {
+		t.Fatalf("expected synthetic </d>, got: %s, %v", end, err)
+	}
+	if token, err = tok.Token(); err != nil || !token.IsEndElement || string(token.Name.Full) != "a" {
+		t.Fatalf("expected </a>, got: %s, %v", token, err)
+	}
+
+	t.Run("synthetic end elements", func(t *testing.T) {
+		const xml = `<a><b/><c><d/></c></a>`
+		tok := xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithSyntheticEndElements(true))
+		tok.Token() // <a>
+		for _, local := range []string{"b", "c"} {
+			se, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			end, err := tok.ReadElement(&se)
+			if err != nil || !end.IsEndElement || string(end.Name.Full) != local {
+				t.Fatalf("expected </%s>, got: %s, %v", local, end, err)
+			}
+		}
+		if off := tok.InputOffset(); xml[off:] != "</c></a>" {
+			t.Fatalf("expected the offset of </c>, got: %q", xml[off:])
+		}
+		if token, err := tok.Token(); err != nil || !token.IsEndElement || string(token.Name.Full) != "a" {
+			t.Fatalf("expected </a>, got: %s, %v", token, err)
+		}
+	})
+
+	t.Run("unexpected EOF", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<a><b>"))
+		token, _ := tok.Token()
+		if _, err := tok.ReadElement(&token); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected: %v, got: %v", io.ErrUnexpectedEOF, err)
+		}
+	})
+}
+
+func TestCountChildren(t *testing.T) {
+	tt := []struct {
+		filename string
+		local    string
+		expected int
+	}{
+		{filename: "repeated_children.xml", local: "article", expected: 4},
+		{filename: "repeated_children.xml", local: "keywords", expected: 5},
+		{filename: "repeated_children.xml", local: "k", expected: 0},
+		{filename: "xlsx_sheet1.xml", local: "sheetData", expected: 10},
+		{filename: "hike_mt_prau.gpx", local: "gpx", expected: 2},
+		{filename: "hike_mt_prau.gpx", local: "trkseg", expected: 7799},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s <%s>", i, tc.filename, tc.local), func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tc.filename))
+			if err != nil {
+				panic(err)
+			}
+			defer f.Close()
+
+			tok := xmltokenizer.New(f)
+			for {
+				token, err := tok.Token()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(token.Name.Local) != tc.local {
+					continue
+				}
+				depth := tok.Depth()
+				n, err := tok.CountChildren(&token)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != tc.expected {
+					t.Fatalf("expected: %d, got: %d", tc.expected, n)
+				}
+				if tok.Depth() != depth-1 {
+					t.Fatalf("expected the Tokenizer to be advanced past the end element")
+				}
+				return
+			}
+		})
+	}
+
+	t.Run("self-closing", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<a/><b/>"))
+		token, _ := tok.Token()
+		if n, err := tok.CountChildren(&token); n != 0 || err != nil {
+			t.Fatalf("expected: 0, nil, got: %d, %v", n, err)
+		}
+		if token, _ = tok.Token(); string(token.Name.Full) != "b" {
+			t.Fatalf("expected <b/>, got: %s", token)
+		}
+	})
+
+	t.Run("unexpected EOF", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<a><b/><c>"))
+		token, _ := tok.Token()
+		if n, err := tok.CountChildren(&token); n != 2 || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected: 2, %v, got: %d, %v", io.ErrUnexpectedEOF, n, err)
+		}
+	})
+}
+
+func TestSkipSiblings(t *testing.T) {
+	for _, size := range []int{1, 4096} {
+		t.Run(fmt.Sprintf("read buffer size %d", size), func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", "xlsx_sheet1.xml"))
+			if err != nil {
+				panic(err)
+			}
+			defer f.Close()
+
+			tok := xmltokenizer.New(f, xmltokenizer.WithReadBufferSize(size))
+			for {
+				token, err := tok.Token()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(token.Name.Local) == "sheetData" {
+					break
+				}
+			}
+
+			skipped, err := tok.SkipSiblings(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if skipped != 2 {
+				t.Fatalf("expected skipped: 2, got: %d", skipped)
+			}
+
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r := token.AttrValue("r"); string(token.Name.Local) != "row" || string(r) != "3" {
+				t.Fatalf("expected <row r=\"3\">, got: <%s r=%q>", token.Name.Local, r)
+			}
+			if err = tok.Skip(&token); err != nil {
+				t.Fatal(err)
+			}
+
+			// Only 7 rows remain, the </sheetData> is consumed.
+			if skipped, err = tok.SkipSiblings(10); err != nil {
+				t.Fatal(err)
+			}
+			if skipped != 7 {
+				t.Fatalf("expected skipped: 7, got: %d", skipped)
+			}
+			if token, err = tok.Token(); err != nil {
+				t.Fatal(err)
+			}
+			if string(token.Name.Local) != "printOptions" {
+				t.Fatalf("expected <printOptions>, got: %q", token.Name.Full)
+			}
+		})
+	}
+
+	t.Run("unexpected EOF", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<rows><row/><row>"))
+		_, _ = tok.Token()
+		skipped, err := tok.SkipSiblings(2)
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected: %v, got: %v", io.ErrUnexpectedEOF, err)
+		}
+		if skipped != 1 {
+			t.Fatalf("expected skipped: 1, got: %d", skipped)
+		}
+	})
+
+	t.Run("synthetic end elements", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<rows><row/><row/><row r=\"3\"/></rows>"),
+			xmltokenizer.WithSyntheticEndElements(true))
+		_, _ = tok.Token()
+		skipped, err := tok.SkipSiblings(2)
+		if err != nil || skipped != 2 {
+			t.Fatalf("expected: 2, <nil>, got: %d, %v", skipped, err)
+		}
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := token.AttrValue("r"); string(token.Name.Local) != "row" || string(r) != "3" {
+			t.Fatalf("expected <row r=\"3\">, got: %s", token)
+		}
+		if skipped, err = tok.SkipSiblings(2); err != nil || skipped != 0 {
+			t.Fatalf("expected: 0, <nil>, got: %d, %v", skipped, err)
+		}
+		if _, err = tok.Token(); err != io.EOF {
+			t.Fatalf("expected </rows> to be consumed, got: %v", err)
+		}
+	})
+
+	t.Run("top-level EOF", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<a/><b></b>"))
+		skipped, err := tok.SkipSiblings(3)
+		if !errors.Is(err, io.EOF) || skipped != 2 {
+			t.Fatalf("expected: 2, %v, got: %d, %v", io.EOF, skipped, err)
+		}
+	})
+}
+
+func TestEach(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "xlsx_multi_sheets.xml"))
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	tok := xmltokenizer.New(f)
+
+	var sheets []string
+	err = tok.Each("worksheet", func(se *xmltokenizer.Token) error {
+		sheets = append(sheets, string(se.AttrValue("name")))
+		return tok.Skip(se)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(sheets, []string{"Sheet1", "Sheet2", "Sheet3"}); diff != "" {
+		t.Fatal(diff)
+	}
+
+	t.Run("nested", func(t *testing.T) {
+		data, err := os.ReadFile(filepath.Join("testdata", "xlsx_multi_sheets.xml"))
+		if err != nil {
+			panic(err)
+		}
+		tok := xmltokenizer.New(bytes.NewReader(data))
+		var refs []string
+		err = tok.Each("c", func(se *xmltokenizer.Token) error { // Not consumed, Each continues with its children.
+			refs = append(refs, string(se.AttrValue("r")))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(refs, []string{"A1", "B1", "A2", "B2", "A1"}); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("skip and error", func(t *testing.T) {
+		const xml = `<r><a n="1"><a n="nested"/></a><a n="2"/><a n="3"/></r>`
+		errStop := errors.New("stop")
+
+		tok := xmltokenizer.New(strings.NewReader(xml))
+		var ns []string
+		err := tok.Each("a", func(se *xmltokenizer.Token) error {
+			ns = append(ns, string(se.AttrValue("n")))
+			if len(ns) == 2 {
+				return errStop
+			}
+			return tok.Skip(se)
+		})
+		if !errors.Is(err, errStop) {
+			t.Fatalf("expected: %v, got: %v", errStop, err)
+		}
+		if diff := cmp.Diff(ns, []string{"1", "2"}); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("skip unexpected EOF", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader(`<r><a>`))
+		token, _ := tok.Token()
+		if err := tok.Skip(&token); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected: %v, got: %v", io.ErrUnexpectedEOF, err)
+		}
+	})
+}
+
+func TestFind(t *testing.T) {
+	t.Run("gpx", func(t *testing.T) {
+		data, err := os.ReadFile(filepath.Join("testdata", "hike_mt_prau.gpx"))
+		if err != nil {
+			panic(err)
+		}
+
+		tok := xmltokenizer.New(bytes.NewReader(data), xmltokenizer.WithReadBufferSize(1<<10))
+		se, err := tok.Find("metadata", "time")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(se.Data); s != "2023-10-22T02:55:22Z" {
+			t.Fatalf("expected metadata's time: 2023-10-22T02:55:22Z, got: %s", s)
+		}
+
+		se, err = tok.Find("trk", "trkseg", "trkpt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := bytes.Index(data, []byte("<trkpt "))
+		end := start + bytes.IndexByte(data[start:], '>') + 1
+		if raw := string(data[start:end]); se.String() != raw {
+			t.Fatalf("expected the first trkpt: %s, got: %s", raw, se)
+		}
+
+		se = xmltokenizer.GetToken().Copy(*se)
+		defer xmltokenizer.PutToken(se)
+		var ele []byte
+		for {
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.IsEndElementOf(se) {
+				break
+			}
+			if string(token.Name.Local) == "ele" {
+				ele = append(ele, token.Data...)
+			}
+		}
+		if len(ele) == 0 {
+			t.Fatalf("expected the trkpt's ele")
+		}
+
+		if _, err = tok.Find("trk", "metadata"); !errors.Is(err, xmltokenizer.ErrNotFound) {
+			t.Fatalf("expected: %v, got: %v", xmltokenizer.ErrNotFound, err)
+		}
+	})
+
+	tt := []struct {
+		name     string
+		xml      string
+		path     []string
+		expected string
+		err      error
+	}{
+		{
+			name:     "non-matching subtree is skipped",
+			xml:      `<a><b><x/><c id="1"/></b><c id="2"/></a>`,
+			path:     []string{"a", "c"},
+			expected: `<c id="2"/>`,
+		},
+		{
+			name:     "next match after a matched element ends",
+			xml:      `<a><b><x/></b><b><c id="1"/></b></a>`,
+			path:     []string{"b", "c"},
+			expected: `<c id="1"/>`,
+		},
+		{
+			name: "not a direct child",
+			xml:  `<a><b><d><c/></d></b></a>`,
+			path: []string{"b", "c"},
+			err:  xmltokenizer.ErrNotFound,
+		},
+		{
+			name: "self-closing has no children",
+			xml:  `<a><b/><c/></a>`,
+			path: []string{"b", "c"},
+			err:  xmltokenizer.ErrNotFound,
+		},
+		{
+			name:     "single element at any depth",
+			xml:      `<a><b><c>text</c></b></a>`,
+			path:     []string{"c"},
+			expected: `<c>`,
+		},
+		{
+			name: "empty path",
+			xml:  `<a/>`,
+			err:  xmltokenizer.ErrNotFound,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(tc.xml), xmltokenizer.WithReadBufferSize(1))
+			se, err := tok.Find(tc.path...)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected: %v, got: %v", tc.err, err)
+			}
+			if err == nil && se.String() != tc.expected {
+				t.Fatalf("expected: %s, got: %s", tc.expected, se)
+			}
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "hike_mt_prau.gpx"))
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	var events []string
+	tok := xmltokenizer.New(f)
+	err = tok.Walk(func(se *xmltokenizer.Token) (descend bool, err error) {
+		events = append(events, "+"+string(se.Name.Local))
+		return string(se.Name.Local) != "trkseg", nil
+	}, func(name xmltokenizer.Name) error {
+		events = append(events, "-"+string(name.Local))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"+gpx",
+		"+metadata", "+time", "-time", "-metadata",
+		"+trk", "+name", "-name", "+type", "-type", "+trkseg", "-trkseg", "-trk",
+		"-gpx",
+	}
+	if diff := cmp.Diff(events, expected); diff != "" {
+		t.Fatal(diff)
+	}
+
+	errStop := errors.New("stop")
+	tt := []struct {
+		name    string
+		xml     string
+		opts    []xmltokenizer.Option
+		stopAt  string // enter returns errStop on this element
+		after   string // Walk is invoked right after this start element
+		nilExit bool
+		events  []string
+		err     error
+	}{
+		{
+			name:   "self-closing and skipped",
+			xml:    `<?xml version="1.0"?><a><b/>text<c><d/></c><!-- c --><e x="1"></e></a>`,
+			events: []string{"+a", "+b", "-b", "+c", "-c", "+e", "-e", "-a"},
+		},
+		{
+			name:   "self-closing with synthetic end elements",
+			xml:    `<a><b/><c><d/></c><e/></a>`,
+			opts:   []xmltokenizer.Option{xmltokenizer.WithSyntheticEndElements(true)},
+			events: []string{"+a", "+b", "-b", "+c", "-c", "+e", "-e", "-a"},
+		},
+		{
+			name:    "nil exit",
+			xml:     `<a><b/><c><d/></c></a>`,
+			nilExit: true,
+			events:  []string{"+a", "+b", "+c"},
+		},
+		{
+			name:   "enter error",
+			xml:    `<a><b/><c/></a>`,
+			stopAt: "b",
+			events: []string{"+a", "+b"},
+			err:    errStop,
+		},
+		{
+			name:   "unclosed element",
+			xml:    `<a><b/>`,
+			events: []string{"+a", "+b", "-b"},
+			err:    io.ErrUnexpectedEOF,
+		},
+		{
+			name:   "truncated skipped element",
+			xml:    `<a><c><d/>`,
+			events: []string{"+a", "+c"},
+			err:    io.ErrUnexpectedEOF,
+		},
+		{
+			name:   "after the root start element",
+			xml:    `<a><b/><c><d/></c><e></e></a><!-- c -->`,
+			after:  "a",
+			events: []string{"+b", "-b", "+c", "-c", "+e", "-e"},
+		},
+		{
+			name:   "after a nested start element",
+			xml:    `<a><b><e/>text</b><e/></a>`,
+			after:  "b",
+			events: []string{"+e", "-e"},
+		},
+		{
+			name:   "truncated after the root start element",
+			xml:    `<a><b/>`,
+			after:  "a",
+			events: []string{"+b", "-b"},
+			err:    io.ErrUnexpectedEOF,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			var events []string
+			enter := func(se *xmltokenizer.Token) (descend bool, err error) {
+				events = append(events, "+"+string(se.Name.Local))
+				if string(se.Name.Local) == tc.stopAt {
+					return false, errStop
+				}
+				return string(se.Name.Local) != "c", nil
+			}
+			exit := func(name xmltokenizer.Name) error {
+				events = append(events, "-"+string(name.Local))
+				return nil
+			}
+			if tc.nilExit {
+				exit = nil
+			}
+
+			opts := append([]xmltokenizer.Option{xmltokenizer.WithReadBufferSize(1)}, tc.opts...)
+			tok := xmltokenizer.New(strings.NewReader(tc.xml), opts...)
+			for tc.after != "" {
+				token, err := tok.Token()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(token.Name.Local) == tc.after && !token.IsEndElement {
+					break
+				}
+			}
+			if err := tok.Walk(enter, exit); !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if diff := cmp.Diff(events, tc.events); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestProlog(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "prolog.xml"))
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	tok := xmltokenizer.New(f, xmltokenizer.WithReadBufferSize(8))
+	prolog, root, err := tok.Prolog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read the root's children, so the buffer is overwritten, to assert the tokens are deep copies.
+	texts, err := tok.CollectText(root, "item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(texts, [][]byte{[]byte("Tokenizer")}); diff != "" {
+		t.Fatal(diff)
+	}
+
+	var result []string
+	for i := range prolog {
+		result = append(result, prolog[i].String())
+	}
+	expected := []string{
+		`procinst(xml version="1.0" encoding="UTF-8")`,
+		`procinst(xml-stylesheet type="text/xsl" href="catalog.xsl")`,
+		"directive(DOCTYPE catalog [\n  <!ELEMENT catalog (item*)>\n  <!ELEMENT item (#PCDATA)>\n])",
+		`comment( Generated by the inventory export. )`,
+	}
+	if diff := cmp.Diff(result, expected); diff != "" {
+		t.Fatal(diff)
+	}
+	if expected := `<catalog version="2">`; root.String() != expected {
+		t.Fatalf("expected root: %s, got: %s", expected, root)
+	}
+
+	tt := []struct {
+		name   string
+		xml    string
+		prolog []string
+		root   string
+		err    error
+	}{
+		{name: "without prolog", xml: "<a><b/></a>", root: "<a>"},
+		{name: "self-closing root", xml: "<!-- c --><a/>", prolog: []string{"comment( c )"}, root: "<a/>"},
+		{name: "without root", xml: `<?xml version="1.0"?><!-- c -->`,
+			prolog: []string{`procinst(xml version="1.0")`, "comment( c )"}, err: io.ErrUnexpectedEOF},
+		{name: "truncated", xml: `<?xml version="1.0"?><a`,
+			prolog: []string{`procinst(xml version="1.0")`}, err: io.ErrUnexpectedEOF},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			prolog, root, err := xmltokenizer.New(strings.NewReader(tc.xml)).Prolog()
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			var result []string
+			for i := range prolog {
+				result = append(result, prolog[i].String())
+			}
+			if diff := cmp.Diff(result, tc.prolog); diff != "" {
+				t.Fatal(diff)
+			}
+			if (root == nil) != (tc.root == "") || (root != nil && root.String() != tc.root) {
+				t.Fatalf("expected root: %q, got: %v", tc.root, root)
+			}
+		})
+	}
+}
+
+func TestIndexIDs(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "xml_ids.xml"))
+	if err != nil {
+		panic(err)
+	}
+	offsetOf := func(tag string) int64 { return int64(bytes.Index(data, []byte(tag))) }
+
+	tt := []struct {
+		name     string
+		idAttr   string
+		opts     []xmltokenizer.Option
+		expected map[string]int64
+	}{
+		{
+			name:   "xml:id",
+			idAttr: "xml:id",
+			expected: map[string]int64{
+				"book":        offsetOf("<book"),
+				"intro":       offsetOf(`<chapter xml:id="intro"`),
+				"usage":       offsetOf(`<chapter xml:id="usage"`),
+				"usage.token": offsetOf(`<section xml:id="usage.token"`),
+				"usage.skip":  offsetOf(`<section xml:id="usage.skip"`),
+				"faq":         offsetOf("<appendix"),
+			},
+		},
+		{
+			name:   "id",
+			idAttr: "id",
+			opts:   []xmltokenizer.Option{xmltokenizer.WithLazyAttrs(true)},
+			expected: map[string]int64{
+				"c1": offsetOf(`<chapter xml:id="intro"`),
+				"c2": offsetOf(`<chapter xml:id="usage"`),
+				"a1": offsetOf("<appendix"),
+			},
+		},
+		{
+			name:     "names only",
+			idAttr:   "xml:id",
+			opts:     []xmltokenizer.Option{xmltokenizer.WithNamesOnly(true)},
+			expected: map[string]int64{},
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(bytes.NewReader(data), append(tc.opts, xmltokenizer.WithReadBufferSize(16))...)
+			ids, err := tok.IndexIDs(tc.idAttr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(ids, tc.expected); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+
+	t.Run("seek by id", func(t *testing.T) {
+		r := bytes.NewReader(data)
+		tok := xmltokenizer.New(r)
+		ids, err := tok.IndexIDs("xml:id")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = r.Seek(ids["usage"], io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		tok = xmltokenizer.New(r)
+		se, err := tok.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := `<chapter xml:id="usage" id="c2">`; se.String() != expected {
+			t.Fatalf("expected: %s, got: %s", expected, se)
+		}
+		texts, err := tok.CollectText(&se, "title")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(texts, [][]byte{[]byte("Usage")}); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader(`<a id="1"><b id="2"`))
+		ids, err := tok.IndexIDs("id")
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected error: %v, got: %v", io.ErrUnexpectedEOF, err)
+		}
+		if diff := cmp.Diff(ids, map[string]int64{"1": 0}); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestExpect(t *testing.T) {
+	const xml = `<gpx><metadata/><trk></trk></gpx>`
+
+	t.Run("match", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader(xml))
+		for _, local := range []string{"gpx", "metadata", "trk"} {
+			token, err := tok.Expect(local)
+			if err != nil {
+				t.Fatalf("%s: %v", local, err)
+			}
+			if string(token.Name.Local) != local {
+				t.Fatalf("expected: %s, got: %s", local, token.Name.Local)
+			}
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		tt := []struct {
+			expect   []string
+			expected string
+		}{
+			{expect: []string{"trk"}, expected: "byte pos 0: expected <trk>, got <gpx>: unexpected element"},
+			{expect: []string{"gpx", "metadata", "trk", "trkseg"}, expected: "byte pos 21: expected <trkseg>, got </trk>: unexpected element"},
+		}
+		for i, tc := range tt {
+			t.Run(fmt.Sprint(i), func(t *testing.T) {
+				tok := xmltokenizer.New(strings.NewReader(xml))
+				var err error
+				for _, local := range tc.expect {
+					if _, err = tok.Expect(local); err != nil {
+						break
+					}
+				}
+				if !errors.Is(err, xmltokenizer.ErrUnexpectedElement) {
+					t.Fatalf("expected: %v, got: %v", xmltokenizer.ErrUnexpectedElement, err)
+				}
+				if err.Error() != tc.expected {
+					t.Fatalf("expected: %q, got: %q", tc.expected, err.Error())
+				}
+			})
+		}
+	})
+
+	t.Run("synthetic end element", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader(`<r><a  /></r>`), xmltokenizer.WithSyntheticEndElements(true))
+		var err error
+		for _, local := range []string{"r", "a", "b"} {
+			if _, err = tok.Expect(local); err != nil {
+				break
+			}
+		}
+		const expected = "byte pos 7: expected <b>, got </a>: unexpected element"
+		if err == nil || err.Error() != expected {
+			t.Fatalf("expected: %q, got: %v", expected, err)
+		}
+	})
+
+	t.Run("EOF", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader(`<gpx/>`))
+		if _, err := tok.Expect("gpx"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tok.Expect("trk"); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected: %v, got: %v", io.ErrUnexpectedEOF, err)
+		}
+	})
+}
+
+func TestReadEmpty(t *testing.T) {
+	tt := []struct {
+		name     string
+		xml      string
+		opts     []xmltokenizer.Option
+		expected string // the returned token
+		next     string // the token following ReadEmpty
+		err      error
+	}{
+		{name: "self-closing", xml: `<true/><next/>`, expected: "<true/>", next: "<next/>"},
+		{name: "start and end", xml: `<true a="1"></true><next/>`, expected: `<true a="1">`, next: "<next/>"},
+		{name: "whitespace only", xml: "<true>\n  </true><next/>", expected: "<true>", next: "<next/>"},
+		{
+			name:     "synthetic end element",
+			xml:      `<true/><next/>`,
+			opts:     []xmltokenizer.Option{xmltokenizer.WithSyntheticEndElements(true)},
+			expected: "<true/>",
+			next:     "<next/>",
+		},
+		{name: "chardata", xml: `<true>yes</true>`, expected: "<true>", next: "</true>", err: xmltokenizer.ErrNotEmpty},
+		{name: "child", xml: `<true><b/></true>`, expected: "<true>", next: "<b/>", err: xmltokenizer.ErrNotEmpty},
+		{name: "comment", xml: `<true><!-- c --></true>`, expected: "<true>", next: "comment( c )", err: xmltokenizer.ErrNotEmpty},
+		{name: "unexpected name", xml: `<false/>`, expected: "<false/>", err: xmltokenizer.ErrUnexpectedElement},
+		{name: "end element", xml: `</true>`, expected: "</true>", err: xmltokenizer.ErrUnexpectedElement},
+		{name: "truncated", xml: `<true>`, expected: "<true>", err: io.ErrUnexpectedEOF},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(tc.xml), append(tc.opts, xmltokenizer.WithReadBufferSize(1))...)
+			token, err := tok.ReadEmpty("true")
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if token.String() != tc.expected {
+				t.Fatalf("expected: %s, got: %s", tc.expected, token)
+			}
+			if tc.next == "" {
+				return
+			}
+			next, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next.String() != tc.next {
+				t.Fatalf("expected next: %s, got: %s", tc.next, next)
+			}
+		})
+	}
+}
+
+func TestReadUntil(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "records.xml"))
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	tok := xmltokenizer.New(f, xmltokenizer.WithReadBufferSize(1))
+
+	tt := []struct {
+		expected string
+		id       string
+		err      error
+	}{
+		{expected: `<?xml version="1.0" encoding="UTF-8"?>` + "\n<log>\n  ", id: "1"},
+		{expected: "<level>INFO</level><msg>started</msg></record>\n  ", id: "2"},
+		{expected: "<level>WARN</level><msg>disk &gt; 90%</msg></record>\n  ", id: "3"},
+		{expected: "<level>INFO</level><msg>stopped</msg></record>\n</log>\n", err: io.EOF},
+	}
+
+	for i, tc := range tt {
+		b, se, err := tok.ReadUntil("record")
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("[%d] expected error: %v, got: %v", i, tc.err, err)
+		}
+		if string(b) != tc.expected {
+			t.Fatalf("[%d] expected: %q, got: %q", i, tc.expected, b)
+		}
+		if tc.err != nil {
+			if se != nil {
+				t.Fatalf("[%d] expected nil token, got: %v", i, se)
+			}
+			continue
+		}
+		if id := string(se.AttrValue("id")); id != tc.id {
+			t.Fatalf("[%d] expected id: %s, got: %s", i, tc.id, id)
+		}
+	}
+
+	t.Run("byte for byte", func(t *testing.T) {
+		const xml = "<?xml version=\"1.0\"?>\r\n<!-- c -->\n\t<log><record/> <!-- x -->\n<record>a</record><!-- end -->\n\n</log> <!-- trailing -->\n"
+
+		for _, size := range []int{1, 4096} {
+			tok := xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithReadBufferSize(size))
+			for i, expected := range []string{
+				"<?xml version=\"1.0\"?>\r\n<!-- c -->\n\t<log>",
+				"<!-- x -->\n", // The preceding " " is the Data of <record/>.
+				"</record><!-- end -->\n\n</log> <!-- trailing -->\n",
+			} {
+				b, _, err := tok.ReadUntil("record")
+				if err != nil && !(i == 2 && err == io.EOF) {
+					t.Fatalf("[%d][%d] %v", size, i, err)
+				}
+				if string(b) != expected {
+					t.Fatalf("[%d][%d] expected: %q, got: %q", size, i, expected, b)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,387 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/muktihari/xmltokenizer"
+)
+
+// Plist is Apple's property list schema.
+type Plist struct {
+	Version string `xml:"version,attr"`
+	Root    Value
+}
+
+func (p *Plist) UnmarshalToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	if attr, ok := se.Attr("version"); ok {
+		p.Version = string(attr.Value)
+	}
+	if se.SelfClosing {
+		return nil
+	}
+
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			return fmt.Errorf("plist: %w", err)
+		}
+
+		if token.IsEndElementOf(se) {
+			return nil
+		}
+		if token.IsEndElement || len(token.Name.Full) == 0 {
+			continue
+		}
+
+		se := xmltokenizer.GetToken().Copy(token)
+		err = p.Root.UnmarshalToken(tok, se)
+		xmltokenizer.PutToken(se)
+		if err != nil {
+			return fmt.Errorf("plist: %w", err)
+		}
+	}
+}
+
+func (p *Plist) UnmarshalXML(dec *xml.Decoder, se xml.StartElement) error {
+	for _, attr := range se.Attr {
+		if attr.Name.Local == "version" {
+			p.Version = attr.Value
+		}
+	}
+
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("plist: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			if err = p.Root.UnmarshalXML(dec, elem); err != nil {
+				return fmt.Errorf("plist: %w", err)
+			}
+		case xml.EndElement:
+			if elem == se.End() {
+				return nil
+			}
+		}
+	}
+}
+
+func (p Plist) MarshalXML(enc *xml.Encoder, se xml.StartElement) error {
+	se = xml.StartElement{Name: xml.Name{Local: "plist"}}
+	if p.Version != "" {
+		se.Attr = []xml.Attr{{Name: xml.Name{Local: "version"}, Value: p.Version}}
+	}
+	if err := enc.EncodeToken(se); err != nil {
+		return err
+	}
+	if p.Root.Kind != "" {
+		if err := enc.Encode(p.Root); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(se.End())
+}
+
+// Kind is the kind of a Value, named after its element, except KindBool which is <true/> or <false/>.
+type Kind string
+
+const (
+	KindString  Kind = "string"
+	KindInteger Kind = "integer"
+	KindReal    Kind = "real"
+	KindBool    Kind = "bool"
+	KindDate    Kind = "date"
+	KindData    Kind = "data"
+	KindArray   Kind = "array"
+	KindDict    Kind = "dict"
+)
+
+// Value is a property list value, only the field of its Kind is set.
+type Value struct {
+	Kind    Kind
+	String  string
+	Integer int64
+	Real    float64
+	Bool    bool
+	Date    time.Time
+	Data    []byte
+	Array   []Value
+	Dict    []Entry // Dict is in the document's order, the sibling <key> and value elements are paired.
+}
+
+// Entry is a Dict's entry.
+type Entry struct {
+	Key   string
+	Value Value
+}
+
+func (v *Value) UnmarshalToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	switch string(se.Name.Local) {
+	case "array":
+		v.Kind = KindArray
+		return v.unmarshalArrayToken(tok, se)
+	case "dict":
+		v.Kind = KindDict
+		return v.unmarshalDictToken(tok, se)
+	}
+
+	var text []byte
+	if !se.SelfClosing { // e.g. <true/> has no Data
+		text = se.Data
+	}
+	if err := v.setScalar(string(se.Name.Local), text); err != nil {
+		return err
+	}
+	return tok.Skip(se)
+}
+
+func (v *Value) unmarshalArrayToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	if se.SelfClosing {
+		return nil
+	}
+
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			return fmt.Errorf("array: %w", err)
+		}
+
+		if token.IsEndElementOf(se) {
+			return nil
+		}
+		if token.IsEndElement || len(token.Name.Full) == 0 {
+			continue
+		}
+
+		var elem Value
+		se := xmltokenizer.GetToken().Copy(token)
+		err = elem.UnmarshalToken(tok, se)
+		xmltokenizer.PutToken(se)
+		if err != nil {
+			return fmt.Errorf("array[%d]: %w", len(v.Array), err)
+		}
+		v.Array = append(v.Array, elem)
+	}
+}
+
+func (v *Value) unmarshalDictToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	if se.SelfClosing {
+		return nil
+	}
+
+	var key string
+	var hasKey bool
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			return fmt.Errorf("dict: %w", err)
+		}
+
+		if token.IsEndElementOf(se) {
+			if hasKey {
+				return fmt.Errorf("dict: key %q has no value", key)
+			}
+			return nil
+		}
+		if token.IsEndElement || len(token.Name.Full) == 0 {
+			continue
+		}
+
+		if string(token.Name.Local) == "key" {
+			if hasKey {
+				return fmt.Errorf("dict: key %q has no value", key)
+			}
+			key, hasKey = "", true
+			if !token.SelfClosing {
+				key = string(token.Data)
+			}
+			if err = tok.Skip(&token); err != nil {
+				return fmt.Errorf("dict: %w", err)
+			}
+			continue
+		}
+		if !hasKey {
+			return fmt.Errorf("dict: <%s> has no key", token.Name.Local)
+		}
+
+		var value Value
+		se := xmltokenizer.GetToken().Copy(token)
+		err = value.UnmarshalToken(tok, se)
+		xmltokenizer.PutToken(se)
+		if err != nil {
+			return fmt.Errorf("dict[%q]: %w", key, err)
+		}
+		v.Dict = append(v.Dict, Entry{Key: key, Value: value})
+		hasKey = false
+	}
+}
+
+func (v *Value) UnmarshalXML(dec *xml.Decoder, se xml.StartElement) error {
+	switch se.Name.Local {
+	case "array":
+		v.Kind = KindArray
+		return v.unmarshalArrayXML(dec, se)
+	case "dict":
+		v.Kind = KindDict
+		return v.unmarshalDictXML(dec, se)
+	}
+
+	var text string
+	if err := dec.DecodeElement(&text, &se); err != nil {
+		return fmt.Errorf("%s: %w", se.Name.Local, err)
+	}
+	return v.setScalar(se.Name.Local, []byte(text))
+}
+
+func (v *Value) unmarshalArrayXML(dec *xml.Decoder, se xml.StartElement) error {
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("array: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			var value Value
+			if err = value.UnmarshalXML(dec, elem); err != nil {
+				return fmt.Errorf("array[%d]: %w", len(v.Array), err)
+			}
+			v.Array = append(v.Array, value)
+		case xml.EndElement:
+			if elem == se.End() {
+				return nil
+			}
+		}
+	}
+}
+
+func (v *Value) unmarshalDictXML(dec *xml.Decoder, se xml.StartElement) error {
+	var key string
+	var hasKey bool
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("dict: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			if elem.Name.Local == "key" {
+				if hasKey {
+					return fmt.Errorf("dict: key %q has no value", key)
+				}
+				if err = dec.DecodeElement(&key, &elem); err != nil {
+					return fmt.Errorf("dict: %w", err)
+				}
+				hasKey = true
+				continue
+			}
+			if !hasKey {
+				return fmt.Errorf("dict: <%s> has no key", elem.Name.Local)
+			}
+			var value Value
+			if err = value.UnmarshalXML(dec, elem); err != nil {
+				return fmt.Errorf("dict[%q]: %w", key, err)
+			}
+			v.Dict = append(v.Dict, Entry{Key: key, Value: value})
+			key, hasKey = "", false
+		case xml.EndElement:
+			if elem == se.End() {
+				if hasKey {
+					return fmt.Errorf("dict: key %q has no value", key)
+				}
+				return nil
+			}
+		}
+	}
+}
+
+// setScalar sets v from the text of the scalar element of the given name.
+func (v *Value) setScalar(name string, text []byte) error {
+	var err error
+	switch name {
+	case "string":
+		v.Kind, v.String = KindString, string(text)
+	case "integer":
+		v.Kind = KindInteger
+		v.Integer, err = strconv.ParseInt(strings.TrimSpace(string(text)), 10, 64)
+	case "real":
+		v.Kind = KindReal
+		v.Real, err = strconv.ParseFloat(strings.TrimSpace(string(text)), 64)
+	case "true", "false":
+		v.Kind, v.Bool = KindBool, name == "true"
+	case "date":
+		v.Kind = KindDate
+		v.Date, err = time.Parse(time.RFC3339, strings.TrimSpace(string(text)))
+	case "data":
+		v.Kind = KindData
+		v.Data, err = base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(text), nil)))
+		if len(v.Data) == 0 {
+			v.Data = nil
+		}
+	default:
+		return fmt.Errorf("unknown element <%s>", name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func (v Value) MarshalXML(enc *xml.Encoder, se xml.StartElement) error {
+	se = xml.StartElement{Name: xml.Name{Local: string(v.Kind)}}
+	var text string
+	switch v.Kind {
+	case KindArray:
+		if err := enc.EncodeToken(se); err != nil {
+			return err
+		}
+		for i := range v.Array {
+			if err := enc.Encode(v.Array[i]); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(se.End())
+	case KindDict:
+		if err := enc.EncodeToken(se); err != nil {
+			return err
+		}
+		for i := range v.Dict {
+			key := xml.StartElement{Name: xml.Name{Local: "key"}}
+			if err := enc.EncodeElement(v.Dict[i].Key, key); err != nil {
+				return err
+			}
+			if err := enc.Encode(v.Dict[i].Value); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(se.End())
+	case KindBool:
+		se.Name.Local = strconv.FormatBool(v.Bool)
+		if err := enc.EncodeToken(se); err != nil {
+			return err
+		}
+		return enc.EncodeToken(se.End())
+	case KindString:
+		text = v.String
+	case KindInteger:
+		text = strconv.FormatInt(v.Integer, 10)
+	case KindReal:
+		text = strconv.FormatFloat(v.Real, 'g', -1, 64)
+	case KindDate:
+		text = v.Date.UTC().Format(time.RFC3339)
+	case KindData:
+		text = base64.StdEncoding.EncodeToString(v.Data)
+	default:
+		return fmt.Errorf("unknown kind %q", v.Kind)
+	}
+	return enc.EncodeElement(text, se)
+}
@@ -0,0 +1,70 @@
+package plist
+
+import (
+	"encoding/xml"
+	"io"
+
+	"github.com/muktihari/xmltokenizer"
+	"github.com/muktihari/xmltokenizer/internal/plist/schema"
+)
+
+func UnmarshalWithXMLTokenizer(r io.Reader) (schema.Plist, error) {
+	// A <string>'s whitespace is significant and its entities must be decoded, like encoding/xml does.
+	tok := xmltokenizer.New(r,
+		xmltokenizer.WithTrimMode(xmltokenizer.TrimNone),
+		xmltokenizer.WithEntityDecoding(true),
+	)
+	var plist schema.Plist
+loop:
+	for {
+		token, err := tok.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return plist, err
+		}
+
+		switch string(token.Name.Local) {
+		case "plist":
+			se := xmltokenizer.GetToken().Copy(token)
+			err = plist.UnmarshalToken(tok, se)
+			xmltokenizer.PutToken(se)
+			if err != nil {
+				return plist, err
+			}
+			break loop
+		}
+	}
+
+	return plist, nil
+}
+
+func UnmarshalWithStdlibXML(r io.Reader) (schema.Plist, error) {
+	dec := xml.NewDecoder(r)
+	var plist schema.Plist
+loop:
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return plist, err
+		}
+
+		se, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "plist":
+			if err = plist.UnmarshalXML(dec, se); err != nil {
+				return plist, err
+			}
+			break loop
+		}
+	}
+
+	return plist, nil
+}
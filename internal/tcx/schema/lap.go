@@ -0,0 +1,509 @@
+package schema
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/muktihari/xmltokenizer"
+)
+
+type Lap struct {
+	StartTime        time.Time `xml:"StartTime,attr"`
+	TotalTimeSeconds float64   `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64   `xml:"DistanceMeters"`
+	Calories         uint16    `xml:"Calories"`
+	Intensity        string    `xml:"Intensity"`
+	TriggerMethod    string    `xml:"TriggerMethod"`
+	Tracks           []Track   `xml:"Track,omitempty"`
+}
+
+func (l *Lap) UnmarshalToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	var err error
+	for i := range se.Attrs {
+		attr := &se.Attrs[i]
+		switch string(attr.Name.Local) {
+		case "StartTime":
+			l.StartTime, err = time.Parse(time.RFC3339, string(attr.Value))
+			if err != nil {
+				return fmt.Errorf("startTime: %w", err)
+			}
+		}
+	}
+
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			return fmt.Errorf("lap: %w", err)
+		}
+
+		if token.IsEndElementOf(se) {
+			return nil
+		}
+		if token.IsEndElement {
+			continue
+		}
+
+		switch string(token.Name.Local) {
+		case "Track":
+			var track Track
+			se := xmltokenizer.GetToken().Copy(token)
+			err = track.UnmarshalToken(tok, se)
+			xmltokenizer.PutToken(se)
+			if err != nil {
+				return fmt.Errorf("track: %w", err)
+			}
+			l.Tracks = append(l.Tracks, track)
+		default:
+			if err = l.setValue(string(token.Name.Local), token.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (l *Lap) UnmarshalXML(dec *xml.Decoder, se xml.StartElement) error {
+	var err error
+	for i := range se.Attr {
+		attr := &se.Attr[i]
+		switch attr.Name.Local {
+		case "StartTime":
+			l.StartTime, err = time.Parse(time.RFC3339, attr.Value)
+			if err != nil {
+				return fmt.Errorf("startTime: %w", err)
+			}
+		}
+	}
+
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("lap: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			switch elem.Name.Local {
+			case "Track":
+				var track Track
+				if err := track.UnmarshalXML(dec, elem); err != nil {
+					return fmt.Errorf("track: %w", err)
+				}
+				l.Tracks = append(l.Tracks, track)
+				continue
+			}
+			charData, err := getCharData(dec)
+			if err != nil {
+				return fmt.Errorf("%s: %w", elem.Name.Local, err)
+			}
+			if err = l.setValue(elem.Name.Local, charData); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if elem == se.End() {
+				return nil
+			}
+		}
+	}
+}
+
+func (l *Lap) setValue(local string, data []byte) (err error) {
+	switch local {
+	case "TotalTimeSeconds":
+		l.TotalTimeSeconds, err = strconv.ParseFloat(string(data), 64)
+		if err != nil {
+			return fmt.Errorf("totalTimeSeconds: %w", err)
+		}
+	case "DistanceMeters":
+		l.DistanceMeters, err = strconv.ParseFloat(string(data), 64)
+		if err != nil {
+			return fmt.Errorf("distanceMeters: %w", err)
+		}
+	case "Calories":
+		v, err := strconv.ParseUint(string(data), 10, 16)
+		if err != nil {
+			return fmt.Errorf("calories: %w", err)
+		}
+		l.Calories = uint16(v)
+	case "Intensity":
+		l.Intensity = string(data)
+	case "TriggerMethod":
+		l.TriggerMethod = string(data)
+	}
+	return nil
+}
+
+type Track struct {
+	Trackpoints []Trackpoint `xml:"Trackpoint,omitempty"`
+}
+
+func (t *Track) UnmarshalToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			return fmt.Errorf("track: %w", err)
+		}
+
+		if token.IsEndElementOf(se) {
+			return nil
+		}
+		if token.IsEndElement {
+			continue
+		}
+
+		switch string(token.Name.Local) {
+		case "Trackpoint":
+			var trackpoint Trackpoint
+			se := xmltokenizer.GetToken().Copy(token)
+			err = trackpoint.UnmarshalToken(tok, se)
+			xmltokenizer.PutToken(se)
+			if err != nil {
+				return fmt.Errorf("trackpoint: %w", err)
+			}
+			t.Trackpoints = append(t.Trackpoints, trackpoint)
+		}
+	}
+}
+
+func (t *Track) UnmarshalXML(dec *xml.Decoder, se xml.StartElement) error {
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("track: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			switch elem.Name.Local {
+			case "Trackpoint":
+				var trackpoint Trackpoint
+				if err := trackpoint.UnmarshalXML(dec, elem); err != nil {
+					return fmt.Errorf("trackpoint: %w", err)
+				}
+				t.Trackpoints = append(t.Trackpoints, trackpoint)
+			}
+		case xml.EndElement:
+			if elem == se.End() {
+				return nil
+			}
+		}
+	}
+}
+
+type Trackpoint struct {
+	Time           time.Time           `xml:"Time"`
+	Position       Position            `xml:"Position,omitempty"`
+	AltitudeMeters float64             `xml:"AltitudeMeters,omitempty"`
+	DistanceMeters float64             `xml:"DistanceMeters,omitempty"`
+	HeartRateBpm   HeartRateBpm        `xml:"HeartRateBpm,omitempty"`
+	Cadence        uint8               `xml:"Cadence,omitempty"`
+	Extensions     TrackpointExtension `xml:"Extensions>TPX,omitempty"`
+}
+
+func (t *Trackpoint) UnmarshalToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			return fmt.Errorf("trackpoint: %w", err)
+		}
+
+		if token.IsEndElementOf(se) {
+			return nil
+		}
+		if token.IsEndElement {
+			continue
+		}
+
+		switch string(token.Name.Local) {
+		case "Position":
+			se := xmltokenizer.GetToken().Copy(token)
+			err = t.Position.UnmarshalToken(tok, se)
+			xmltokenizer.PutToken(se)
+			if err != nil {
+				return fmt.Errorf("position: %w", err)
+			}
+		case "HeartRateBpm":
+			se := xmltokenizer.GetToken().Copy(token)
+			err = t.HeartRateBpm.UnmarshalToken(tok, se)
+			xmltokenizer.PutToken(se)
+			if err != nil {
+				return fmt.Errorf("heartRateBpm: %w", err)
+			}
+		case "Extensions":
+			se := xmltokenizer.GetToken().Copy(token)
+			err = t.Extensions.UnmarshalToken(tok, se)
+			xmltokenizer.PutToken(se)
+			if err != nil {
+				return fmt.Errorf("extensions: %w", err)
+			}
+		default:
+			if err = t.setValue(string(token.Name.Local), token.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (t *Trackpoint) UnmarshalXML(dec *xml.Decoder, se xml.StartElement) error {
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("trackpoint: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			switch elem.Name.Local {
+			case "Position":
+				if err := t.Position.UnmarshalXML(dec, elem); err != nil {
+					return fmt.Errorf("position: %w", err)
+				}
+				continue
+			case "HeartRateBpm":
+				if err := t.HeartRateBpm.UnmarshalXML(dec, elem); err != nil {
+					return fmt.Errorf("heartRateBpm: %w", err)
+				}
+				continue
+			case "Extensions":
+				if err := t.Extensions.UnmarshalXML(dec, elem); err != nil {
+					return fmt.Errorf("extensions: %w", err)
+				}
+				continue
+			}
+			charData, err := getCharData(dec)
+			if err != nil {
+				return fmt.Errorf("%s: %w", elem.Name.Local, err)
+			}
+			if err = t.setValue(elem.Name.Local, charData); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if elem == se.End() {
+				return nil
+			}
+		}
+	}
+}
+
+func (t *Trackpoint) setValue(local string, data []byte) (err error) {
+	switch local {
+	case "Time":
+		t.Time, err = time.Parse(time.RFC3339, string(data))
+		if err != nil {
+			return fmt.Errorf("time: %w", err)
+		}
+	case "AltitudeMeters":
+		t.AltitudeMeters, err = strconv.ParseFloat(string(data), 64)
+		if err != nil {
+			return fmt.Errorf("altitudeMeters: %w", err)
+		}
+	case "DistanceMeters":
+		t.DistanceMeters, err = strconv.ParseFloat(string(data), 64)
+		if err != nil {
+			return fmt.Errorf("distanceMeters: %w", err)
+		}
+	case "Cadence":
+		v, err := strconv.ParseUint(string(data), 10, 8)
+		if err != nil {
+			return fmt.Errorf("cadence: %w", err)
+		}
+		t.Cadence = uint8(v)
+	}
+	return nil
+}
+
+type Position struct {
+	LatitudeDegrees  float64 `xml:"LatitudeDegrees"`
+	LongitudeDegrees float64 `xml:"LongitudeDegrees"`
+}
+
+func (p *Position) UnmarshalToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			return fmt.Errorf("position: %w", err)
+		}
+
+		if token.IsEndElementOf(se) {
+			return nil
+		}
+		if token.IsEndElement {
+			continue
+		}
+
+		if err = p.setValue(string(token.Name.Local), token.Data); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *Position) UnmarshalXML(dec *xml.Decoder, se xml.StartElement) error {
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("position: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			charData, err := getCharData(dec)
+			if err != nil {
+				return fmt.Errorf("%s: %w", elem.Name.Local, err)
+			}
+			if err = p.setValue(elem.Name.Local, charData); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if elem == se.End() {
+				return nil
+			}
+		}
+	}
+}
+
+func (p *Position) setValue(local string, data []byte) (err error) {
+	switch local {
+	case "LatitudeDegrees":
+		p.LatitudeDegrees, err = strconv.ParseFloat(string(data), 64)
+		if err != nil {
+			return fmt.Errorf("latitudeDegrees: %w", err)
+		}
+	case "LongitudeDegrees":
+		p.LongitudeDegrees, err = strconv.ParseFloat(string(data), 64)
+		if err != nil {
+			return fmt.Errorf("longitudeDegrees: %w", err)
+		}
+	}
+	return nil
+}
+
+type HeartRateBpm struct {
+	Value uint8 `xml:"Value"`
+}
+
+func (h *HeartRateBpm) UnmarshalToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			return fmt.Errorf("heartRateBpm: %w", err)
+		}
+
+		if token.IsEndElementOf(se) {
+			return nil
+		}
+		if token.IsEndElement {
+			continue
+		}
+
+		if err = h.setValue(string(token.Name.Local), token.Data); err != nil {
+			return err
+		}
+	}
+}
+
+func (h *HeartRateBpm) UnmarshalXML(dec *xml.Decoder, se xml.StartElement) error {
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("heartRateBpm: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			charData, err := getCharData(dec)
+			if err != nil {
+				return fmt.Errorf("%s: %w", elem.Name.Local, err)
+			}
+			if err = h.setValue(elem.Name.Local, charData); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if elem == se.End() {
+				return nil
+			}
+		}
+	}
+}
+
+func (h *HeartRateBpm) setValue(local string, data []byte) error {
+	switch local {
+	case "Value":
+		v, err := strconv.ParseUint(string(data), 10, 8)
+		if err != nil {
+			return fmt.Errorf("value: %w", err)
+		}
+		h.Value = uint8(v)
+	}
+	return nil
+}
+
+// TrackpointExtension is Garmin's ActivityExtension v2 TPX schema (simplified).
+type TrackpointExtension struct {
+	Speed float64 `xml:"Speed,omitempty"`
+	Watts uint16  `xml:"Watts,omitempty"`
+}
+
+func (t *TrackpointExtension) UnmarshalToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			return fmt.Errorf("trackpointExtension: %w", err)
+		}
+
+		if token.IsEndElementOf(se) {
+			return nil
+		}
+		if token.IsEndElement {
+			continue
+		}
+
+		if err = t.setValue(string(token.Name.Local), token.Data); err != nil {
+			return err
+		}
+	}
+}
+
+func (t *TrackpointExtension) UnmarshalXML(dec *xml.Decoder, se xml.StartElement) error {
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("trackpointExtension: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			if elem.Name.Local == "TPX" {
+				continue // Flatten TPX's children.
+			}
+			charData, err := getCharData(dec)
+			if err != nil {
+				return fmt.Errorf("%s: %w", elem.Name.Local, err)
+			}
+			if err = t.setValue(elem.Name.Local, charData); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if elem == se.End() {
+				return nil
+			}
+		}
+	}
+}
+
+func (t *TrackpointExtension) setValue(local string, data []byte) (err error) {
+	switch local {
+	case "Speed":
+		t.Speed, err = strconv.ParseFloat(string(data), 64)
+		if err != nil {
+			return fmt.Errorf("speed: %w", err)
+		}
+	case "Watts":
+		v, err := strconv.ParseUint(string(data), 10, 16)
+		if err != nil {
+			return fmt.Errorf("watts: %w", err)
+		}
+		t.Watts = uint16(v)
+	}
+	return nil
+}
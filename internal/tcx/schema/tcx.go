@@ -0,0 +1,277 @@
+package schema
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/muktihari/xmltokenizer"
+)
+
+// TCX is Training Center Database schema (simplified).
+type TCX struct {
+	Activities []Activity `xml:"Activities>Activity,omitempty"`
+}
+
+func (t *TCX) UnmarshalToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			return fmt.Errorf("tcx: %w", err)
+		}
+
+		if token.IsEndElementOf(se) {
+			return nil
+		}
+		if token.IsEndElement {
+			continue
+		}
+
+		switch string(token.Name.Local) {
+		case "Activity":
+			var activity Activity
+			se := xmltokenizer.GetToken().Copy(token)
+			err = activity.UnmarshalToken(tok, se)
+			xmltokenizer.PutToken(se)
+			if err != nil {
+				return fmt.Errorf("activity: %w", err)
+			}
+			t.Activities = append(t.Activities, activity)
+		}
+	}
+}
+
+func (t *TCX) UnmarshalXML(dec *xml.Decoder, se xml.StartElement) error {
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("tcx: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			switch elem.Name.Local {
+			case "Activity":
+				var activity Activity
+				if err := activity.UnmarshalXML(dec, elem); err != nil {
+					return fmt.Errorf("activity: %w", err)
+				}
+				t.Activities = append(t.Activities, activity)
+			}
+		case xml.EndElement:
+			if elem == se.End() {
+				return nil
+			}
+		}
+	}
+}
+
+type Activity struct {
+	Sport   string    `xml:"Sport,attr"`
+	ID      time.Time `xml:"Id"`
+	Laps    []Lap     `xml:"Lap,omitempty"`
+	Creator Creator   `xml:"Creator,omitempty"`
+}
+
+func (a *Activity) UnmarshalToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	for i := range se.Attrs {
+		attr := &se.Attrs[i]
+		switch string(attr.Name.Local) {
+		case "Sport":
+			a.Sport = string(attr.Value)
+		}
+	}
+
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			return fmt.Errorf("activity: %w", err)
+		}
+
+		if token.IsEndElementOf(se) {
+			return nil
+		}
+		if token.IsEndElement {
+			continue
+		}
+
+		switch string(token.Name.Local) {
+		case "Id":
+			a.ID, err = time.Parse(time.RFC3339, string(token.Data))
+			if err != nil {
+				return fmt.Errorf("id: %w", err)
+			}
+		case "Lap":
+			var lap Lap
+			se := xmltokenizer.GetToken().Copy(token)
+			err = lap.UnmarshalToken(tok, se)
+			xmltokenizer.PutToken(se)
+			if err != nil {
+				return fmt.Errorf("lap: %w", err)
+			}
+			a.Laps = append(a.Laps, lap)
+		case "Creator":
+			se := xmltokenizer.GetToken().Copy(token)
+			err = a.Creator.UnmarshalToken(tok, se)
+			xmltokenizer.PutToken(se)
+			if err != nil {
+				return fmt.Errorf("creator: %w", err)
+			}
+		}
+	}
+}
+
+func (a *Activity) UnmarshalXML(dec *xml.Decoder, se xml.StartElement) error {
+	for i := range se.Attr {
+		attr := &se.Attr[i]
+		switch attr.Name.Local {
+		case "Sport":
+			a.Sport = attr.Value
+		}
+	}
+
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("activity: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			switch elem.Name.Local {
+			case "Lap":
+				var lap Lap
+				if err := lap.UnmarshalXML(dec, elem); err != nil {
+					return fmt.Errorf("lap: %w", err)
+				}
+				a.Laps = append(a.Laps, lap)
+				continue
+			case "Creator":
+				if err := a.Creator.UnmarshalXML(dec, elem); err != nil {
+					return fmt.Errorf("creator: %w", err)
+				}
+				continue
+			}
+			charData, err := getCharData(dec)
+			if err != nil {
+				return fmt.Errorf("%s: %w", elem.Name.Local, err)
+			}
+			switch elem.Name.Local {
+			case "Id":
+				a.ID, err = time.Parse(time.RFC3339, string(charData))
+				if err != nil {
+					return fmt.Errorf("id: %w", err)
+				}
+			}
+		case xml.EndElement:
+			if elem == se.End() {
+				return nil
+			}
+		}
+	}
+}
+
+type Creator struct {
+	Type         string `xml:"type,attr"`
+	Name         string `xml:"Name"`
+	UnitID       uint32 `xml:"UnitId"`
+	ProductID    uint16 `xml:"ProductID"`
+	VersionMajor uint16 `xml:"Version>VersionMajor"`
+	VersionMinor uint16 `xml:"Version>VersionMinor"`
+}
+
+func (c *Creator) UnmarshalToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	for i := range se.Attrs {
+		attr := &se.Attrs[i]
+		switch string(attr.Name.Local) {
+		case "type":
+			c.Type = string(attr.Value)
+		}
+	}
+
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			return fmt.Errorf("creator: %w", err)
+		}
+
+		if token.IsEndElementOf(se) {
+			return nil
+		}
+		if token.IsEndElement {
+			continue
+		}
+
+		if err = c.setValue(string(token.Name.Local), token.Data); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Creator) UnmarshalXML(dec *xml.Decoder, se xml.StartElement) error {
+	for i := range se.Attr {
+		attr := &se.Attr[i]
+		switch attr.Name.Local {
+		case "type":
+			c.Type = attr.Value
+		}
+	}
+
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("creator: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			if elem.Name.Local == "Version" {
+				continue // Flatten Version's children.
+			}
+			charData, err := getCharData(dec)
+			if err != nil {
+				return fmt.Errorf("%s: %w", elem.Name.Local, err)
+			}
+			if err = c.setValue(elem.Name.Local, charData); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if elem == se.End() {
+				return nil
+			}
+		}
+	}
+}
+
+func (c *Creator) setValue(local string, data []byte) error {
+	switch local {
+	case "Name":
+		c.Name = string(data)
+	case "UnitId":
+		v, err := strconv.ParseUint(string(data), 10, 32)
+		if err != nil {
+			return fmt.Errorf("unitId: %w", err)
+		}
+		c.UnitID = uint32(v)
+	case "ProductID":
+		v, err := strconv.ParseUint(string(data), 10, 16)
+		if err != nil {
+			return fmt.Errorf("productID: %w", err)
+		}
+		c.ProductID = uint16(v)
+	case "VersionMajor":
+		v, err := strconv.ParseUint(string(data), 10, 16)
+		if err != nil {
+			return fmt.Errorf("versionMajor: %w", err)
+		}
+		c.VersionMajor = uint16(v)
+	case "VersionMinor":
+		v, err := strconv.ParseUint(string(data), 10, 16)
+		if err != nil {
+			return fmt.Errorf("versionMinor: %w", err)
+		}
+		c.VersionMinor = uint16(v)
+	}
+	return nil
+}
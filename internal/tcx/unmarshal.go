@@ -0,0 +1,66 @@
+package tcx
+
+import (
+	"encoding/xml"
+	"io"
+
+	"github.com/muktihari/xmltokenizer"
+	"github.com/muktihari/xmltokenizer/internal/tcx/schema"
+)
+
+func UnmarshalWithXMLTokenizer(f io.Reader) (schema.TCX, error) {
+	tok := xmltokenizer.New(f)
+	var tcx schema.TCX
+loop:
+	for {
+		token, err := tok.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return tcx, err
+		}
+
+		switch string(token.Name.Local) {
+		case "TrainingCenterDatabase":
+			se := xmltokenizer.GetToken().Copy(token)
+			err = tcx.UnmarshalToken(tok, se)
+			xmltokenizer.PutToken(se)
+			if err != nil {
+				return tcx, err
+			}
+			break loop
+		}
+	}
+
+	return tcx, nil
+}
+
+func UnmarshalWithStdlibXML(f io.Reader) (schema.TCX, error) {
+	dec := xml.NewDecoder(f)
+	var tcx schema.TCX
+loop:
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return tcx, err
+		}
+
+		se, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "TrainingCenterDatabase":
+			if err = tcx.UnmarshalXML(dec, se); err != nil {
+				return tcx, err
+			}
+			break loop
+		}
+	}
+
+	return tcx, nil
+}
@@ -12,6 +12,11 @@ type SheetData struct {
 }
 
 func (s *SheetData) UnmarshalToken(tok *xmltokenizer.Tokenizer, se *xmltokenizer.Token) error {
+	// Must check since a sheet may be empty: <sheetData/>
+	if se.SelfClosing {
+		return nil
+	}
+
 	for {
 		token, err := tok.Token()
 		if err != nil {
@@ -11,29 +11,10 @@ import (
 func UnmarshalWithXMLTokenizer(r io.Reader) (schema.SheetData, error) {
 	tok := xmltokenizer.New(r)
 	var sheetData schema.SheetData
-loop:
-	for {
-		token, err := tok.Token()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return sheetData, err
-		}
-
-		switch string(token.Name.Local) {
-		case "sheetData":
-			se := xmltokenizer.GetToken().Copy(token)
-			err = sheetData.UnmarshalToken(tok, se)
-			xmltokenizer.PutToken(se)
-			if err != nil {
-				return sheetData, err
-			}
-			break loop
-		}
-	}
-
-	return sheetData, nil
+	err := tok.Each("sheetData", func(se *xmltokenizer.Token) error {
+		return sheetData.UnmarshalToken(tok, se)
+	})
+	return sheetData, err
 }
 
 func UnmarshalWithStdlibXML(r io.Reader) (schema.SheetData, error) {
@@ -0,0 +1,29 @@
+package xmltokenizer
+
+// NameMatcher matches a name against a precompiled set of names.
+// It is safe for concurrent use.
+type NameMatcher struct {
+	index map[string]int
+}
+
+// NewNameMatcher creates a NameMatcher from the given names, the index of
+// each name is its position in names. If a name is given more than once,
+// the first index is used.
+func NewNameMatcher(names ...string) *NameMatcher {
+	m := &NameMatcher{index: make(map[string]int, len(names))}
+	for i, name := range names {
+		if _, ok := m.index[name]; !ok {
+			m.index[name] = i
+		}
+	}
+	return m
+}
+
+// Match returns the index of the matched name or -1 if name is not in the set.
+// It does not allocate, e.g. m.Match(token.Name.Local).
+func (m *NameMatcher) Match(name []byte) int {
+	if i, ok := m.index[string(name)]; ok { // The compiler does not allocate on this conversion.
+		return i
+	}
+	return -1
+}
@@ -0,0 +1,37 @@
+package xmltokenizer_test
+
+import (
+	"testing"
+
+	"github.com/muktihari/xmltokenizer"
+)
+
+func TestNameMatcher(t *testing.T) {
+	m := xmltokenizer.NewNameMatcher("row", "c", "v", "c")
+
+	tt := []struct {
+		name     string
+		expected int
+	}{
+		{name: "row", expected: 0},
+		{name: "c", expected: 1},
+		{name: "v", expected: 2},
+		{name: "f", expected: -1},
+		{name: "", expected: -1},
+		{name: "rows", expected: -1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if i := m.Match([]byte(tc.name)); i != tc.expected {
+				t.Fatalf("expected: %d, got: %d", tc.expected, i)
+			}
+		})
+	}
+
+	name := []byte("row")
+	alloc := testing.AllocsPerRun(10, func() { _ = m.Match(name) })
+	if alloc != 0 {
+		t.Fatalf("expected alloc: 0, got: %g", alloc)
+	}
+}
@@ -0,0 +1,130 @@
+package xmltokenizer
+
+import "io"
+
+// Node is a generic tree representation of an element, it is useful to explore
+// a document that has no schema. Every byte of a Node is owned by the Node.
+type Node struct {
+	Name     Name   // Name is the element's name.
+	Attrs    []Attr // Attrs holds the element's attributes, including the NamespaceDecls if any.
+	Children []Node // Children holds the child elements in the order of appearance.
+	Text     []byte // Text is the concatenation of the element's CharData as it is in Token's Data, excluding the children's.
+}
+
+// DecodeNode decodes the start element se and all of its children into a Node. It advances
+// the Tokenizer past the se's end element, so it must be invoked right after Token returns se.
+// Comments, ProcInsts and Directives inside the element are skipped. The bytes are copied
+// into the Node's own storage, so the Node remains valid after the Tokenizer reads the
+// next tokens. The attributes parsed on demand by WithLazyAttrs are not decoded.
+func (t *Tokenizer) DecodeNode(se *Token) (Node, error) {
+	if se.IsEndElement {
+		return Node{}, nil
+	}
+	var a arena
+	if se.SelfClosing {
+		t.endPending = false // The synthetic end element, if any, is consumed as well.
+		return a.node(se), nil
+	}
+
+	// The open elements, the innermost is the last, kept in a stack rather than decoded
+	// recursively, so a deeply nested document does not grow the goroutine stack.
+	stack := []Node{a.node(se)}
+	depth := t.depth
+	for {
+		token, err := t.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return Node{}, err
+		}
+		n := &stack[len(stack)-1]
+		switch {
+		case token.IsEndElement:
+			if t.depth >= depth+len(stack)-1 { // The synthetic end element of a self-closing child.
+				continue
+			}
+			child := *n
+			if stack = stack[:len(stack)-1]; len(stack) == 0 { // se's end element.
+				return child, nil
+			}
+			parent := &stack[len(stack)-1]
+			parent.Children = append(parent.Children, child)
+			parent.Text = a.append(parent.Text, token.Data) // The CharData that follows the child.
+		case len(token.Name.Full) == 0: // CharData, or a Comment, a ProcInst or a Directive.
+			if !token.SelfClosing {
+				n.Text = a.append(n.Text, token.Data)
+			}
+		case token.SelfClosing:
+			n.Children = append(n.Children, a.node(&token))
+			n.Text = a.append(n.Text, token.Data) // A self-closing element's Data is the CharData that follows it.
+		default:
+			stack = append(stack, a.node(&token))
+		}
+	}
+}
+
+// arenaChunkSize is the size of the arena's chunk, a larger bytes gets its own chunk.
+const arenaChunkSize = 4 << 10
+
+// arena copies bytes into chunks that are never grown, so the copied bytes are never moved.
+type arena struct {
+	buf []byte
+}
+
+// copy returns a copy of b, it returns nil if b is empty.
+func (a *arena) copy(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	if len(b) > cap(a.buf)-len(a.buf) {
+		size := arenaChunkSize
+		if len(b) > size {
+			size = len(b)
+		}
+		a.buf = make([]byte, 0, size)
+	}
+	a.buf = append(a.buf, b...)
+	return a.buf[len(a.buf)-len(b) : len(a.buf) : len(a.buf)]
+}
+
+// append appends b to dst, dst is copied into its own storage when it grows.
+func (a *arena) append(dst, b []byte) []byte {
+	if len(dst) == 0 {
+		return a.copy(b)
+	}
+	return append(dst, b...)
+}
+
+// name returns a copy of n, the Prefix and the Local are subslices of the Full.
+func (a *arena) name(n Name) Name {
+	full := a.copy(n.Full)
+	name := Name{Full: full}
+	if len(n.Prefix) > 0 {
+		name.Prefix = full[:len(n.Prefix):len(n.Prefix)]
+	}
+	if len(n.Local) > 0 {
+		name.Local = full[len(full)-len(n.Local):]
+	}
+	return name
+}
+
+// node returns a Node of the start element token without its children.
+func (a *arena) node(token *Token) Node {
+	node := Node{Name: a.name(token.Name)}
+	if n := len(token.Attrs) + len(token.NamespaceDecls()); n > 0 {
+		node.Attrs = make([]Attr, 0, n)
+		for _, attrs := range [...][]Attr{token.Attrs, token.NamespaceDecls()} {
+			for i := range attrs {
+				node.Attrs = append(node.Attrs, Attr{
+					Name:  a.name(attrs[i].Name),
+					Value: a.copy(attrs[i].Value),
+				})
+			}
+		}
+	}
+	if !token.SelfClosing {
+		node.Text = a.copy(token.Data)
+	}
+	return node
+}
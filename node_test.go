@@ -0,0 +1,179 @@
+package xmltokenizer_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/muktihari/xmltokenizer"
+)
+
+func TestDecodeNodeOnGPXFile(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "hike_mt_prau.gpx"))
+	if err != nil {
+		panic(err)
+	}
+
+	tok := xmltokenizer.New(bytes.NewReader(data), xmltokenizer.WithReadBufferSize(1<<10))
+	var gpx xmltokenizer.Node
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(token.Name.Local) == "gpx" {
+			if gpx, err = tok.DecodeNode(&token); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	if _, err = tok.Token(); err != io.EOF {
+		t.Fatalf("expected the Tokenizer to be advanced past the </gpx>, got: %v", err)
+	}
+
+	attr := func(n xmltokenizer.Node, local string) string {
+		for _, attr := range n.Attrs {
+			if string(attr.Name.Local) == local {
+				return string(attr.Value)
+			}
+		}
+		return ""
+	}
+
+	if string(gpx.Name.Full) != "gpx" || attr(gpx, "creator") != "StravaGPX" || attr(gpx, "version") != "1.1" {
+		t.Fatalf("unexpected root: <%s creator=%q version=%q>", gpx.Name.Full, attr(gpx, "creator"), attr(gpx, "version"))
+	}
+	if len(gpx.Children) != 2 {
+		t.Fatalf("expected 2 children, got: %d", len(gpx.Children))
+	}
+
+	metadata, trk := gpx.Children[0], gpx.Children[1]
+	if s := string(metadata.Children[0].Text); s != "2023-10-22T02:55:22Z" {
+		t.Fatalf("expected metadata's time: 2023-10-22T02:55:22Z, got: %s", s)
+	}
+	if s := string(trk.Children[0].Text); s != "Hike: Mt. Prau" {
+		t.Fatalf("expected trk's name: Hike: Mt. Prau, got: %s", s)
+	}
+
+	trkseg := trk.Children[2]
+	if n := strings.Count(string(data), "<trkpt "); len(trkseg.Children) != n {
+		t.Fatalf("expected %d trkpts, got: %d", n, len(trkseg.Children))
+	}
+	trkpt := trkseg.Children[1]
+	if attr(trkpt, "lat") != "-7.2027720" || attr(trkpt, "lon") != "109.9346350" {
+		t.Fatalf("unexpected trkpt: lat=%q lon=%q", attr(trkpt, "lat"), attr(trkpt, "lon"))
+	}
+	if s := string(trkpt.Children[1].Text); s != "2023-10-22T02:55:23Z" {
+		t.Fatalf("expected trkpt's time: 2023-10-22T02:55:23Z, got: %s", s)
+	}
+}
+
+func TestDecodeNode(t *testing.T) {
+	const xml = `<a x:k="v" xmlns:x="ns">head<!-- c --><b/>mid<c>in<d>deep</d></c>tail</a><next/>`
+	tok := xmltokenizer.New(strings.NewReader(xml),
+		xmltokenizer.WithReadBufferSize(1),
+		xmltokenizer.WithSeparateNamespaceDecls(true),
+	)
+
+	token, err := tok.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := tok.DecodeNode(&token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := func(prefix, local string) xmltokenizer.Name {
+		n := xmltokenizer.Name{Local: []byte(local), Full: []byte(local)}
+		if prefix != "" {
+			n.Prefix, n.Full = []byte(prefix), []byte(prefix+":"+local)
+		}
+		return n
+	}
+	expected := xmltokenizer.Node{
+		Name: name("", "a"),
+		Attrs: []xmltokenizer.Attr{
+			{Name: name("x", "k"), Value: []byte("v")},
+			{Name: name("xmlns", "x"), Value: []byte("ns")},
+		},
+		Children: []xmltokenizer.Node{
+			{Name: name("", "b")},
+			{
+				Name:     name("", "c"),
+				Children: []xmltokenizer.Node{{Name: name("", "d"), Text: []byte("deep")}},
+				Text:     []byte("in"),
+			},
+		},
+		Text: []byte("headmidtail"),
+	}
+	if diff := cmp.Diff(node, expected); diff != "" {
+		t.Fatal(diff)
+	}
+
+	if token, err = tok.Token(); err != nil || string(token.Name.Local) != "next" {
+		t.Fatalf("expected <next/>, got: %q, %v", token.Name.Full, err)
+	}
+
+	t.Run("synthetic end elements", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader(`<a><b/>mid<c><d/>in</c>tail</a><next/>`),
+			xmltokenizer.WithSyntheticEndElements(true))
+		token, _ := tok.Token()
+		node, err := tok.DecodeNode(&token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := xmltokenizer.Node{
+			Name: name("", "a"),
+			Children: []xmltokenizer.Node{
+				{Name: name("", "b")},
+				{Name: name("", "c"), Children: []xmltokenizer.Node{{Name: name("", "d")}}, Text: []byte("in")},
+			},
+			Text: []byte("midtail"),
+		}
+		if diff := cmp.Diff(node, expected); diff != "" {
+			t.Fatal(diff)
+		}
+		if token, err = tok.Token(); err != nil || string(token.Name.Local) != "next" || token.IsEndElement {
+			t.Fatalf("expected <next/>, got: %s, %v", token, err)
+		}
+		if node, err = tok.DecodeNode(&token); err != nil || string(node.Name.Local) != "next" {
+			t.Fatalf("expected <next/>, got: %q, %v", node.Name.Full, err)
+		}
+		if token, err = tok.Token(); err != io.EOF {
+			t.Fatalf("expected the synthetic </next> to be consumed, got: %s, %v", token, err)
+		}
+	})
+
+	t.Run("deeply nested", func(t *testing.T) {
+		const n = 100000
+		xml := strings.Repeat("<a>", n) + strings.Repeat("</a>", n)
+		tok := xmltokenizer.New(strings.NewReader(xml))
+		token, _ := tok.Token()
+		node, err := tok.DecodeNode(&token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var depth int
+		for ; len(node.Children) > 0; node = node.Children[0] {
+			depth++
+		}
+		if depth != n-1 {
+			t.Fatalf("expected depth: %d, got: %d", n-1, depth)
+		}
+	})
+
+	t.Run("unexpected EOF", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<a><b>"))
+		token, _ := tok.Token()
+		if _, err := tok.DecodeNode(&token); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected: %v, got: %v", io.ErrUnexpectedEOF, err)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package xmltokenizer
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// readAhead is an io.Reader that prefetches the reader r in a goroutine, see WithReadAhead.
+// It double buffers: while the Tokenizer consumes a chunk, the goroutine reads the next one.
+// A buffer is only owned by one side at a time, its ownership is passed through the channels.
+type readAhead struct {
+	r       io.Reader
+	chunks  chan readChunk // the chunks read by the goroutine, in order
+	free    chan []byte    // the buffers consumed by the Tokenizer, to be read into again
+	done    chan struct{}  // closed by stop to direct the goroutine to exit
+	exited  chan struct{}  // closed by the goroutine on exit
+	reading atomic.Bool    // true while the goroutine is about to read or is reading r
+	cur     readChunk      // the chunk being consumed
+	off     int            // the number of consumed bytes of cur
+}
+
+// readChunk is the result of a single Read of the reader.
+type readChunk struct {
+	b   []byte
+	err error
+}
+
+// newReadAhead starts prefetching r in chunks of the given size, bufs are the buffers
+// of a stopped readAhead to be reused, the missing or smaller ones are allocated.
+func newReadAhead(r io.Reader, size int, bufs [][]byte) *readAhead {
+	ra := &readAhead{
+		r:      r,
+		chunks: make(chan readChunk, 1),
+		free:   make(chan []byte, 2),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	for i := 0; i < 2; i++ {
+		var buf []byte
+		if i < len(bufs) && cap(bufs[i]) >= size {
+			buf = bufs[i][:size:size]
+		} else {
+			buf = make([]byte, size)
+		}
+		ra.free <- buf
+	}
+	go ra.run()
+	return ra
+}
+
+// run reads r into the free buffers until r returns an error or stop is invoked.
+// On exit, the buffer it owns is passed back through free, so stop can reuse it.
+func (ra *readAhead) run() {
+	defer close(ra.exited)
+	for {
+		var buf []byte
+		select {
+		case buf = <-ra.free:
+		case <-ra.done:
+			return
+		}
+		// The flag is set before checking done, so stop either sees it or waits for the exit,
+		// see stop. There is always room in free since there are only two buffers.
+		ra.reading.Store(true)
+		select {
+		case <-ra.done:
+			ra.reading.Store(false)
+			ra.free <- buf
+			return
+		default:
+		}
+		n, err := ra.r.Read(buf[:cap(buf)])
+		ra.reading.Store(false)
+		select {
+		case ra.chunks <- readChunk{b: buf[:n], err: err}:
+		case <-ra.done:
+			ra.free <- buf
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read reads the prefetched chunks, it only blocks when the next chunk has not been read yet.
+// The error of a chunk is returned once its bytes are consumed.
+func (ra *readAhead) Read(p []byte) (int, error) {
+	for ra.off >= len(ra.cur.b) {
+		if ra.cur.err != nil {
+			return 0, ra.cur.err
+		}
+		if ra.cur.b != nil {
+			ra.free <- ra.cur.b[:0]
+		}
+		ra.cur, ra.off = <-ra.chunks, 0
+	}
+	n := copy(p, ra.cur.b[ra.off:])
+	ra.off += n
+	return n, nil
+}
+
+// stop directs the goroutine to exit and appends its buffers to bufs to be reused. It never
+// blocks on r: a Read of r that is in-flight can not be interrupted, so stop leaves the buffers
+// to the goroutine, which exits once the Read returns, e.g. once r is closed. Otherwise, the
+// goroutine exits right away, stop waits for it and takes the buffers back.
+func (ra *readAhead) stop(bufs [][]byte) [][]byte {
+	close(ra.done)
+	if ra.reading.Load() {
+		return bufs
+	}
+	<-ra.exited
+	if ra.cur.b != nil {
+		bufs = append(bufs, ra.cur.b)
+	}
+	for {
+		select {
+		case buf := <-ra.free:
+			bufs = append(bufs, buf)
+		case chunk := <-ra.chunks:
+			bufs = append(bufs, chunk.b)
+		default:
+			return bufs
+		}
+	}
+}
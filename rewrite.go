@@ -0,0 +1,125 @@
+package xmltokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// Rewrite reads the tokens of r until the end of the input and writes them back into w, e.g.
+// to redact an element of a document while streaming it. The fn is invoked for every token
+// and may modify it in place, or return false to drop it along with the whitespace preceding
+// it; dropping a start element drops its children and its end element as well, fn is not
+// invoked for them, while dropping an end element alone leaves its start element unclosed.
+// Any error of r or w is returned, Rewrite returns nil when the end of the input is reached.
+//
+// The tokens are read using WithTrimMode(TrimNone) and WithSeparateCharData(true), so fn is
+// invoked for every CharData and CDATA section on its own, not as a part of the Data of the
+// preceding start element. A token that fn leaves as is, and the whitespace between the tokens,
+// are written byte for byte as they are in the input, a modified token is written from its
+// Name.Full, Attrs, Data and flags: a comment, a ProcInst or a Directive as its Data, which
+// includes its markers, a CDATA section as its Data enclosed in the CDATA markers, and a tag
+// with its attributes separated by one space and quoted by double quotes, a double quote in the
+// value is written as &quot;. The Data and the attribute values are raw XML, the entities are
+// not decoded, so a value that is set by fn must be escaped, e.g. using xml.EscapeText.
+// A token is modified if any of those differs from the input, whether fn modifies the bytes in
+// place or sets them, so setting a value that is equal to the input leaves the token as is.
+//
+// The opts are applied before the options required by Rewrite, i.e. WithTrimMode(TrimNone),
+// WithSeparateCharData(true), WithLazyAttrs(false), WithNamesOnly(false),
+// WithSyntheticEndElements(false) and WithEntityDecoding(false).
+func Rewrite(r io.Reader, w io.Writer, fn func(tok *Token) bool, opts ...Option) error {
+	opts = append(opts[:len(opts):len(opts)],
+		WithTrimMode(TrimNone),
+		WithSeparateCharData(true),
+		WithLazyAttrs(false),
+		WithNamesOnly(false),
+		WithSyntheticEndElements(false),
+		WithEntityDecoding(false),
+	)
+	t := New(r, opts...)
+	t.keepLead = true // The whitespace between the tokens, that is not a part of any token.
+	bw := bufio.NewWriter(w)
+
+	var orig []byte // the token as it is written if modified, before fn is invoked
+	var buf []byte
+	for {
+		token, err := t.Token()
+		if err == io.EOF {
+			if _, err = bw.Write(t.lead); err != nil {
+				return err
+			}
+			return bw.Flush()
+		}
+		if err != nil {
+			return err
+		}
+
+		orig = appendToken(orig[:0], &token)
+		if !fn(&token) {
+			if len(token.Name.Full) > 0 {
+				if err = t.Skip(&token); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		buf = append(buf[:0], t.lead...)
+		n := len(buf)
+		if buf = appendToken(buf, &token); bytes.Equal(buf[n:], orig) { // Left as is by fn.
+			buf = append(buf[:n], t.raw...)
+		}
+		if _, err = bw.Write(buf); err != nil {
+			return err
+		}
+	}
+}
+
+// appendToken appends the XML representation of token into dst, see Rewrite.
+func appendToken(dst []byte, token *Token) []byte {
+	switch {
+	case token.IsEndElement:
+		dst = append(dst, "</"...)
+		dst = append(dst, token.Name.Full...)
+		return append(dst, '>')
+	case len(token.Name.Full) > 0:
+		dst = append(dst, '<')
+		dst = append(dst, token.Name.Full...)
+		for i := range token.Attrs {
+			dst = appendAttr(dst, &token.Attrs[i])
+		}
+		nsDecls := token.NamespaceDecls()
+		for i := range nsDecls {
+			dst = appendAttr(dst, &nsDecls[i])
+		}
+		if token.SelfClosing {
+			dst = append(dst, '/')
+		}
+		return append(dst, '>')
+	case token.IsCDATA:
+		dst = append(dst, "<![CDATA["...)
+		dst = append(dst, token.Data...)
+		return append(dst, "]]>"...)
+	default: // CharData, or a Comment, a ProcInst or a Directive including its markers.
+		return append(dst, token.Data...)
+	}
+}
+
+// appendAttr appends attr preceded by a space into dst, see Rewrite.
+func appendAttr(dst []byte, attr *Attr) []byte {
+	dst = append(dst, ' ')
+	dst = append(dst, attr.Name.Full...)
+	dst = append(dst, '=', '"')
+	for v := attr.Value; len(v) > 0; {
+		i := bytes.IndexByte(v, '"')
+		if i < 0 {
+			dst = append(dst, v...)
+			break
+		}
+		dst = append(dst, v[:i]...)
+		dst = append(dst, "&quot;"...)
+		v = v[i+1:]
+	}
+	return append(dst, '"')
+}
@@ -0,0 +1,214 @@
+package xmltokenizer_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/muktihari/xmltokenizer"
+)
+
+func TestRewrite(t *testing.T) {
+	const gpx = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1">
+  <metadata>
+    <name>Morning Ride</name>
+    <author>
+      <name>Jane</name>
+      <email id="jane" domain="example.com"/>
+    </author>
+    <!-- exported -->
+    <desc><![CDATA[a & b]]></desc>
+  </metadata>
+  <trk><trkseg><trkpt lat="-8.4"   lon="115.2"><ele>100</ele></trkpt></trkseg></trk>
+</gpx>
+`
+
+	tt := []struct {
+		name     string
+		fn       func(tok *xmltokenizer.Token) bool
+		expected string
+	}{
+		{
+			name:     "unchanged",
+			fn:       func(tok *xmltokenizer.Token) bool { return true },
+			expected: gpx,
+		},
+		{
+			name: "drop author",
+			fn:   func(tok *xmltokenizer.Token) bool { return string(tok.Name.Local) != "author" },
+			expected: strings.Replace(gpx, `
+    <author>
+      <name>Jane</name>
+      <email id="jane" domain="example.com"/>
+    </author>`, "", 1),
+		},
+		{
+			name: "drop comment",
+			fn: func(tok *xmltokenizer.Token) bool {
+				return !bytes.HasPrefix(tok.Data, []byte("<!--"))
+			},
+			expected: strings.Replace(gpx, "\n    <!-- exported -->", "", 1),
+		},
+		{
+			name: "redact attribute",
+			fn: func(tok *xmltokenizer.Token) bool {
+				for i := range tok.Attrs {
+					if string(tok.Attrs[i].Name.Local) == "lat" || string(tok.Attrs[i].Name.Local) == "lon" {
+						tok.Attrs[i].Value = []byte("0")
+					}
+				}
+				return true
+			},
+			expected: strings.Replace(gpx, `<trkpt lat="-8.4"   lon="115.2">`, `<trkpt lat="0" lon="0">`, 1),
+		},
+		{
+			name: "redact chardata in place",
+			fn: func(tok *xmltokenizer.Token) bool {
+				if string(tok.Data) == "Jane" {
+					copy(tok.Data, "****")
+				}
+				return true
+			},
+			expected: strings.Replace(gpx, "Jane", "****", 1),
+		},
+		{
+			name: "replace chardata",
+			fn: func(tok *xmltokenizer.Token) bool {
+				if string(tok.Data) == "Morning Ride" {
+					tok.Data = []byte("Ride &amp; Hike")
+				}
+				return true
+			},
+			expected: strings.Replace(gpx, "Morning Ride", "Ride &amp; Hike", 1),
+		},
+		{
+			name: "replace cdata",
+			fn: func(tok *xmltokenizer.Token) bool {
+				if tok.IsCDATA {
+					tok.Data = []byte(`"c"`)
+				}
+				return true
+			},
+			expected: strings.Replace(gpx, "a & b", `"c"`, 1),
+		},
+		{
+			name: "rename and replace attrs",
+			fn: func(tok *xmltokenizer.Token) bool {
+				if string(tok.Name.Local) == "email" {
+					tok.Name.Full = []byte("contact")
+					tok.Attrs = append(tok.Attrs[:1], xmltokenizer.Attr{
+						Name:  xmltokenizer.Name{Local: []byte("note"), Full: []byte("note")},
+						Value: []byte(`say "hi", it's`),
+					})
+				}
+				return true
+			},
+			expected: strings.Replace(gpx, `<email id="jane" domain="example.com"/>`, `<contact id="jane" note="say &quot;hi&quot;, it's"/>`, 1),
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := xmltokenizer.Rewrite(strings.NewReader(gpx), &buf, tc.fn); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(buf.String(), tc.expected); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+
+	t.Run("files", func(t *testing.T) {
+		for _, filename := range []string{"cdata_clrf.xml", "dtd.xml", "hike_mt_prau.gpx", "prolog.xml", "xlsx_sheet1.xml"} {
+			data, err := os.ReadFile(filepath.Join("testdata", filename))
+			if err != nil {
+				panic(err)
+			}
+			var buf bytes.Buffer
+			if err = xmltokenizer.Rewrite(bytes.NewReader(data), &buf, func(*xmltokenizer.Token) bool { return true }); err != nil {
+				t.Fatalf("%s: %v", filename, err)
+			}
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Fatalf("%s: expected the output to be byte for byte the input", filename)
+			}
+		}
+	})
+
+	t.Run("single-quoted attribute of a modified token", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := xmltokenizer.Rewrite(strings.NewReader(`<a b='say "hi"' c='1'/>`), &buf, func(tok *xmltokenizer.Token) bool {
+			tok.Attrs[1].Value = []byte("2")
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(buf.String(), `<a b="say &quot;hi&quot;" c="2"/>`); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("value set equal to the input", func(t *testing.T) {
+		const xml = `<a b = "1"   c='2'/>`
+		var buf bytes.Buffer
+		err := xmltokenizer.Rewrite(strings.NewReader(xml), &buf, func(tok *xmltokenizer.Token) bool {
+			tok.Attrs[0].Value = []byte("1") // Not the same bytes, but equal, so it is left as is.
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(buf.String(), xml); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		const xml = `<a xmlns:g="ns" g:b="1"><c xmlns:g="ns" g:b="1"/></a>`
+		var buf bytes.Buffer
+		err := xmltokenizer.Rewrite(strings.NewReader(xml), &buf, func(tok *xmltokenizer.Token) bool {
+			if len(tok.NamespaceDecls()) != 1 && len(tok.Name.Full) > 0 && !tok.IsEndElement {
+				t.Fatalf("expected the namespace declaration to be separated from the Attrs")
+			}
+			if string(tok.Name.Local) == "c" {
+				tok.Attrs[0].Value = []byte("2")
+			}
+			return true
+		}, xmltokenizer.WithSeparateNamespaceDecls(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(buf.String(), `<a xmlns:g="ns" g:b="1"><c g:b="2" xmlns:g="ns"/></a>`); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		keep := func(*xmltokenizer.Token) bool { return true }
+		if err := xmltokenizer.Rewrite(strings.NewReader(`<a><b x="1`), io.Discard, keep); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected: %v, got: %v", io.ErrUnexpectedEOF, err)
+		}
+		drop := func(tok *xmltokenizer.Token) bool { return string(tok.Name.Local) != "b" }
+		if err := xmltokenizer.Rewrite(strings.NewReader(`<a><b><c/>`), io.Discard, drop); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected: %v, got: %v", io.ErrUnexpectedEOF, err)
+		}
+		errWrite := errors.New("write error")
+		if err := xmltokenizer.Rewrite(strings.NewReader(`<a/>`), writerFunc(func(p []byte) (int, error) {
+			return 0, errWrite
+		}), keep); !errors.Is(err, errWrite) {
+			t.Fatalf("expected: %v, got: %v", errWrite, err)
+		}
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
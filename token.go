@@ -1,14 +1,30 @@
 package xmltokenizer
 
-import "sync"
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
 
 var pool = sync.Pool{New: func() any { return new(Token) }}
 
 // GetToken gets token from the pool, don't forget to put it back.
+// GetToken and PutToken are safe for concurrent use, tokens taken
+// from the pool are never shared between distinct Tokenizers.
 func GetToken() *Token { return pool.Get().(*Token) }
 
-// PutToken puts token back to the pool.
-func PutToken(t *Token) { pool.Put(t) }
+// PutToken puts token back to the pool. The token's Attrs is released
+// if its capacity is unusually large, so a one-off token with many
+// attributes does not permanently inflate the pooled tokens.
+func PutToken(t *Token) {
+	if cap(t.Attrs) > maxRetainedAttrsBufferSize {
+		t.Attrs = nil
+	}
+	pool.Put(t)
+}
 
 // Token represent a single token, one of these following:
 //   - <?xml version="1.0" encoding="UTF-8"?>
@@ -24,12 +40,72 @@ func PutToken(t *Token) { pool.Put(t) }
 //     ]>
 //
 // Token includes CharData or CDATA in Data field when it appears right after the start element.
+// A CharData that follows a comment or a processing instruction, e.g. <p>before<!-- c -->after</p>,
+// is returned as its own token with an empty Name and SelfClosing false.
+//
+// When IsCDATA is true, Data is the body of the CDATA section that is the only CharData
+// of the element, e.g. <data><![CDATA[<element>text</element>]]></data>. Such Data aliases
+// the Tokenizer's buffer, the body is never copied, so it is only valid before next Token
+// or RawToken method invocation. The body is trimmed according to WithTrimMode.
+//
+// Token has an unexported field holding the state of the opt-in features, which is read using
+// the accessors, e.g. Raw, RawData, NamespaceDecls and Entities. This is a breaking change for
+// the reflection-based comparisons of Tokens: cmp.Diff and cmp.Equal panic on the unexported
+// field, so compare the Tokens using cmpopts.IgnoreUnexported(Token{}) along with their accessors.
 type Token struct {
 	Name         Name   // Name is an XML name, empty when a tag starts with "<?" or "<!".
 	Attrs        []Attr // Attrs exist when len(Attrs) > 0.
 	Data         []byte // Data could be a CharData or a CDATA, or maybe a RawToken if a tag starts with "<?" or "<!" (except "<![CDATA").
 	SelfClosing  bool   // True when a tag ends with "/>" e.g. <c r="E3" s="1" />. Also true when a tag starts with "<?" or "<!" (except "<![CDATA").
 	IsEndElement bool   // True when a tag start with "</" e.g. </gpx> or </gpxtpx:atemp>.
+	IsCDATA      bool   // True when Data is the body of a CDATA section without its markers, e.g. <![CDATA[body]]>.
+
+	x *tokenExtra // x holds the opt-in state, nil unless one of the options using it is enabled or CopyAttrs is invoked.
+}
+
+// tokenExtra is the state of a token that is only used by the opt-in features, kept behind
+// a single pointer so the Token returned on every Token invocation stays small. The Tokenizer's
+// current token points to the Tokenizer's own tokenExtra, which is overwritten by the next token,
+// while a token that is populated by Copy, CopyDeepInto or CopyAttrs owns its tokenExtra.
+type tokenExtra struct {
+	owner    *Token     // the token owning it, nil when it is owned by the Tokenizer.
+	rawData  []byte     // the untransformed CharData, only populated when WithRawCharData is enabled.
+	attrsRaw []byte     // the unparsed attributes region, only populated when WithLazyAttrs is enabled.
+	raw      []byte     // the exact source bytes of the tag, only populated when WithKeepRaw is enabled.
+	nsDecls  []Attr     // the xmlns attributes, only populated when WithSeparateNamespaceDecls is enabled.
+	entities [][]byte   // the raw entity references in CharData, only populated when WithCollectEntities is enabled.
+	index    *attrIndex // the Tokenizer's attributes name index, only populated when WithAttrIndex is enabled.
+	interner *interner  // the Tokenizer's string interner, only populated when WithStringInterner is enabled.
+	attrsBuf []byte     // the storage of the attributes deep copied by CopyAttrs.
+}
+
+// extra returns t's own tokenExtra, allocating it if t has none or shares the Tokenizer's.
+// The token's data of the shared one is kept, the Tokenizer's state is not.
+func (t *Token) extra() *tokenExtra {
+	if t.x != nil && t.x.owner == t {
+		return t.x
+	}
+	x := &tokenExtra{owner: t}
+	if t.x != nil {
+		x.rawData, x.attrsRaw, x.raw = t.x.rawData, t.x.attrsRaw, t.x.raw
+		x.nsDecls, x.entities = t.x.nsDecls, t.x.entities
+	}
+	t.x = x
+	return x
+}
+
+// hasData reports whether x holds any data of the token, as opposed to only the Tokenizer's state.
+func (x *tokenExtra) hasData() bool {
+	return x != nil && (x.rawData != nil || x.attrsRaw != nil || len(x.raw) > 0 ||
+		len(x.nsDecls) > 0 || len(x.entities) > 0)
+}
+
+// lazyAttrs returns the unparsed attributes region, see WithLazyAttrs.
+func (t *Token) lazyAttrs() []byte {
+	if t.x == nil {
+		return nil
+	}
+	return t.x.attrsRaw
 }
 
 // IsEndElementOf checks whether the given token represent a
@@ -42,25 +118,559 @@ func (t *Token) IsEndElementOf(se *Token) bool {
 	return false
 }
 
-// Copy copies src Token into t, returning t. Attrs should be
-// consumed immediately since it's only being shallow copied.
+// HasPrefix reports whether t's Name.Prefix is equal to prefix, e.g. "gpxtpx" of <gpxtpx:hr>,
+// without allocation. An empty prefix matches a name without prefix.
+func (t *Token) HasPrefix(prefix string) bool { return string(t.Name.Prefix) == prefix }
+
+// ErrNotSelfClosing is returned by MustSelfClose when the token is not a self-closing element.
+const ErrNotSelfClosing = errorString("not a self-closing element")
+
+// MustSelfClose returns ErrNotSelfClosing if t is not a self-closing element, e.g. to check that
+// an element that should be empty, such as <link href="..."/>, is written as such.
+func (t *Token) MustSelfClose() error {
+	if t.SelfClosing && len(t.Name.Full) > 0 {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", t, ErrNotSelfClosing)
+}
+
+// IsEmpty reports whether t is an empty element written as a self-closing tag, e.g. <foo/>.
+// An empty element written as <foo></foo> is returned as two tokens, a start element whose
+// Data is empty followed by its end element, so IsEmpty reports false for its start element
+// since the emptiness is only known once its end element is read. To handle both spellings
+// in a single code path, create the Tokenizer using WithSyntheticEndElements(true), so <foo/>
+// is also followed by an end element, and read until IsEndElementOf the start element.
+func (t *Token) IsEmpty() bool {
+	return t.SelfClosing && len(t.Name.Full) > 0
+}
+
+// Copy copies src Token into t, returning t. Attrs, NamespaceDecls and Entities are
+// only shallow copied: the slices are t's own, but every Attr's Name and Value and
+// every entity still alias the Tokenizer's buffer, which is overwritten as the next tokens are read.
+// So they should be consumed before invoking the Tokenizer again, e.g. before
+// unmarshaling the children, or be deep copied using CopyAttrs.
 func (t *Token) Copy(src Token) *Token {
 	t.Name.Prefix = append(t.Name.Prefix[:0], src.Name.Prefix...)
 	t.Name.Local = append(t.Name.Local[:0], src.Name.Local...)
 	t.Name.Full = append(t.Name.Full[:0], src.Name.Full...)
 	t.Attrs = append(t.Attrs[:0], src.Attrs...) // shallow copy
 	t.Data = append(t.Data[:0], src.Data...)
+	if t.x != nil && t.x.owner != t {
+		t.x = nil // The Tokenizer's state is only valid for its current token, and its storage is not t's.
+	}
+	if src.x.hasData() {
+		x := t.extra()
+		x.rawData = append(x.rawData[:0], src.RawData()...)
+		x.attrsRaw = nil
+		if src.lazyAttrs() != nil {
+			x.attrsRaw = append(x.attrsRaw[:0], src.lazyAttrs()...)
+		}
+		x.raw = append(x.raw[:0], src.Raw()...)
+		x.nsDecls = append(x.nsDecls[:0], src.NamespaceDecls()...) // shallow copy
+		x.entities = append(x.entities[:0], src.Entities()...)     // shallow copy
+	} else if t.x != nil {
+		t.x.rawData, t.x.attrsRaw, t.x.raw = t.x.rawData[:0], nil, t.x.raw[:0]
+		t.x.nsDecls, t.x.entities = t.x.nsDecls[:0], t.x.entities[:0]
+	}
 	t.SelfClosing = src.SelfClosing
 	t.IsEndElement = src.IsEndElement
+	t.IsCDATA = src.IsCDATA
 	return t
 }
 
+// CopyAttrs deep copies the Name and Value of every Attr in Attrs and NamespaceDecls
+// into t's own storage, returning t, so they remain valid after the Tokenizer reads
+// the next tokens. It is typically invoked right after Copy. The storage is reused
+// by the subsequent invocations, e.g. when t is reused through GetToken and PutToken.
+func (t *Token) CopyAttrs() *Token {
+	var n int
+	for _, attrs := range [...][]Attr{t.Attrs, t.NamespaceDecls()} {
+		for i := range attrs {
+			n += len(attrs[i].Name.Prefix) + len(attrs[i].Name.Local) + len(attrs[i].Name.Full) + len(attrs[i].Value)
+		}
+	}
+	x := t.extra()
+	if cap(x.attrsBuf) < n {
+		x.attrsBuf = make([]byte, 0, n)
+	}
+
+	buf := x.attrsBuf[:0] // Never grows beyond its cap, so the copied bytes are never moved.
+	cp := func(b []byte) []byte {
+		if b == nil {
+			return nil
+		}
+		buf = append(buf, b...)
+		return buf[len(buf)-len(b) : len(buf) : len(buf)]
+	}
+	for _, attrs := range [...][]Attr{t.Attrs, t.NamespaceDecls()} {
+		for i := range attrs {
+			attr := &attrs[i]
+			attr.Name.Prefix = cp(attr.Name.Prefix)
+			attr.Name.Local = cp(attr.Name.Local)
+			attr.Name.Full = cp(attr.Name.Full)
+			attr.Value = cp(attr.Value)
+		}
+	}
+	return t
+}
+
+// CopyDeepInto deep copies src into t, returning t, like Copy followed by CopyAttrs, except
+// that every byte of the copy is appended into the caller-provided arena and the copy's fields
+// point into it. The possibly-grown arena is returned via the pointer, so a batch of tokens can
+// be copied into one arena with amortized zero allocation, e.g. by reusing arena[:0] and the
+// copies for every batch. The arena grows at most once per invocation, the bytes of the earlier
+// copies are never moved, but they are overwritten once the caller reuses the arena's storage.
+func (t *Token) CopyDeepInto(src Token, arena *[]byte) *Token {
+	n := len(src.Name.Full) + len(src.Data) + len(src.Raw()) + len(src.RawData()) + len(src.lazyAttrs())
+	for _, entity := range src.Entities() {
+		n += len(entity)
+	}
+	for _, attrs := range [...][]Attr{src.Attrs, src.NamespaceDecls()} {
+		for i := range attrs {
+			n += len(attrs[i].Name.Full) + len(attrs[i].Value)
+		}
+	}
+
+	buf := *arena
+	if cap(buf)-len(buf) < n {
+		buf = append(buf, make([]byte, n)...)[:len(buf)]
+	}
+	cp := func(b []byte) []byte {
+		if b == nil {
+			return nil
+		}
+		buf = append(buf, b...)
+		return buf[len(buf)-len(b) : len(buf) : len(buf)]
+	}
+	cpName := func(name Name) Name {
+		full := cp(name.Full)
+		name.Full = full
+		if name.Prefix != nil {
+			name.Prefix = full[:len(name.Prefix):len(name.Prefix)]
+		}
+		if name.Local != nil {
+			name.Local = full[len(full)-len(name.Local):]
+		}
+		return name
+	}
+
+	t.Name = cpName(src.Name)
+	t.Attrs = append(t.Attrs[:0], src.Attrs...)
+	for i := range t.Attrs {
+		t.Attrs[i].Name = cpName(t.Attrs[i].Name)
+		t.Attrs[i].Value = cp(t.Attrs[i].Value)
+	}
+	t.Data = cp(src.Data)
+	if t.x != nil && t.x.owner != t {
+		t.x = nil // The Tokenizer's state is only valid for its current token.
+	}
+	if src.x.hasData() {
+		x := t.extra()
+		x.rawData, x.attrsRaw, x.raw = cp(src.RawData()), cp(src.lazyAttrs()), cp(src.Raw())
+		x.nsDecls = append(x.nsDecls[:0], src.NamespaceDecls()...)
+		for i := range x.nsDecls {
+			x.nsDecls[i].Name = cpName(x.nsDecls[i].Name)
+			x.nsDecls[i].Value = cp(x.nsDecls[i].Value)
+		}
+		x.entities = append(x.entities[:0], src.Entities()...)
+		for i := range x.entities {
+			x.entities[i] = cp(x.entities[i])
+		}
+	} else if t.x != nil {
+		t.x.rawData, t.x.attrsRaw, t.x.raw = nil, nil, nil
+		t.x.nsDecls, t.x.entities = t.x.nsDecls[:0], t.x.entities[:0]
+	}
+	t.SelfClosing = src.SelfClosing
+	t.IsEndElement = src.IsEndElement
+	t.IsCDATA = src.IsCDATA
+	*arena = buf
+	return t
+}
+
+// ReparseAttrs parses the attributes of the start element from its Raw into Attrs, returning t,
+// e.g. for a token that is read using WithNamesOnly and WithKeepRaw, then retained using Copy
+// or CopyDeepInto, so its attributes can be obtained on demand after the Tokenizer's buffer is
+// overwritten. The Attrs alias t's Raw, the namespace declarations are in Attrs as well, and
+// the entities are not decoded. It does nothing if t has no Raw or it is not a start element.
+func (t *Token) ReparseAttrs() *Token {
+	raw := t.Raw()
+	if len(raw) < 2 || raw[0] != '<' || t.IsEndElement || len(t.Name.Full) == 0 {
+		return t
+	}
+	b := raw[1:]
+	if i := bytes.IndexAny(b, " \t\r\n/>"); i >= 0 { // Skip the name.
+		b = b[i:]
+	}
+	t.Attrs = t.Attrs[:0]
+	s := attrScanner{b: b}
+	for attr, ok := s.next(); ok; attr, ok = s.next() {
+		t.Attrs = append(t.Attrs, attr)
+	}
+	if len(t.Attrs) == 0 {
+		t.Attrs = nil
+	}
+	if t.x != nil { // Otherwise, Attr would scan the region that is no longer valid.
+		t.extra().attrsRaw = nil
+	}
+	return t
+}
+
+// Raw returns the exact source bytes of the tag that produced the token, e.g. <c r="E3" s="1">,
+// excluding the CharData that follows it. It returns nil unless the Tokenizer is created using
+// WithKeepRaw(true), and for a synthetic end element. Like the Data, it is only valid before next
+// Token or RawToken method invocation, use Copy or CopyDeepInto to retain it.
+func (t *Token) Raw() []byte {
+	if t.x == nil || len(t.x.raw) == 0 {
+		return nil
+	}
+	return t.x.raw
+}
+
+// NamespaceDecls returns the namespace declaring attributes, e.g. xmlns="ns" and xmlns:foo="ns",
+// in order of appearance. It returns nil unless the Tokenizer is created using
+// WithSeparateNamespaceDecls(true), they are in Attrs otherwise. Like the Attrs, they are only
+// valid before next Token or RawToken method invocation, use Copy and CopyAttrs to retain them.
+func (t *Token) NamespaceDecls() []Attr {
+	if t.x == nil || len(t.x.nsDecls) == 0 {
+		return nil
+	}
+	return t.x.nsDecls
+}
+
+// Entities returns the raw entity references found in the CharData, e.g. &writer; and &#169;,
+// in order of appearance. It returns nil unless the Tokenizer is created using
+// WithCollectEntities(true). They alias the Tokenizer's buffer, so they are only valid
+// before next Token or RawToken method invocation, use Copy or CopyDeepInto to retain them.
+func (t *Token) Entities() [][]byte {
+	if t.x == nil || len(t.x.entities) == 0 {
+		return nil
+	}
+	return t.x.entities
+}
+
+// RawData returns the CharData exactly as it appears in the source, including
+// the "<![CDATA[" and "]]>" markers, only surrounding whitespace is trimmed.
+// It returns nil unless the Tokenizer is created using WithRawCharData(true).
+func (t *Token) RawData() []byte {
+	if t.x == nil {
+		return nil
+	}
+	return t.x.rawData
+}
+
+// Attr returns the first attribute whose Name.Local is equal to local.
+// When the Tokenizer is created using WithLazyAttrs(true), the attribute
+// is parsed on demand by scanning the unparsed attributes region. When the
+// Tokenizer is created using WithAttrIndex(true), a token with many attributes
+// is looked up using a name index instead of a linear scan.
+func (t *Token) Attr(local string) (attr Attr, ok bool) {
+	if t.x != nil && t.x.index != nil && t.x.attrsRaw == nil && len(t.Attrs) >= minIndexedAttrs {
+		if i := t.x.index.lookup(t.Attrs, local); i >= 0 {
+			return t.Attrs[i], true
+		}
+		return attr, false
+	}
+	return t.attr(local, equal)
+}
+
+// AttrFold is like Attr but Name.Local is matched case-insensitively using
+// ASCII case folding, e.g. "soapaction" matches "SOAPAction". The stored
+// names are left untouched.
+func (t *Token) AttrFold(local string) (attr Attr, ok bool) {
+	return t.attr(local, equalFold)
+}
+
+func (t *Token) attr(local string, eq func(b []byte, s string) bool) (attr Attr, ok bool) {
+	if attrsRaw := t.lazyAttrs(); attrsRaw != nil {
+		s := attrScanner{b: attrsRaw}
+		for {
+			if attr, ok = s.next(); !ok {
+				return attr, false
+			}
+			if eq(attr.Name.Local, local) {
+				return attr, true
+			}
+		}
+	}
+	for i := range t.Attrs {
+		if eq(t.Attrs[i].Name.Local, local) {
+			return t.Attrs[i], true
+		}
+	}
+	return attr, false
+}
+
+const (
+	maxInternedLen     = 64   // the maximum length of a string to be interned
+	maxInternedStrings = 4096 // the maximum number of the interned strings, so it stays small
+)
+
+// interner interns small strings so a repeated value is only allocated once.
+type interner struct {
+	m map[string]string
+}
+
+// intern returns b as a string, it is the interned string if b is small.
+func (in *interner) intern(b []byte) string {
+	if len(b) > maxInternedLen {
+		return string(b)
+	}
+	if s, ok := in.m[string(b)]; ok { // Does not allocate.
+		return s
+	}
+	s := string(b)
+	if in.m == nil {
+		in.m = make(map[string]string)
+	}
+	if len(in.m) < maxInternedStrings {
+		in.m[s] = s
+	}
+	return s
+}
+
+// minIndexedAttrs is the minimum number of attributes for the index to be used,
+// scanning fewer attributes is cheaper than building the index.
+const minIndexedAttrs = 16
+
+// attrIndex is a name index of the current token's attributes for O(1) average lookup.
+// It is owned by the Tokenizer and reused between tokens, it is built lazily on the
+// first lookup. The names are interned so rebuilding the index does not allocate.
+type attrIndex struct {
+	built bool
+	index map[string]int    // Name.Local -> index in Attrs
+	names map[string]string // interned names
+}
+
+// reset invalidates the index for the next token.
+func (x *attrIndex) reset() { x.built = false }
+
+// lookup returns the index of the first attribute whose Name.Local is equal to local, or -1.
+func (x *attrIndex) lookup(attrs []Attr, local string) int {
+	if !x.built {
+		x.build(attrs)
+	}
+	if i, ok := x.index[local]; ok {
+		return i
+	}
+	return -1
+}
+
+func (x *attrIndex) build(attrs []Attr) {
+	if x.index == nil {
+		x.index = make(map[string]int, len(attrs))
+		x.names = make(map[string]string, len(attrs))
+	}
+	for k := range x.index {
+		delete(x.index, k)
+	}
+	if len(x.names) > maxInternedNames {
+		for k := range x.names {
+			delete(x.names, k)
+		}
+	}
+	for i := range attrs {
+		name, ok := x.names[string(attrs[i].Name.Local)]
+		if !ok {
+			name = string(attrs[i].Name.Local)
+			x.names[name] = name
+		}
+		if _, ok = x.index[name]; !ok {
+			x.index[name] = i
+		}
+	}
+	x.built = true
+}
+
+// maxInternedNames bounds the interned names, so documents with unbounded
+// distinct attribute names do not grow the memory indefinitely.
+const maxInternedNames = 4096
+
+func equal(b []byte, s string) bool { return string(b) == s }
+
+// equalFold reports whether b and s are equal under ASCII case folding.
+func equalFold(b []byte, s string) bool {
+	if len(b) != len(s) {
+		return false
+	}
+	for i := 0; i < len(b); i++ {
+		c1, c2 := b[i], s[i]
+		if c1 == c2 {
+			continue
+		}
+		if 'A' <= c1 && c1 <= 'Z' {
+			c1 += 'a' - 'A'
+		}
+		if 'A' <= c2 && c2 <= 'Z' {
+			c2 += 'a' - 'A'
+		}
+		if c1 != c2 {
+			return false
+		}
+	}
+	return true
+}
+
+// AttrValue returns the value of the first attribute whose Name.Local
+// is equal to local, it returns nil if the attribute is not found.
+func (t *Token) AttrValue(local string) []byte {
+	attr, _ := t.Attr(local)
+	return attr.Value
+}
+
+// AttrValueString returns the value of the first attribute whose Name.Local is equal to local
+// as a string, it returns "" if the attribute is not found. When the Tokenizer is created using
+// WithStringInterner(true), a small value is interned, so a repeated value, e.g. t="s" of every
+// XLSX cell, is only allocated once. Unlike AttrValue, the returned string remains valid forever.
+func (t *Token) AttrValueString(local string) string {
+	attr, _ := t.Attr(local)
+	if t.x != nil && t.x.interner != nil {
+		return t.x.interner.intern(attr.Value)
+	}
+	return string(attr.Value)
+}
+
+// AttrsMap builds a map of the attributes' Name.Full to its Value, it is handy
+// to read many attributes by name. Unlike Attr, it allocates on every call, and
+// the values alias the token's bytes, so they are only valid as long as the token is.
+func (t *Token) AttrsMap() map[string][]byte {
+	if attrsRaw := t.lazyAttrs(); attrsRaw != nil {
+		m := make(map[string][]byte)
+		s := attrScanner{b: attrsRaw}
+		for attr, ok := s.next(); ok; attr, ok = s.next() {
+			m[string(attr.Name.Full)] = attr.Value
+		}
+		return m
+	}
+	m := make(map[string][]byte, len(t.Attrs))
+	for i := range t.Attrs {
+		m[string(t.Attrs[i].Name.Full)] = t.Attrs[i].Value
+	}
+	return m
+}
+
+// LocalString returns the token's Name.Local as a string without copying it, it is
+// Name.LocalString, so the string is only valid before the next Token invocation.
+func (t *Token) LocalString() string { return t.Name.LocalString() }
+
+// ErrUnknownTimeLayout is returned by DataTimeAny when the Data matches none of the layouts.
+const ErrUnknownTimeLayout = errorString("unknown time layout")
+
+// timeLayouts is the list of layouts tried by DataTimeAny in order.
+var timeLayouts = [...]string{
+	time.RFC3339,                     // Atom, e.g. 2023-10-22T02:55:22Z, fractional seconds are accepted.
+	time.RFC1123Z,                    // RSS, e.g. Mon, 02 Jan 2006 15:04:05 -0700
+	time.RFC1123,                     // RSS, e.g. Mon, 02 Jan 2006 15:04:05 MST
+	"Mon, 2 Jan 2006 15:04:05 -0700", // RSS with single-digit day.
+	"Mon, 2 Jan 2006 15:04:05 MST",   // RSS with single-digit day.
+	time.RFC822Z,                     // e.g. 02 Jan 06 15:04 -0700
+	time.RFC822,                      // e.g. 02 Jan 06 15:04 MST
+	"2 Jan 2006 15:04:05 -0700",      // RSS without weekday.
+	"2006-01-02T15:04:05",            // Atom without zone, parsed as UTC.
+	"2006-01-02 15:04:05Z07:00",      // RFC3339 with a space separator.
+	"2006-01-02",                     // Date only, parsed as UTC.
+}
+
+// DataTimeAny parses the token's Data, excluding the surrounding whitespace, as a time using
+// the first layout that matches, in order: time.RFC3339, time.RFC1123Z, time.RFC1123,
+// "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", time.RFC822Z,
+// time.RFC822, "2 Jan 2006 15:04:05 -0700", "2006-01-02T15:04:05",
+// "2006-01-02 15:04:05Z07:00" and "2006-01-02". It is handy to read the dates of
+// RSS and Atom feeds. It returns ErrUnknownTimeLayout if none of the layouts matches.
+// The Data is converted to string only in the error, but time.Parse allocates the error of
+// every layout that does not match, so only a Data of the first layout is parsed without allocation.
+func (t *Token) DataTimeAny() (time.Time, error) {
+	b := bytes.TrimSpace(t.Data)
+	for _, layout := range timeLayouts {
+		if v, err := time.Parse(layout, string(b)); err == nil {
+			return v, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q: %w", b, ErrUnknownTimeLayout)
+}
+
+// String returns a compact human-readable representation of t for diagnostics, e.g.
+// <gpx version="1.1">, <c r="E3"/>, </trk>, comment( a comment ), procinst(xml version="1.0"),
+// cdata(text), directive(DOCTYPE gpx) or chardata(text). The CharData of an element is not included.
+func (t Token) String() string {
+	var sb strings.Builder
+	switch {
+	case t.IsEndElement:
+		sb.Grow(len(t.Name.Full) + 3)
+		sb.WriteString("</")
+		sb.Write(t.Name.Full)
+		sb.WriteByte('>')
+	case len(t.Name.Full) > 0:
+		attrsRaw := t.lazyAttrs()
+		n := len(t.Name.Full) + len(attrsRaw) + 3
+		for i := range t.Attrs {
+			n += len(t.Attrs[i].Name.Full) + len(t.Attrs[i].Value) + 4
+		}
+		sb.Grow(n)
+		sb.WriteByte('<')
+		sb.Write(t.Name.Full)
+		if attrsRaw != nil {
+			s := attrScanner{b: attrsRaw}
+			for attr, ok := s.next(); ok; attr, ok = s.next() {
+				writeAttr(&sb, &attr)
+			}
+		}
+		for i := range t.Attrs {
+			writeAttr(&sb, &t.Attrs[i])
+		}
+		nsDecls := t.NamespaceDecls()
+		for i := range nsDecls {
+			writeAttr(&sb, &nsDecls[i])
+		}
+		if t.SelfClosing {
+			sb.WriteByte('/')
+		}
+		sb.WriteByte('>')
+	default:
+		kind, b := "chardata", t.Data
+		if t.IsCDATA { // The content of a CDATA section returned by WithSeparateCharData.
+			kind = "cdata"
+		}
+		if t.SelfClosing {
+			for _, m := range [...]struct{ kind, open, close string }{
+				{"comment", "<!--", "-->"},
+				{"cdata", "<![CDATA[", "]]>"},
+				{"procinst", "<?", "?>"},
+				{"directive", "<!", ">"},
+			} {
+				if len(b) >= len(m.open)+len(m.close) &&
+					string(b[:len(m.open)]) == m.open && string(b[len(b)-len(m.close):]) == m.close {
+					kind, b = m.kind, b[len(m.open):len(b)-len(m.close)]
+					break
+				}
+			}
+		}
+		sb.Grow(len(kind) + len(b) + 2)
+		sb.WriteString(kind)
+		sb.WriteByte('(')
+		sb.Write(b)
+		sb.WriteByte(')')
+	}
+	return sb.String()
+}
+
+func writeAttr(sb *strings.Builder, attr *Attr) {
+	sb.WriteByte(' ')
+	sb.Write(attr.Name.Full)
+	sb.WriteString(`="`)
+	sb.Write(attr.Value)
+	sb.WriteByte('"')
+}
+
 // Attr represents an XML attribute.
 type Attr struct {
 	Name  Name
 	Value []byte
 }
 
+// HasPrefix reports whether a's Name.Prefix is equal to prefix, e.g. "xmlns" of xmlns:foo="ns",
+// without allocation. An empty prefix matches a name without prefix.
+func (a *Attr) HasPrefix(prefix string) bool { return string(a.Name.Prefix) == prefix }
+
 // Name represents an XML name <prefix:local>,
 // we don't manage the bookkeeping of namespaces.
 type Name struct {
@@ -68,3 +678,35 @@ type Name struct {
 	Local  []byte
 	Full   []byte // Full is combination of "prefix:local"
 }
+
+// String returns the "prefix:local" form of n, or just "local" when it has no prefix.
+func (n Name) String() string {
+	if len(n.Full) > 0 {
+		return string(n.Full)
+	}
+	if len(n.Prefix) == 0 {
+		return string(n.Local)
+	}
+	return string(n.Prefix) + ":" + string(n.Local)
+}
+
+// LocalString returns n.Local as a string without copying it, e.g. switch token.Name.LocalString().
+// The string aliases the Tokenizer's buffer, so like the token, it is only valid before the next
+// Token or RawToken invocation, after which its content changes; use LocalStringCopy to keep it.
+func (n Name) LocalString() string {
+	if len(n.Local) == 0 {
+		return ""
+	}
+	return unsafe.String(&n.Local[0], len(n.Local))
+}
+
+// LocalStringCopy returns a copy of n.Local as a string, it stays valid after the next Token invocation.
+func (n Name) LocalStringCopy() string { return string(n.Local) }
+
+// LocalEquals reports whether n.Local is equal to s, without allocation,
+// e.g. token.Name.LocalEquals("trkpt").
+func (n Name) LocalEquals(s string) bool { return string(n.Local) == s }
+
+// FullEquals reports whether n.Full is equal to s, without allocation,
+// e.g. token.Name.FullEquals("gpxtpx:hr").
+func (n Name) FullEquals(s string) bool { return string(n.Full) == s }
@@ -0,0 +1,28 @@
+//go:build go1.23
+
+package xmltokenizer
+
+import "iter"
+
+// AttrsSeq returns an iterator over the token's Attrs, e.g. for attr := range se.AttrsSeq().
+// When the Tokenizer is created using WithLazyAttrs(true), the attributes are parsed on demand
+// while iterating. The yielded Attr aliases the token's storage, so it is only valid as long as
+// the token is, i.e. before next Token or RawToken method invocation of the Tokenizer.
+func (t *Token) AttrsSeq() iter.Seq[Attr] {
+	return func(yield func(Attr) bool) {
+		if attrsRaw := t.lazyAttrs(); attrsRaw != nil {
+			s := attrScanner{b: attrsRaw}
+			for attr, ok := s.next(); ok; attr, ok = s.next() {
+				if !yield(attr) {
+					return
+				}
+			}
+			return
+		}
+		for i := range t.Attrs {
+			if !yield(t.Attrs[i]) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+//go:build go1.23
+
+package xmltokenizer_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/muktihari/xmltokenizer"
+)
+
+func TestAttrsSeq(t *testing.T) {
+	const xml = `<trkpt lat="-7.2027720" lon="109.9346350" xmlns:gpxtpx="ns"/>`
+
+	for _, lazy := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lazy=%t", lazy), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(xml))
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := token.Attrs
+
+			if lazy {
+				tok = xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithLazyAttrs(true))
+				if token, err = tok.Token(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var attrs []xmltokenizer.Attr
+			for attr := range token.AttrsSeq() {
+				attrs = append(attrs, attr)
+			}
+			if diff := cmp.Diff(attrs, expected); diff != "" {
+				t.Fatal(diff)
+			}
+
+			var n int
+			for range token.AttrsSeq() {
+				n++
+				break
+			}
+			if n != 1 {
+				t.Fatalf("expected the iteration to stop after break, got: %d", n)
+			}
+		})
+	}
+}
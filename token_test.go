@@ -1,7 +1,15 @@
 package xmltokenizer_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/muktihari/xmltokenizer"
@@ -122,6 +130,104 @@ func TestIsEndElementOf(t *testing.T) {
 	}
 }
 
+func TestMustSelfClose(t *testing.T) {
+	name := xmltokenizer.Name{Local: []byte("link"), Full: []byte("link")}
+	tt := []struct {
+		name  string
+		token xmltokenizer.Token
+		err   error
+	}{
+		{name: "self-closing", token: xmltokenizer.Token{Name: name, SelfClosing: true}},
+		{name: "start element", token: xmltokenizer.Token{Name: name}, err: xmltokenizer.ErrNotSelfClosing},
+		{name: "end element", token: xmltokenizer.Token{Name: name, IsEndElement: true}, err: xmltokenizer.ErrNotSelfClosing},
+		{name: "comment", token: xmltokenizer.Token{Data: []byte("<!-- c -->"), SelfClosing: true}, err: xmltokenizer.ErrNotSelfClosing},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			if err := tc.token.MustSelfClose(); !errors.Is(err, tc.err) {
+				t.Fatalf("expected: %v, got: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	name := xmltokenizer.Name{Local: []byte("foo"), Full: []byte("foo")}
+	tt := []struct {
+		name     string
+		token    xmltokenizer.Token
+		expected bool
+	}{
+		{name: "self-closing", token: xmltokenizer.Token{Name: name, SelfClosing: true}, expected: true},
+		{name: "start element", token: xmltokenizer.Token{Name: name}},
+		{name: "end element", token: xmltokenizer.Token{Name: name, IsEndElement: true}},
+		{name: "comment", token: xmltokenizer.Token{Data: []byte("<!-- c -->"), SelfClosing: true}},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			if empty := tc.token.IsEmpty(); empty != tc.expected {
+				t.Fatalf("expected: %t, got: %t", tc.expected, empty)
+			}
+		})
+	}
+}
+
+func TestEmptyElementSpellings(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "empty_elements.xml"))
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	type item struct {
+		ID     string
+		Text   string
+		Tokens int // the tokens from the start element to its end element, inclusive.
+	}
+
+	// A single code path for <item/>, <item></item> and <item>text</item>.
+	var items []item
+	tok := xmltokenizer.New(f, xmltokenizer.WithSyntheticEndElements(true))
+	for {
+		token, err := tok.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(token.Name.Local) != "item" || token.IsEndElement {
+			continue
+		}
+		se := xmltokenizer.GetToken().Copy(token)
+		it := item{ID: se.AttrValueString("id"), Text: string(se.Data), Tokens: 1}
+		for {
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			it.Tokens++
+			if token.IsEndElementOf(se) {
+				break
+			}
+		}
+		xmltokenizer.PutToken(se)
+		items = append(items, it)
+	}
+
+	expected := []item{
+		{ID: "1", Tokens: 2},
+		{ID: "2", Tokens: 2},
+		{ID: "3", Tokens: 2},
+		{ID: "4", Text: "text", Tokens: 2},
+	}
+	if diff := cmp.Diff(items, expected); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
 func TestCopy(t *testing.T) {
 	t1 := xmltokenizer.Token{
 		Name: xmltokenizer.Name{
@@ -143,13 +249,13 @@ func TestCopy(t *testing.T) {
 	var t2 xmltokenizer.Token
 	t2.Copy(t1)
 
-	if diff := cmp.Diff(t2, t1); diff != "" {
+	if diff := cmp.Diff(t2, t1, ignoreUnexported); diff != "" {
 		t.Fatal(diff)
 	}
 
 	t2.Name.Full = append(t2.Name.Full[:0], "asd"...)
 	t2.Data = append(t2.Data[:0], "60"...)
-	if diff := cmp.Diff(t2, t1); diff == "" {
+	if diff := cmp.Diff(t2, t1, ignoreUnexported); diff == "" {
 		t.Fatalf("expected different, got same")
 	}
 
@@ -159,3 +265,606 @@ func TestCopy(t *testing.T) {
 		t.Fatal(diff)
 	}
 }
+
+func TestCopyAccessors(t *testing.T) {
+	const xml = `<a xmlns:x="ns" b="c">&amp; <![CDATA[d]]></a>`
+
+	tok := xmltokenizer.New(strings.NewReader(xml),
+		xmltokenizer.WithKeepRaw(true),
+		xmltokenizer.WithRawCharData(true),
+		xmltokenizer.WithSeparateNamespaceDecls(true),
+		xmltokenizer.WithCollectEntities(true),
+	)
+	t1, err := tok.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var t2 xmltokenizer.Token
+	t2.Copy(t1)
+
+	if diff := cmp.Diff(t2, t1, ignoreUnexported); diff != "" {
+		t.Fatal(diff)
+	}
+	if string(t2.Raw()) != xml[:len(`<a xmlns:x="ns" b="c">`)] {
+		t.Fatalf("unexpected Raw: %q", t2.Raw())
+	}
+	if diff := cmp.Diff(t2.Raw(), t1.Raw()); diff != "" {
+		t.Fatalf("Raw: %s", diff)
+	}
+	if diff := cmp.Diff(t2.RawData(), t1.RawData()); diff != "" || len(t2.RawData()) == 0 {
+		t.Fatalf("RawData: %q: %s", t2.RawData(), diff)
+	}
+	if diff := cmp.Diff(t2.NamespaceDecls(), t1.NamespaceDecls()); diff != "" || len(t2.NamespaceDecls()) != 1 {
+		t.Fatalf("NamespaceDecls: %v: %s", t2.NamespaceDecls(), diff)
+	}
+	if diff := cmp.Diff(t2.Entities(), t1.Entities()); diff != "" || len(t2.Entities()) != 1 {
+		t.Fatalf("Entities: %q: %s", t2.Entities(), diff)
+	}
+}
+
+func TestCopyAttrs(t *testing.T) {
+	// A small read buffer makes the Tokenizer memmove the remaining bytes on every
+	// read, overwriting the bytes the previous token's attributes alias.
+	const xml = `<wpt lat="-7.1872750" lon="110.3450230" xmlns:x="ns"><ele>1234.5</ele><name>abcdefghijklmn</name></wpt>`
+
+	tok := xmltokenizer.New(strings.NewReader(xml),
+		xmltokenizer.WithReadBufferSize(16),
+		xmltokenizer.WithSeparateNamespaceDecls(true),
+	)
+	token, err := tok.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	se := xmltokenizer.GetToken().Copy(token).CopyAttrs()
+	defer xmltokenizer.PutToken(se)
+
+	for { // Read the children like a nested unmarshal does.
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.IsEndElementOf(se) {
+			break
+		}
+	}
+
+	expected := []xmltokenizer.Attr{
+		{Name: xmltokenizer.Name{Local: []byte("lat"), Full: []byte("lat")}, Value: []byte("-7.1872750")},
+		{Name: xmltokenizer.Name{Local: []byte("lon"), Full: []byte("lon")}, Value: []byte("110.3450230")},
+	}
+	if diff := cmp.Diff(se.Attrs, expected); diff != "" {
+		t.Fatal(diff)
+	}
+	expectedNS := []xmltokenizer.Attr{
+		{Name: xmltokenizer.Name{Prefix: []byte("xmlns"), Local: []byte("x"), Full: []byte("xmlns:x")}, Value: []byte("ns")},
+	}
+	if diff := cmp.Diff(se.NamespaceDecls(), expectedNS); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestCopyDeepInto(t *testing.T) {
+	const xml = `<?xml version="1.0"?><gpx xmlns:x="ns" creator="StravaGPX"><wpt lat="-7.1872750" lon="110.3450230">` +
+		`<x:ele>1234.5</x:ele><name><![CDATA[abcdefghijklmn]]></name><!-- c --></wpt></gpx>`
+	opts := []xmltokenizer.Option{
+		xmltokenizer.WithSeparateNamespaceDecls(true),
+		xmltokenizer.WithKeepRaw(true),
+	}
+
+	// A small read buffer overwrites the bytes the previous tokens alias.
+	tok := xmltokenizer.New(strings.NewReader(xml), append(opts, xmltokenizer.WithReadBufferSize(16))...)
+	var arena []byte
+	var copies []xmltokenizer.Token
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			break
+		}
+		copies = append(copies, xmltokenizer.Token{})
+		copies[len(copies)-1].CopyDeepInto(token, &arena)
+	}
+
+	tok = xmltokenizer.New(strings.NewReader(xml), opts...)
+	for i := range copies {
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(copies[i], token, ignoreUnexported); diff != "" {
+			t.Fatalf("[%d]: %s", i, diff)
+		}
+		if string(copies[i].Raw()) != string(token.Raw()) {
+			t.Fatalf("[%d]: expected Raw: %q, got: %q", i, token.Raw(), copies[i].Raw())
+		}
+		if diff := cmp.Diff(copies[i].NamespaceDecls(), token.NamespaceDecls()); diff != "" {
+			t.Fatalf("[%d]: NamespaceDecls: %s", i, diff)
+		}
+	}
+
+	dst := make([]xmltokenizer.Token, len(copies))
+	var batch []byte
+	allocs := testing.AllocsPerRun(100, func() { // The warm-up run grows the batch and dst's Attrs.
+		batch = batch[:0]
+		for i := range copies {
+			dst[i].CopyDeepInto(copies[i], &batch)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected zero allocation, got: %v", allocs)
+	}
+}
+
+func TestAttr(t *testing.T) {
+	token := xmltokenizer.Token{
+		Name: xmltokenizer.Name{Local: []byte("c"), Full: []byte("c")},
+		Attrs: []xmltokenizer.Attr{
+			{Name: xmltokenizer.Name{Local: []byte("r"), Full: []byte("r")}, Value: []byte("A1")},
+			{Name: xmltokenizer.Name{Prefix: []byte("x"), Local: []byte("s"), Full: []byte("x:s")}, Value: []byte("1")},
+		},
+	}
+
+	tt := []struct {
+		local    string
+		expected []byte
+		ok       bool
+	}{
+		{local: "r", expected: []byte("A1"), ok: true},
+		{local: "s", expected: []byte("1"), ok: true},
+		{local: "t", expected: nil, ok: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.local, func(t *testing.T) {
+			attr, ok := token.Attr(tc.local)
+			if ok != tc.ok {
+				t.Fatalf("expected ok: %t, got: %t", tc.ok, ok)
+			}
+			if diff := cmp.Diff(attr.Value, tc.expected); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(token.AttrValue(tc.local), tc.expected); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestAttrFold(t *testing.T) {
+	token := xmltokenizer.Token{
+		Name: xmltokenizer.Name{Local: []byte("operation"), Full: []byte("soap:operation")},
+		Attrs: []xmltokenizer.Attr{
+			{Name: xmltokenizer.Name{Local: []byte("SOAPAction"), Full: []byte("SOAPAction")}, Value: []byte("urn:Get")},
+			{Name: xmltokenizer.Name{Local: []byte("style"), Full: []byte("style")}, Value: []byte("document")},
+		},
+	}
+
+	tt := []struct {
+		local    string
+		expected []byte
+		ok       bool
+	}{
+		{local: "SOAPAction", expected: []byte("urn:Get"), ok: true},
+		{local: "soapaction", expected: []byte("urn:Get"), ok: true},
+		{local: "SoapAction", expected: []byte("urn:Get"), ok: true},
+		{local: "STYLE", expected: []byte("document"), ok: true},
+		{local: "soapactio", expected: nil, ok: false},
+		{local: "soap_action", expected: nil, ok: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.local, func(t *testing.T) {
+			attr, ok := token.AttrFold(tc.local)
+			if ok != tc.ok {
+				t.Fatalf("expected ok: %t, got: %t", tc.ok, ok)
+			}
+			if diff := cmp.Diff(attr.Value, tc.expected); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+
+	if _, ok := token.Attr("soapaction"); ok {
+		t.Fatalf("expected Attr to remain case-sensitive")
+	}
+
+	alloc := testing.AllocsPerRun(10, func() { _, _ = token.AttrFold("soapaction") })
+	if alloc != 0 {
+		t.Fatalf("expected alloc: 0, got: %g", alloc)
+	}
+}
+
+func TestAttrValueString(t *testing.T) {
+	const xml = `<row r="1" hidden="false"><c r="A1" s="10" t="str"/><c r="B1" s="10" t="str"/></row>`
+
+	for _, interner := range []bool{false, true} {
+		t.Run(fmt.Sprintf("interner=%t", interner), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithStringInterner(interner))
+			var values []string
+			for {
+				token, err := tok.Token()
+				if err != nil {
+					break
+				}
+				if string(token.Name.Local) == "c" {
+					values = append(values, token.AttrValueString("r"), token.AttrValueString("t"), token.AttrValueString("x"))
+				}
+			}
+			expected := []string{"A1", "str", "", "B1", "str", ""}
+			if diff := cmp.Diff(values, expected); diff != "" {
+				t.Fatal(diff)
+			}
+
+			tok = xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithStringInterner(interner))
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var expectedAllocs float64 = 1
+			if interner {
+				expectedAllocs = 0 // Only allocated once in the warm-up run.
+			}
+			if allocs := testing.AllocsPerRun(10, func() { _ = token.AttrValueString("hidden") }); allocs != expectedAllocs {
+				t.Fatalf("expected allocs: %v, got: %v", expectedAllocs, allocs)
+			}
+		})
+	}
+}
+
+func TestAttrsMap(t *testing.T) {
+	const body = `<body xmlns:foo="ns1" xmlns="ns2" xmlns:tag="ns3" ` + "\r\n\t" + `  >`
+	expected := map[string][]byte{
+		"xmlns:foo": []byte("ns1"),
+		"xmlns":     []byte("ns2"),
+		"xmlns:tag": []byte("ns3"),
+	}
+
+	for _, lazy := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lazy=%t", lazy), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(body), xmltokenizer.WithLazyAttrs(lazy))
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(token.AttrsMap(), expected); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestReparseAttrs(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "xlsx_sheet1.xml"))
+	if err != nil {
+		panic(err)
+	}
+
+	// startElements deep copies every start element, so they are retained after the buffer is overwritten.
+	startElements := func(opts ...xmltokenizer.Option) []*xmltokenizer.Token {
+		var tokens []*xmltokenizer.Token
+		var arena []byte
+		tok := xmltokenizer.New(bytes.NewReader(data), append(opts, xmltokenizer.WithReadBufferSize(64))...)
+		for {
+			token, err := tok.Token()
+			if err == io.EOF {
+				return tokens
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.IsEndElement || len(token.Name.Full) == 0 {
+				continue
+			}
+			tokens = append(tokens, new(xmltokenizer.Token).CopyDeepInto(token, &arena))
+		}
+	}
+
+	expecteds := startElements()
+	results := startElements(xmltokenizer.WithNamesOnly(true), xmltokenizer.WithKeepRaw(true))
+	if len(results) != len(expecteds) {
+		t.Fatalf("expected %d start elements, got: %d", len(expecteds), len(results))
+	}
+
+	var n int
+	for i := range results {
+		if results[i].Attrs != nil {
+			t.Fatalf("[%d]: expected no Attrs in names-only mode, got: %v", i, results[i].Attrs)
+		}
+		results[i].ReparseAttrs()
+		if diff := cmp.Diff(results[i].Attrs, expecteds[i].Attrs); diff != "" {
+			t.Fatalf("[%d] %s: %s", i, expecteds[i], diff)
+		}
+		if attr, ok := results[i].Attr("r"); ok {
+			if expected, _ := expecteds[i].Attr("r"); string(attr.Value) != string(expected.Value) {
+				t.Fatalf("[%d]: expected r: %q, got: %q", i, expected.Value, attr.Value)
+			}
+		}
+		n += len(results[i].Attrs)
+	}
+	if n == 0 {
+		t.Fatalf("expected attributes to be reparsed")
+	}
+
+	t.Run("nothing to reparse", func(t *testing.T) {
+		token := xmltokenizer.Token{Name: xmltokenizer.Name{Local: []byte("a"), Full: []byte("a")}}
+		if token.ReparseAttrs(); token.Attrs != nil {
+			t.Fatalf("%s: expected no Attrs, got: %v", token, token.Attrs)
+		}
+
+		tok := xmltokenizer.New(strings.NewReader(`<a></a><!-- c="1" -->`), xmltokenizer.WithKeepRaw(true))
+		for {
+			token, err := tok.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.ReparseAttrs(); token.Attrs != nil {
+				t.Fatalf("%s: expected no Attrs, got: %v", token, token.Attrs)
+			}
+		}
+	})
+}
+
+func TestDataTimeAny(t *testing.T) {
+	tt := []struct {
+		name     string
+		data     string
+		expected time.Time
+		err      error
+	}{
+		{name: "atom", data: "2023-10-22T02:55:22Z", expected: time.Date(2023, 10, 22, 2, 55, 22, 0, time.UTC)},
+		{name: "atom with fraction and offset", data: "2023-10-22T09:55:22.5+07:00", expected: time.Date(2023, 10, 22, 2, 55, 22, 5e8, time.UTC)},
+		{name: "rss", data: "Sun, 22 Oct 2023 09:55:22 +0700", expected: time.Date(2023, 10, 22, 2, 55, 22, 0, time.UTC)},
+		{name: "rss with zone name", data: "Sun, 22 Oct 2023 02:55:22 GMT", expected: time.Date(2023, 10, 22, 2, 55, 22, 0, time.UTC)},
+		{name: "rss with single-digit day", data: "Mon, 2 Oct 2023 02:55:22 +0000", expected: time.Date(2023, 10, 2, 2, 55, 22, 0, time.UTC)},
+		{name: "rfc822", data: "22 Oct 23 09:55 +0700", expected: time.Date(2023, 10, 22, 2, 55, 0, 0, time.UTC)},
+		{name: "without zone", data: "2023-10-22T02:55:22", expected: time.Date(2023, 10, 22, 2, 55, 22, 0, time.UTC)},
+		{name: "date only", data: " 2023-10-22\n", expected: time.Date(2023, 10, 22, 0, 0, 0, 0, time.UTC)},
+		{name: "unknown layout", data: "22/10/2023", err: xmltokenizer.ErrUnknownTimeLayout},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			token := xmltokenizer.Token{Data: []byte(tc.data)}
+			v, err := token.DataTimeAny()
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if !v.Equal(tc.expected) {
+				t.Fatalf("expected: %v, got: %v", tc.expected, v)
+			}
+		})
+	}
+
+	t.Run("allocs", func(t *testing.T) {
+		token := xmltokenizer.Token{Data: []byte(" 2023-10-22T02:55:22Z\n")}
+		if allocs := testing.AllocsPerRun(10, func() { _, _ = token.DataTimeAny() }); allocs != 0 {
+			t.Fatalf("expected alloc: 0, got: %g", allocs)
+		}
+	})
+}
+
+func wideElement(n int) string {
+	var sb strings.Builder
+	sb.WriteString("<snp")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, ` a%d="%d"`, i, i)
+	}
+	sb.WriteString(` a0="dup"/>`)
+	return sb.String()
+}
+
+func TestAttrIndex(t *testing.T) {
+	const n = 500
+	xml := wideElement(n)
+
+	tok := xmltokenizer.New(strings.NewReader(xml+xml), xmltokenizer.WithAttrIndex(true))
+	for k := 0; k < 2; k++ {
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			local, expected := fmt.Sprintf("a%d", i), fmt.Sprint(i)
+			attr, ok := token.Attr(local)
+			if !ok || string(attr.Value) != expected {
+				t.Fatalf("[%d] %s: expected: %s, got: %s (ok: %t)", k, local, expected, attr.Value, ok)
+			}
+		}
+		if _, ok := token.Attr("missing"); ok {
+			t.Fatalf("[%d] expected missing attr is not found", k)
+		}
+
+		if k == 1 { // The index and the interned names are reused.
+			alloc := testing.AllocsPerRun(10, func() { _, _ = token.Attr("a499") })
+			if alloc != 0 {
+				t.Fatalf("expected alloc: 0, got: %g", alloc)
+			}
+		}
+	}
+}
+
+func TestLocalString(t *testing.T) {
+	tok := xmltokenizer.New(strings.NewReader(`<gpxtpx:hr>150</gpxtpx:hr><cad/>`))
+	token, err := tok.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, localCopy := token.LocalString(), token.Name.LocalStringCopy()
+	if local != "hr" || localCopy != "hr" {
+		t.Fatalf("expected: hr, got: %q and %q", local, localCopy)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { _ = token.LocalString() }); allocs != 0 {
+		t.Fatalf("expected alloc: 0, got: %g", allocs)
+	}
+	if s := (xmltokenizer.Name{}).LocalString(); s != "" {
+		t.Fatalf("expected empty string, got: %q", s)
+	}
+
+	for err == nil {
+		_, err = tok.Token()
+	}
+	if localCopy != "hr" {
+		t.Fatalf("expected the copy to stay valid: hr, got: %q", localCopy)
+	}
+}
+
+func TestNameEquals(t *testing.T) {
+	name := xmltokenizer.Name{Prefix: []byte("gpxtpx"), Local: []byte("hr"), Full: []byte("gpxtpx:hr")}
+	tt := []struct {
+		s     string
+		local bool
+		full  bool
+	}{
+		{s: "hr", local: true},
+		{s: "gpxtpx:hr", full: true},
+		{s: "h"},
+		{s: ""},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %q", i, tc.s), func(t *testing.T) {
+			if ok := name.LocalEquals(tc.s); ok != tc.local {
+				t.Fatalf("LocalEquals: expected: %t, got: %t", tc.local, ok)
+			}
+			if ok := name.FullEquals(tc.s); ok != tc.full {
+				t.Fatalf("FullEquals: expected: %t, got: %t", tc.full, ok)
+			}
+		})
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		_ = name.LocalEquals("hr") && name.FullEquals("gpxtpx:hr")
+	})
+	if allocs != 0 {
+		t.Fatalf("expected alloc: 0, got: %g", allocs)
+	}
+}
+
+func TestHasPrefix(t *testing.T) {
+	t.Run("gpxtpx extensions", func(t *testing.T) {
+		data, err := os.ReadFile(filepath.Join("testdata", "ride_dps_bedugul.gpx"))
+		if err != nil {
+			panic(err)
+		}
+
+		var n int
+		tok := xmltokenizer.New(bytes.NewReader(data))
+		for {
+			token, err := tok.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.IsEndElement || !token.HasPrefix("gpxtpx") {
+				continue
+			}
+			if !strings.HasPrefix(string(token.Name.Full), "gpxtpx:") {
+				t.Fatalf("unexpected name: %s", token.Name.Full)
+			}
+			n++
+		}
+		if expected := bytes.Count(data, []byte("<gpxtpx:")); n == 0 || n != expected {
+			t.Fatalf("expected %d gpxtpx elements, got: %d", expected, n)
+		}
+	})
+
+	const xml = `<body xmlns:foo="ns1"><outer foo:attr="value" lang="en" xmlns:tag="ns4"><tag:name/></outer></body>`
+
+	tt := []struct {
+		local    string
+		prefix   string
+		expected []bool // the element's HasPrefix followed by its attributes'
+	}{
+		{local: "body", prefix: "", expected: []bool{true, false}},
+		{local: "outer", prefix: "foo", expected: []bool{false, true, false, false}},
+		{local: "outer", prefix: "xmlns", expected: []bool{false, false, false, true}},
+		{local: "outer", prefix: "", expected: []bool{true, false, true, false}},
+		{local: "name", prefix: "tag", expected: []bool{true}},
+		{local: "name", prefix: "ta", expected: []bool{false}},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s %q", i, tc.local, tc.prefix), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(xml))
+			for {
+				token, err := tok.Token()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(token.Name.Local) != tc.local {
+					continue
+				}
+				result := []bool{token.HasPrefix(tc.prefix)}
+				for i := range token.Attrs {
+					result = append(result, token.Attrs[i].HasPrefix(tc.prefix))
+				}
+				if diff := cmp.Diff(result, tc.expected); diff != "" {
+					t.Fatal(diff)
+				}
+				return
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	const xml = `<?xml version="1.0"?><!DOCTYPE gpx><gpx version="1.1" xmlns:x="ns">` +
+		`<x:trk/><!-- a comment -->text<![CDATA[more]]><name>n</name></gpx>`
+
+	expecteds := []string{
+		`procinst(xml version="1.0")`,
+		`directive(DOCTYPE gpx)`,
+		`<gpx version="1.1" xmlns:x="ns">`,
+		`<x:trk/>`,
+		`comment( a comment )`,
+		`chardata(text)`,
+		`cdata(more)`,
+		`<name>`,
+		`</name>`,
+		`</gpx>`,
+	}
+
+	for _, lazy := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lazy=%t", lazy), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithLazyAttrs(lazy))
+			for i, expected := range expecteds {
+				token, err := tok.Token()
+				if err != nil {
+					t.Fatalf("[%d] %v", i, err)
+				}
+				if s := token.String(); s != expected {
+					t.Fatalf("[%d] expected: %s, got: %s", i, expected, s)
+				}
+				if s := fmt.Sprint(token); s != expected {
+					t.Fatalf("[%d] fmt: expected: %s, got: %s", i, expected, s)
+				}
+			}
+		})
+	}
+
+	t.Run("Name", func(t *testing.T) {
+		tt := []struct {
+			name     xmltokenizer.Name
+			expected string
+		}{
+			{name: xmltokenizer.Name{Prefix: []byte("gpxtpx"), Local: []byte("hr"), Full: []byte("gpxtpx:hr")}, expected: "gpxtpx:hr"},
+			{name: xmltokenizer.Name{Prefix: []byte("gpxtpx"), Local: []byte("hr")}, expected: "gpxtpx:hr"},
+			{name: xmltokenizer.Name{Local: []byte("trk")}, expected: "trk"},
+			{name: xmltokenizer.Name{}, expected: ""},
+		}
+		for i, tc := range tt {
+			if s := tc.name.String(); s != tc.expected {
+				t.Fatalf("[%d] expected: %s, got: %s", i, tc.expected, s)
+			}
+			if s := fmt.Sprintf("%v", tc.name); s != tc.expected {
+				t.Fatalf("[%d] fmt: expected: %s, got: %s", i, tc.expected, s)
+			}
+		}
+	})
+}
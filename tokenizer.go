@@ -1,9 +1,12 @@
 package xmltokenizer
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"unicode"
+	"unicode/utf8"
 )
 
 type errorString string
@@ -15,33 +18,208 @@ const (
 )
 
 const (
-	defaultReadBufferSize      = 4 << 10
-	autoGrowBufferMaxLimitSize = 1000 << 10
-	defaultAttrsBufferSize     = 16
+	// ErrContentAfterRoot is returned in strict mode when an element or
+	// a CharData appears after the root element is closed.
+	ErrContentAfterRoot = errorString("content after root element")
+
+	// ErrUnexpectedElement is returned by Expect when the next token
+	// is not a start element of the expected name.
+	ErrUnexpectedElement = errorString("unexpected element")
+
+	// ErrNotEmpty is returned by ReadEmpty when the element has
+	// a CharData or a child, e.g. <true>yes</true>.
+	ErrNotEmpty = errorString("not an empty element")
+
+	// ErrNotFound is returned by Find when the end of the input
+	// is reached before an element matching the path is found.
+	ErrNotFound = errorString("not found")
+
+	// ErrDirectiveRejected is returned when WithRejectDirectives is enabled and
+	// a directive other than a comment or a CDATA section is found, e.g. <!DOCTYPE.
+	ErrDirectiveRejected = errorString("directive rejected")
+
+	// ErrBareAmpersand is returned in strict mode when a CharData or an attribute
+	// value contains an '&' that does not start an entity, e.g. "AT&T".
+	ErrBareAmpersand = errorString("bare '&' is not allowed")
+
+	// ErrNoReader is returned when the Tokenizer is used without an io.Reader,
+	// e.g. created using New(nil), attach a reader using Reset.
+	ErrNoReader = errorString("no reader")
+
+	// ErrInvalidAttrName is returned in strict mode when an attribute name contains
+	// a character other than letters, digits, '-', '_', '.' and ':', it starts with
+	// a digit, '-' or '.', e.g. "1st" or "a b", an attribute has no name, or it has
+	// a prefix with no local part, e.g. "foo:". In lenient mode, the latter is kept
+	// with an empty Name.Local, e.g. Name{Prefix: "foo", Full: "foo:"}.
+	ErrInvalidAttrName = errorString("invalid attribute name")
+
+	// ErrMisplacedDeclaration is returned in strict mode when an XML declaration,
+	// e.g. <?xml version="1.0"?>, is found anywhere other than the first token.
+	ErrMisplacedDeclaration = errorString("misplaced XML declaration")
+
+	// ErrMaxTokensExceeded is returned by Token when the number of
+	// tokens exceeds the limit set by WithMaxTokens.
+	ErrMaxTokensExceeded = errorString("max tokens exceeded")
+
+	// ErrMalformedEndElement is returned in strict mode when an end element
+	// has whitespace after its '<' or '/', e.g. </ a> or < /a>.
+	ErrMalformedEndElement = errorString("malformed end element")
+
+	// ErrInvalidBufferConfig is returned by Token when the buffer options are contradictory,
+	// i.e. WithReadBufferSize is larger than WithAutoGrowBufferMaxLimitSize, and
+	// WithStrictBufferConfig is enabled.
+	ErrInvalidBufferConfig = errorString("invalid buffer config")
+
+	// ErrAttrValueTooLarge is returned by Token when an attribute value
+	// is longer than the limit set by WithMaxAttrValueLen.
+	ErrAttrValueTooLarge = errorString("attribute value too large")
+
+	// ErrClosed is returned by Token and RawToken after Close
+	// is invoked, until the Tokenizer is Reset.
+	ErrClosed = errorString("tokenizer closed")
+)
+
+// SyntaxError represents a syntax error in the XML input stream, it is only
+// returned when the Tokenizer is in strict mode or rejects directives.
+type SyntaxError struct {
+	Offset int64  // Offset is the byte position in the input stream where the error occurs.
+	Msg    string // Msg is the additional error description, may be empty.
+	Err    error  // Err is the underlying error.
+}
+
+func (e SyntaxError) Error() string {
+	if e.Msg == "" {
+		return fmt.Sprintf("byte pos %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("byte pos %d: %s: %v", e.Offset, e.Msg, e.Err)
+}
+
+func (e SyntaxError) Unwrap() error { return e.Err }
+
+const (
+	// DefaultReadBufferSize is the default size of the buffer to read from the io.Reader, see WithReadBufferSize.
+	DefaultReadBufferSize = 4 << 10
+
+	// DefaultMaxBufferSize is the default limit of the auto grow buffer, see WithAutoGrowBufferMaxLimitSize.
+	DefaultMaxBufferSize = 1000 << 10
+
+	// DefaultAttrsBufferSize is the default initial capacity of Token's Attrs, see WithAttrBufferSize.
+	DefaultAttrsBufferSize = 16
 )
 
-// Tokenizer is a XML tokenizer.
+const (
+	// maxRetainedAttrsBufferSize is the soft maximum of the Attrs capacity retained between
+	// tokens, so a one-off element with many attributes does not permanently inflate memory.
+	// The capacity set by WithAttrBufferSize is always retained even if it's greater.
+	maxRetainedAttrsBufferSize = 256
+)
+
+// Tokenizer is a XML tokenizer. A Tokenizer is not safe for concurrent use,
+// however, distinct Tokenizers can be used concurrently since they do not
+// share any mutable state other than the Token pool.
 type Tokenizer struct {
 	r       io.Reader // reader provided by the client
 	n       int64     // the n read bytes counter
 	options options   // tokenizer's options
-	buf     []byte    // buffer that will grow as needed, large enough to hold a token (default max limit: 1MB)
+	buf     []byte    // buffer that will grow as needed, large enough to hold a token (default max limit: DefaultMaxBufferSize)
 	cur     int       // cursor byte position
 	err     error     // last encountered error
 	token   Token     // shared token
+	offset  int64     // the byte position of current token in the input stream
+	depth   int       // the depth of current open elements
+	root    bool      // true when the root element has been encountered
+	tokens  int       // the number of tokens returned by Token
+
+	textPending bool   // true when current token's CharData is too large to fit in the buffer
+	textStart   int    // the start position of the pending CharData in buf
+	endPending  bool   // true when a synthetic end element should be returned next
+	endOffset   int64  // the byte position of the "/>" of the self-closing tag of the pending synthetic end element
+	charData    []byte // the untransformed CharData region of current token, CDATA sections included
+	scratch     []byte // buffer holding the merged CharData, reused between tokens
+	decoded     []byte // buffer holding the entity-decoded CharData and attribute values of current token
+	transcoded  []byte // buffer holding the CharData of current token transcoded by WithLatin1Fallback
+
+	raw []byte // the raw bytes of current token including its CharData, nil for a synthetic token
+
+	malformedAttr []byte // the bytes starting from the first attr of current token that has no name, e.g. ="ns2"
+
+	hasLast bool // true when token is the one last returned by Token, i.e. no RawToken nor error since
+	unread  bool // true when Unread is invoked, so the next Token returns token again
+
+	empty Token // the start element returned by ReadEmpty, copied since its end element is read after it
+
+	keepLead bool   // true when the whitespace preceding a token should be kept in lead, only used by ReadUntil
+	lead     []byte // the whitespace preceding current token that is not a part of any token, e.g. <?xml ?>\n<a>
+
+	attrIndex attrIndex // the attributes name index of current token, only used when WithAttrIndex is enabled
+	interner  interner  // the interned attribute values, only used when WithStringInterner is enabled
+	attrNames attrSet   // the attribute names of current token, only used to check the duplicate attributes
+
+	extra tokenExtra // the opt-in state of current token, token.x points to it when any option using it is enabled
+
+	ws *whitespace // the whitespace set when WithWhitespaceChars is used, nil means the XML-standard whitespace
+
+	plain bool // true when no option changing the tokens is enabled, so Token takes its fast path, see plainToken
+
+	decl    declaration // the XML declaration of the document
+	started bool        // true once the first token is returned, the XML declaration is only allowed before
+
+	line      int     // the number of line breaks before counted, only used when WithPositionTracking is enabled
+	lineStart int64   // the byte position of the start of the line containing counted
+	counted   int64   // the byte position up to which the line breaks are counted
+	prev      [2]byte // the last two counted bytes, to detect a multi-byte line break spanning two counts
+
+	lineEnding string // the first line terminator seen in the input stream
+	lastByte   byte   // the last byte of the previous read, to detect CRLF spanning two reads
+
+	fromBytes bool // true when buf is the caller's data given to NewFromBytes, it is never read into nor moved
+
+	ra     *readAhead // the prefetcher of r, only used when WithReadAhead is enabled
+	raBufs [][]byte   // the buffers taken back from the stopped prefetcher, reused by the next one
 }
 
 type options struct {
 	readBufferSize             int
 	autoGrowBufferMaxLimitSize int
 	attrsBufferSize            int
+	rawCharData                bool
+	keepRaw                    bool
+	lazyAttrs                  bool
+	strict                     bool
+	trimMode                   TrimMode
+	syntheticEndElements       bool
+	rejectDirectives           bool
+	separateNamespaceDecls     bool
+	mergeCharData              bool
+	attrIndex                  bool
+	readerBufferReuse          bool
+	positionTracking           bool
+	commentTrim                bool
+	entityDecoding             bool
+	maxRetainedBuffer          int
+	namesOnly                  bool
+	whitespaceChars            string
+	maxTokens                  int
+	noCDATA                    bool
+	stringInterner             bool
+	collectEntities            bool
+	spill                      func(chunk []byte, last bool) error
+	progress                   func(bytesRead int64)
+	strictBufferConfig         bool
+	preserveWhitespace         bool
+	latin1Fallback             bool
+	warningHandler             func(SyntaxError)
+	separateCharData           bool
+	maxAttrValueLen            int
+	sortAttrs                  bool
+	readAhead                  bool
 }
 
 func defaultOptions() options {
 	return options{
-		readBufferSize:             defaultReadBufferSize,
-		autoGrowBufferMaxLimitSize: autoGrowBufferMaxLimitSize,
-		attrsBufferSize:            defaultAttrsBufferSize,
+		readBufferSize:             DefaultReadBufferSize,
+		autoGrowBufferMaxLimitSize: DefaultMaxBufferSize,
+		attrsBufferSize:            DefaultAttrsBufferSize,
 	}
 }
 
@@ -49,32 +227,347 @@ func defaultOptions() options {
 type Option func(o *options)
 
 // WithReadBufferSize directs XML Tokenizer to this buffer size
-// to read from the io.Reader. Default: 4096.
+// to read from the io.Reader. Default: DefaultReadBufferSize (4 KB).
 func WithReadBufferSize(size int) Option {
 	if size <= 0 {
-		size = defaultReadBufferSize
+		size = DefaultReadBufferSize
 	}
 	return func(o *options) { o.readBufferSize = size }
 }
 
 // WithAutoGrowBufferMaxLimitSize directs XML Tokenizer to limit
-// auto grow buffer to not grow exceed this limit. Default: 1 MB.
+// auto grow buffer to not grow exceed this limit. Default: DefaultMaxBufferSize (1000 KB).
 func WithAutoGrowBufferMaxLimitSize(size int) Option {
 	if size <= 0 {
-		size = autoGrowBufferMaxLimitSize
+		size = DefaultMaxBufferSize
 	}
 	return func(o *options) { o.autoGrowBufferMaxLimitSize = size }
 }
 
+// WithStrictBufferConfig directs XML Tokenizer to return ErrInvalidBufferConfig from the first
+// Token or RawToken invocation when the read buffer size is larger than the auto grow buffer max
+// limit size, e.g. WithReadBufferSize(1<<20) without WithAutoGrowBufferMaxLimitSize. By default,
+// the auto grow buffer max limit size is raised to the read buffer size. Default: false.
+func WithStrictBufferConfig(strictBufferConfig bool) Option {
+	return func(o *options) { o.strictBufferConfig = strictBufferConfig }
+}
+
 // WithAttrBufferSize directs XML Tokenizer to use this Attrs
-// buffer capacity as its initial size. Default: 8.
+// buffer capacity as its initial size. Default: DefaultAttrsBufferSize (16).
 func WithAttrBufferSize(size int) Option {
 	if size <= 0 {
-		size = defaultAttrsBufferSize
+		size = DefaultAttrsBufferSize
 	}
 	return func(o *options) { o.attrsBufferSize = size }
 }
 
+// WithRawCharData directs XML Tokenizer to keep the char data exactly
+// as it appears in the source (including the CDATA markers), so it can
+// be retrieved using Token's RawData method. Default: false.
+func WithRawCharData(rawCharData bool) Option {
+	return func(o *options) { o.rawCharData = rawCharData }
+}
+
+// WithKeepRaw directs XML Tokenizer to keep the exact source bytes of the tag that produced
+// the token, e.g. <c r="E3" s="1">, excluding the CharData that follows it, so they can be
+// retrieved using Token's Raw method. It lets the parsed structure and the raw bytes be
+// obtained in one pass. Default: false.
+func WithKeepRaw(keepRaw bool) Option {
+	return func(o *options) { o.keepRaw = keepRaw }
+}
+
+// WithLazyAttrs directs XML Tokenizer to only record the attributes region
+// instead of parsing every attribute into Token's Attrs. The attributes are
+// then parsed on demand using Token's Attr or AttrValue method. This is
+// beneficial when only few of many attributes are needed. Default: false.
+func WithLazyAttrs(lazyAttrs bool) Option {
+	return func(o *options) { o.lazyAttrs = lazyAttrs }
+}
+
+// WithStrict directs XML Tokenizer to check each token as it is returned, Token will return
+// SyntaxError on a misplaced XML declaration, an invalid attribute name, a bare ampersand,
+// a malformed end element, e.g. </ a>, or a content after the root element. It does not keep
+// track of the open elements, so it is not a full well-formedness check, e.g. a mismatched end
+// element such as <a></b> or an unclosed element is not reported; use Validate for that.
+// When it is false, XML Tokenizer is lenient and tolerates malformed
+// documents as much as possible. Default: false.
+func WithStrict(strict bool) Option {
+	return func(o *options) { o.strict = strict }
+}
+
+// WithWarningHandler directs XML Tokenizer, when it is lenient, to invoke handler for every
+// recoverable issue it tolerates, i.e. the issues that WithStrict returns as SyntaxError and
+// the duplicate attributes, e.g. <a b="1" b="2">, while Token continues as if there were no
+// issue. At most one issue of each kind is reported per token, e.g. only the first bare '&'.
+// The mismatched end elements are not tracked, use Validate for them. It has no effect when
+// WithStrict is enabled, since the issues are returned as errors instead. Default: nil.
+func WithWarningHandler(handler func(SyntaxError)) Option {
+	return func(o *options) { o.warningHandler = handler }
+}
+
+// TrimMode is the whitespace trimming policy applied to CharData.
+type TrimMode uint8
+
+const (
+	TrimBoth     TrimMode = iota // Trim both leading and trailing whitespace.
+	TrimNone                     // Keep both leading and trailing whitespace.
+	TrimLeading                  // Trim only leading whitespace.
+	TrimTrailing                 // Trim only trailing whitespace.
+)
+
+// WithTrimMode directs XML Tokenizer to trim the whitespace of CharData
+// according to the given mode. For CDATA, the mode is applied to the
+// content of the CDATA section. Default: TrimBoth.
+func WithTrimMode(mode TrimMode) Option {
+	return func(o *options) { o.trimMode = mode }
+}
+
+// WithCharDataTrim directs XML Tokenizer to trim the whitespace surrounding CharData,
+// it is a shorthand for WithTrimMode(TrimBoth) when true and WithTrimMode(TrimNone)
+// when false, so it can be set independently of WithCommentTrim. Default: true.
+func WithCharDataTrim(charDataTrim bool) Option {
+	if charDataTrim {
+		return WithTrimMode(TrimBoth)
+	}
+	return WithTrimMode(TrimNone)
+}
+
+// WithCommentTrim directs XML Tokenizer to trim the whitespace surrounding a comment's
+// content, e.g. "<!--\n  a comment\n-->" becomes "<!--a comment-->", so comments can be
+// normalized for diffing. The trimmed comment is only valid before next Token or RawToken
+// method invocation. Default: false.
+func WithCommentTrim(commentTrim bool) Option {
+	return func(o *options) { o.commentTrim = commentTrim }
+}
+
+// WithMaxRetainedBuffer directs XML Tokenizer to drop its buffers whose capacity is
+// larger than n on Reset, so a Tokenizer that once grew its buffer for a huge document
+// does not retain that memory forever, e.g. while being idle in a pool. The dropped
+// buffers are reallocated in their initial size. Zero or negative n retains everything.
+// Default: 0.
+func WithMaxRetainedBuffer(n int) Option {
+	if n < 0 {
+		n = 0
+	}
+	return func(o *options) { o.maxRetainedBuffer = n }
+}
+
+// WithNamesOnly directs XML Tokenizer to only populate the Name, IsEndElement and
+// SelfClosing of the elements, the attributes and the CharData are not parsed, so
+// Attrs and Data are always nil. It is useful for a structural scan, e.g. counting
+// the elements or building an outline. Comments, ProcInsts and Directives are still
+// in their Data. Default: false.
+func WithNamesOnly(namesOnly bool) Option {
+	return func(o *options) { o.namesOnly = namesOnly }
+}
+
+// WithStringInterner directs XML Tokenizer to intern the small attribute values returned by
+// Token's AttrValueString method, trading a map lookup for avoiding the allocation of a repeated
+// value, e.g. t="s" and s="1" of the thousands of XLSX cells. The number of the interned values
+// is bounded, and they are retained until the Tokenizer is garbage collected. Default: false.
+func WithStringInterner(stringInterner bool) Option {
+	return func(o *options) { o.stringInterner = stringInterner }
+}
+
+// WithNoCDATA directs XML Tokenizer to skip the CDATA detection while scanning the CharData
+// that follows a tag, any '<' is treated as the start of the next tag. It is only for an input
+// known to be CDATA-free: a CDATA section is then mis-tokenized, it is no longer the tag's Data
+// but returned as its own nameless SelfClosing token, like a Directive. Default: false.
+func WithNoCDATA(noCDATA bool) Option {
+	return func(o *options) { o.noCDATA = noCDATA }
+}
+
+// WithPreserveWhitespace directs XML Tokenizer to keep the CharData of a leaf element as is
+// when it is entirely whitespace, e.g. the Data of <sep> </sep> is " " instead of empty, so it
+// is distinguishable from <sep></sep>. The whitespace between elements, e.g. the indentation
+// of pretty-printed XML, is still trimmed according to WithTrimMode. Default: false.
+func WithPreserveWhitespace(preserveWhitespace bool) Option {
+	return func(o *options) { o.preserveWhitespace = preserveWhitespace }
+}
+
+// WithLatin1Fallback directs XML Tokenizer to reinterpret every byte of CharData that is not
+// a part of a valid UTF-8 sequence as Windows-1252, a superset of Latin-1, and transcode it into
+// UTF-8, e.g. the 0x92 apostrophe of a file that is declared as UTF-8 but is written by a legacy
+// editor becomes U+2019. The valid UTF-8 sequences are kept as is. The transcoded Data is only
+// valid before next Token or RawToken method invocation. Default: false.
+func WithLatin1Fallback(latin1Fallback bool) Option {
+	return func(o *options) { o.latin1Fallback = latin1Fallback }
+}
+
+// WithWhitespaceChars directs XML Tokenizer to treat the given ASCII chars, e.g. "\v\f",
+// as insignificant whitespace in addition to the XML-standard whitespace "\r\n \t". They
+// are trimmed from the CharData and the attribute values, and separate a tag name from its
+// attributes. Non-ASCII chars are ignored. Default: "" (only the XML-standard whitespace).
+func WithWhitespaceChars(chars string) Option {
+	return func(o *options) { o.whitespaceChars = chars }
+}
+
+// WithEntityDecoding directs XML Tokenizer to decode the predefined entities, i.e. &lt;
+// &gt; &amp; &quot; &apos;, and the decimal and hexadecimal character references, e.g.
+// &#169; and &#xA9;, in CharData and attribute values. The content of CDATA sections is
+// never decoded, and unknown entities are kept as is. The attributes parsed on demand
+// by WithLazyAttrs are not decoded. Default: false.
+func WithEntityDecoding(entityDecoding bool) Option {
+	return func(o *options) { o.entityDecoding = entityDecoding }
+}
+
+// WithCollectEntities directs XML Tokenizer to collect the raw entity references found in
+// CharData, e.g. &writer; and &#169;, in order of appearance, so they can be retrieved using
+// Token's Entities method, whether or not WithEntityDecoding is enabled. The references inside CDATA sections and the malformed
+// ones, e.g. a bare '&', are not collected. The Entities alias the Tokenizer's buffer, so they
+// are only valid before next Token or RawToken method invocation. Default: false.
+func WithCollectEntities(collectEntities bool) Option {
+	return func(o *options) { o.collectEntities = collectEntities }
+}
+
+// WithMaxTokens directs XML Tokenizer to limit the number of tokens returned by Token to n,
+// including the synthetic end elements, Token returns ErrMaxTokensExceeded instead of the
+// next token once n tokens have been returned. It bounds the work spent on an untrusted
+// input regardless of its size. Zero or negative n means unlimited. Default: 0.
+func WithMaxTokens(n int) Option {
+	if n < 0 {
+		n = 0
+	}
+	return func(o *options) { o.maxTokens = n }
+}
+
+// WithMaxAttrValueLen directs XML Tokenizer to limit the length of an attribute value to n bytes,
+// as it is in the input before any entity is decoded, Token returns a SyntaxError wrapping
+// ErrAttrValueTooLarge that names the attribute instead of a token carrying a longer value, e.g.
+// a megabytes long style="...". The whole tag must still fit in the buffer, which is bounded
+// by WithAutoGrowBufferMaxLimitSize. It has no effect when WithLazyAttrs is enabled. Zero or
+// negative n means unlimited. Default: 0.
+func WithMaxAttrValueLen(n int) Option {
+	if n < 0 {
+		n = 0
+	}
+	return func(o *options) { o.maxAttrValueLen = n }
+}
+
+// WithSyntheticEndElements directs XML Tokenizer to return a synthetic end
+// element right after a self-closing element, e.g. <a/> will be returned as
+// <a> followed by </a>, so both can be handled identically. Default: false.
+func WithSyntheticEndElements(syntheticEndElements bool) Option {
+	return func(o *options) { o.syntheticEndElements = syntheticEndElements }
+}
+
+// WithRejectDirectives directs XML Tokenizer to return an error when it finds
+// any "<!" construct other than a comment or a CDATA section, e.g. <!DOCTYPE,
+// <!ENTITY, <!ELEMENT or <!ATTLIST. This is useful to reject data documents
+// attempting DTD injection. Default: false.
+func WithRejectDirectives(rejectDirectives bool) Option {
+	return func(o *options) { o.rejectDirectives = rejectDirectives }
+}
+
+// WithSeparateNamespaceDecls directs XML Tokenizer to put the namespace declaring
+// attributes, e.g. xmlns="ns" and xmlns:foo="ns", into Token's NamespaceDecls method
+// instead of Attrs, so Attrs only contains the regular attributes. It has no effect
+// when WithLazyAttrs is enabled. Default: false (they remain in Attrs).
+func WithSeparateNamespaceDecls(separateNamespaceDecls bool) Option {
+	return func(o *options) { o.separateNamespaceDecls = separateNamespaceDecls }
+}
+
+// WithSeparateCharData directs XML Tokenizer to return the CharData and the CDATA sections that
+// follow a tag as their own nameless tokens instead of the tag's Data, e.g. <a>hi</a> is returned
+// as <a>, "hi" and </a>. A tag is then returned as soon as its '>' is read, without waiting for
+// the next '<' to find the end of its CharData, so it suits a long-lived stream whose reader blocks
+// instead of returning io.EOF, e.g. XMPP over a socket. A CDATA section's token has IsCDATA set.
+// WithMergeCharData and WithPreserveWhitespace have no effect, and the helpers that read the
+// start element's Data, e.g. CopyText and DecodeInto, do not see the CharData. Default: false.
+func WithSeparateCharData(separateCharData bool) Option {
+	return func(o *options) { o.separateCharData = separateCharData }
+}
+
+// WithMergeCharData directs XML Tokenizer to merge all the consecutive CharData
+// and CDATA sections that come after a tag into Token's Data, e.g. the Data of
+// <v>text<![CDATA[more]]></v> is "textmore". It stops at the first child element,
+// comment, ProcInst or end element. The merged Data is only valid before next
+// Token or RawToken method invocation. Without it, the CharData that precedes
+// a CDATA section is still merged with it, e.g. the Data of <v>text<![CDATA[more]]>tail</v>
+// is "textmore", but the "tail" is the Data of the next Token.
+//
+// The segments are joined as is, no whitespace is introduced or dropped at the seams, e.g. the
+// Data of <v>a <![CDATA[ b]]></v> is "a  b" and of <v><![CDATA[a]]> <![CDATA[b]]></v> is "a b".
+// WithTrimMode only applies to the edges of the merged Data, whether an edge is the text or
+// the content of a CDATA section, and the whitespace-only text preceding a leading CDATA
+// section is insignificant, like the whitespace surrounding a single CDATA section. Default: false.
+func WithMergeCharData(mergeCharData bool) Option {
+	return func(o *options) { o.mergeCharData = mergeCharData }
+}
+
+// WithSortAttrs directs XML Tokenizer to sort Token's Attrs by Name.Full, e.g. for comparing two
+// documents that only differ in the attributes order. The sort is stable, the attributes of the
+// same name keep their order. The namespace declaring attributes are sorted along with the others,
+// or on their own when WithSeparateNamespaceDecls is enabled. The document order is lost, only Raw
+// of WithKeepRaw keeps it, and it has no effect when WithLazyAttrs is enabled. Default: false.
+func WithSortAttrs(sortAttrs bool) Option {
+	return func(o *options) { o.sortAttrs = sortAttrs }
+}
+
+// WithAttrIndex directs XML Tokenizer to build a name index of the attributes,
+// lazily on the first Token's Attr lookup, so that looking up many attributes
+// of a very wide element is O(1) on average instead of a linear scan. Tokens
+// with few attributes are still scanned linearly. Default: false.
+func WithAttrIndex(attrIndex bool) Option {
+	return func(o *options) { o.attrIndex = attrIndex }
+}
+
+// WithReaderBufferReuse directs XML Tokenizer to read all the remaining bytes of
+// an in-memory reader, a reader that reports its unread length through a Len() int
+// method such as *bytes.Reader, *bytes.Buffer and *strings.Reader, in a single read
+// rather than in chunks of the read buffer size, as long as it fits within the auto
+// grow buffer max limit. This avoids repeated reads and memmove of the remaining bytes.
+// A *bufio.Reader only adds a second layer of buffering since the Tokenizer already
+// buffers its reads, prefer passing its underlying reader instead. Default: false.
+func WithReaderBufferReuse(readerBufferReuse bool) Option {
+	return func(o *options) { o.readerBufferReuse = readerBufferReuse }
+}
+
+// WithPositionTracking directs XML Tokenizer to track the line and column of the tokens,
+// so they can be retrieved using InputPos method. In an XML 1.1 document, i.e. declared
+// with <?xml version="1.1"?>, NEL (U+0085) and LS (U+2028) are counted as line breaks
+// as well. Default: false.
+func WithPositionTracking(positionTracking bool) Option {
+	return func(o *options) { o.positionTracking = positionTracking }
+}
+
+// WithSpill directs XML Tokenizer to stream a Comment, a ProcInst, a Directive or a CDATA
+// section that is too large to fit in the buffer (exceeding the limit set by
+// WithAutoGrowBufferMaxLimitSize) into spill in chunks, instead of returning an error.
+// The chunks are the raw bytes of the token including its markers, e.g. "<!--" and "-->",
+// and last is true on the final chunk. The chunk is only valid during the invocation.
+// A spilled token is not returned by Token and RawToken, they return the next token instead.
+// A CDATA section that follows a tag is spilled after the tag is returned without it.
+// Any error returned by spill is returned by Token. Default: nil.
+func WithSpill(spill func(chunk []byte, last bool) error) Option {
+	return func(o *options) { o.spill = spill }
+}
+
+// WithProgress directs XML Tokenizer to invoke progress with the cumulative number of bytes
+// read from the reader after every read that returns data, e.g. to report the progress of
+// a large file by comparing bytesRead with its size. It is invoked at most once per read,
+// not per token, and never for NewFromBytes since nothing is read. Default: nil.
+func WithProgress(progress func(bytesRead int64)) Option {
+	return func(o *options) { o.progress = progress }
+}
+
+// WithReadAhead directs XML Tokenizer to read from the reader in a background goroutine, which
+// prefetches the next chunk of the read buffer size while the current one is tokenized, so Token
+// rarely blocks on a slow reader, e.g. a network or a compressed stream. It only pays off when
+// both the reads and the processing of the tokens take significant time.
+//
+// New and Reset spawn the goroutine, it exits once the reader returns an error, e.g. io.EOF, or
+// once Token or RawToken returns any other error, e.g. a SyntaxError. A Tokenizer that is abandoned
+// before, e.g. after reading the first elements only, must be Closed or Reset to stop the goroutine.
+// Neither waits for a read that is in-flight, it can not be interrupted: the goroutine exits once
+// the read returns, so the reader must be closed to release a read that blocks, e.g. on a socket,
+// and it must not be reused until then. The buffers of the goroutine are reused by the next Reset
+// once it has exited. The reader is read ahead of the tokens, up to two chunks, so
+// WithReaderBufferReuse has no effect, and SetOptions can not enable nor disable it. Default: false.
+func WithReadAhead(readAhead bool) Option {
+	return func(o *options) { o.readAhead = readAhead }
+}
+
 // New creates new XML tokenizer.
 func New(r io.Reader, opts ...Option) *Tokenizer {
 	t := new(Tokenizer)
@@ -82,70 +575,794 @@ func New(r io.Reader, opts ...Option) *Tokenizer {
 	return t
 }
 
+// NewFromBytes creates new XML tokenizer that tokenizes data in place, without reading nor
+// copying it, so the tokens alias data directly. The data must not be modified until the
+// tokenization is done, the Tokenizer never modifies it. WithReadBufferSize, WithReaderBufferReuse
+// and WithAutoGrowBufferMaxLimitSize have no effect since every token is already in data.
+func NewFromBytes(data []byte, opts ...Option) *Tokenizer {
+	t := new(Tokenizer)
+	t.reset(nil, opts)
+	t.err = nil // The buffer options have no effect, so they can not be contradictory.
+	t.buf, t.fromBytes = data[:len(data):len(data)], true
+	t.n = int64(len(data))
+	if len(data) > 0 {
+		t.detectLineEnding(data)
+	}
+	return t
+}
+
 // Reset resets the Tokenizer, maintaining storage for
 // future tokenization to reduce memory alloc.
 func (t *Tokenizer) Reset(r io.Reader, opts ...Option) {
+	if t.fromBytes { // The buffer is the caller's data, it must not be reused.
+		t.buf, t.fromBytes = nil, false
+	}
+	t.reset(r, opts)
+
+	switch size := t.options.readBufferSize; {
+	case t.options.maxRetainedBuffer > 0 && cap(t.buf) > t.options.maxRetainedBuffer:
+		t.buf = make([]byte, size, size+DefaultReadBufferSize)
+	case cap(t.buf) >= size+DefaultReadBufferSize:
+		t.buf = t.buf[:size:cap(t.buf)]
+	default:
+		// Create buffer with additional cap since we need to memmove remaining bytes
+		t.buf = make([]byte, size, size+DefaultReadBufferSize)
+	}
+}
+
+// reset resets the Tokenizer's state and options, except its buffer.
+func (t *Tokenizer) reset(r io.Reader, opts []Option) {
+	t.stopReadAhead()
 	t.r, t.err = r, nil
 	t.n, t.cur = 0, 0
+	t.offset, t.depth, t.root, t.tokens = 0, 0, false, 0
+	t.textPending, t.textStart = false, 0
+	t.endPending, t.endOffset = false, 0
+	t.lineEnding, t.lastByte = "", 0
+	t.decl, t.started = declaration{raw: t.decl.raw[:0]}, false
+	t.hasLast, t.unread = false, false
+	t.line, t.lineStart, t.counted, t.prev = 0, 0, 0, [2]byte{}
+	t.err = t.applyOptions(opts, false)
+	if t.options.readAhead && r != nil && t.err == nil {
+		t.ra = newReadAhead(r, t.options.readBufferSize, t.raBufs)
+		t.raBufs = t.raBufs[:0]
+	}
+}
 
+// Close stops the goroutine of WithReadAhead, if any, without waiting for its in-flight read to
+// return, see WithReadAhead; the reader itself is not closed. Token and
+// RawToken return ErrClosed afterwards, until the Tokenizer is Reset. It always returns nil,
+// so a Tokenizer is an io.Closer, e.g. to defer its Close.
+func (t *Tokenizer) Close() error {
+	t.stopReadAhead()
+	if t.err == nil {
+		t.err = ErrClosed
+	}
+	t.endPending, t.hasLast, t.unread = false, false, false
+	return nil
+}
+
+// stopReadAhead stops the goroutine of WithReadAhead, if any, and keeps its buffers to be reused.
+func (t *Tokenizer) stopReadAhead() {
+	if t.ra != nil {
+		t.raBufs = t.ra.stop(t.raBufs[:0])
+		t.ra = nil
+	}
+}
+
+// SetOptions replaces the Tokenizer's options with opts, like Reset does, while keeping its reader,
+// buffer and position, e.g. to toggle WithStrict or WithEntityDecoding between the documents of
+// a stream. It must be invoked at a token boundary, i.e. between Token or RawToken invocations,
+// the options take effect from the next token. Toggling the behavioral options, e.g. WithStrict,
+// WithEntityDecoding or WithCommentTrim, is safe. The options of the buffers and the reader, i.e.
+// WithReadBufferSize, WithAutoGrowBufferMaxLimitSize, WithAttrBufferSize, WithStrictBufferConfig,
+// WithReaderBufferReuse, WithMaxRetainedBuffer and WithReadAhead, are only applied by New and Reset:
+// SetOptions ignores them in opts and keeps the current ones, so it never causes an error.
+func (t *Tokenizer) SetOptions(opts ...Option) {
+	t.applyOptions(opts, true)
+}
+
+// applyOptions applies opts on top of the default options, keeping the current options of the
+// buffers and the reader when keepBuffers is true. It returns ErrInvalidBufferConfig when the buffer
+// sizes are inconsistent and WithStrictBufferConfig is set, which can only happen without keepBuffers.
+func (t *Tokenizer) applyOptions(opts []Option, keepBuffers bool) error {
+	prev := t.options
 	t.options = defaultOptions()
 	for i := range opts {
 		opts[i](&t.options)
 	}
+	if keepBuffers {
+		o := &t.options
+		o.readBufferSize, o.autoGrowBufferMaxLimitSize, o.attrsBufferSize = prev.readBufferSize, prev.autoGrowBufferMaxLimitSize, prev.attrsBufferSize
+		o.strictBufferConfig, o.readerBufferReuse = prev.strictBufferConfig, prev.readerBufferReuse
+		o.maxRetainedBuffer, o.readAhead = prev.maxRetainedBuffer, prev.readAhead
+	}
+
+	t.ws = newWhitespace(t.options.whitespaceChars)
+
+	t.extra.index, t.extra.interner = nil, nil
+	if t.options.attrIndex {
+		t.extra.index = &t.attrIndex
+	}
+	if t.options.stringInterner {
+		t.extra.interner = &t.interner
+	}
+	t.token.x = nil // The Token methods skip the opt-in state on the default path.
+	if t.options.rawCharData || t.options.lazyAttrs || t.options.attrIndex || t.options.stringInterner ||
+		t.options.keepRaw || t.options.separateNamespaceDecls || t.options.collectEntities {
+		t.token.x = &t.extra
+	}
+
+	o := &t.options
+	t.plain = t.token.x == nil && t.ws == nil && o.trimMode == TrimBoth && o.maxTokens == 0 && o.maxAttrValueLen == 0 &&
+		!o.strict && o.warningHandler == nil && !o.syntheticEndElements && !o.rejectDirectives && !o.mergeCharData &&
+		!o.commentTrim && !o.entityDecoding && !o.namesOnly && !o.preserveWhitespace && !o.latin1Fallback &&
+		!o.separateCharData && !o.sortAttrs
 
 	if cap(t.token.Attrs) < t.options.attrsBufferSize {
 		t.token.Attrs = make([]Attr, 0, t.options.attrsBufferSize)
 	}
+	var err error
 	if t.options.readBufferSize > t.options.autoGrowBufferMaxLimitSize {
+		if t.options.strictBufferConfig {
+			err = fmt.Errorf("read buffer size %d exceeds the auto grow buffer max limit size %d: %w",
+				t.options.readBufferSize, t.options.autoGrowBufferMaxLimitSize, ErrInvalidBufferConfig)
+		}
+		// Coerced even so, the buffers are still sized consistently until the error is returned.
 		t.options.autoGrowBufferMaxLimitSize = t.options.readBufferSize
 	}
 
-	switch size := t.options.readBufferSize; {
-	case cap(t.buf) >= size+defaultReadBufferSize:
-		t.buf = t.buf[:size:cap(t.buf)]
-	default:
-		// Create buffer with additional cap since we need to memmove remaining bytes
-		t.buf = make([]byte, size, size+defaultReadBufferSize)
+	if n := t.options.maxRetainedBuffer; n > 0 {
+		if cap(t.scratch) > n {
+			t.scratch = nil
+		}
+		if cap(t.decoded) > n {
+			t.decoded = nil
+		}
 	}
+	return err
 }
 
+// ReadBufferSize returns the effective read buffer size, see WithReadBufferSize.
+func (t *Tokenizer) ReadBufferSize() int { return t.options.readBufferSize }
+
+// AutoGrowBufferMaxLimitSize returns the effective auto grow buffer max limit size, see
+// WithAutoGrowBufferMaxLimitSize. It is never less than the ReadBufferSize.
+func (t *Tokenizer) AutoGrowBufferMaxLimitSize() int { return t.options.autoGrowBufferMaxLimitSize }
+
+// AttrBufferSize returns the effective initial attributes buffer size, see WithAttrBufferSize.
+func (t *Tokenizer) AttrBufferSize() int { return t.options.attrsBufferSize }
+
 // Token returns either a valid token or an error.
 // The returned token is only valid before next
 // Token or RawToken method invocation.
+//
+// Any error is terminal and latched: once Token returns an error, including
+// io.EOF, io.ErrUnexpectedEOF and SyntaxError, every subsequent invocation
+// returns the same error without advancing, until the Tokenizer is Reset.
+// When the input ends while a token is still incomplete, the complete tokens
+// are returned first, followed by io.ErrUnexpectedEOF wrapped with its byte position
+// and the name of the truncated construct, e.g. "truncated comment".
 func (t *Tokenizer) Token() (token Token, err error) {
+	if t.unread {
+		t.unread = false
+		return t.current(), nil
+	}
+	if err = t.nextToken(); err != nil {
+		t.hasLast = false
+		if err != io.EOF { // The error is latched, nothing is read anymore.
+			t.stopReadAhead()
+		}
+		return token, err
+	}
+	t.hasLast = true
+	return t.current(), nil
+}
+
+// Unread pushes back the token last returned by Token, so the next Token invocation returns it
+// again without advancing, e.g. when a child turns out to belong to the parent's UnmarshalToken.
+// It must be invoked right after Token returns a token, the pushed back token stays valid until
+// it is returned again. Only one level is supported: invoking Unread more than once before the
+// next Token is the same as invoking it once, and it does nothing after Token returns an error
+// or after RawToken is invoked. Depth and InputOffset keep reporting the state after the token.
+func (t *Tokenizer) Unread() {
+	t.unread = t.hasLast
+}
+
+// nextToken parses the next token into the shared token, see Token.
+func (t *Tokenizer) nextToken() (err error) {
+	if t.endPending {
+		if err = t.countToken(); err != nil {
+			t.endPending = false
+			return err
+		}
+		t.syntheticEndElement()
+		return nil
+	}
 	if t.err != nil {
-		return token, t.err
+		return t.err
 	}
 
-	b, err := t.RawToken()
+	b, err := t.rawToken()
 	if err != nil {
 		if !errors.Is(err, io.EOF) {
 			err = fmt.Errorf("byte pos %d: %w", t.n, err)
 		}
-		if len(b) == 0 || errors.Is(err, io.ErrUnexpectedEOF) {
-			return
-		}
 		t.err = err
+		// Only a CharData may be complete at EOF, any other error means the token is
+		// truncated, e.g. a large tag exceeding the buffer limit, so it must not be parsed.
+		if len(b) == 0 || !errors.Is(err, io.EOF) {
+			return err
+		}
+	} else if t.err != nil && !errors.Is(t.err, io.EOF) {
+		// Latched while parsing CharData, it will be returned on next invocation.
+		t.err = fmt.Errorf("byte pos %d: %w", t.n, t.err)
+	}
+
+	if t.plain {
+		t.plainToken(b)
+		return nil
+	}
+
+	if err = t.countToken(); err != nil {
+		return err
 	}
 
 	t.clearToken()
+	t.raw = b
+	if t.options.entityDecoding { // Decoded bytes are never longer than the source.
+		if cap(t.decoded) < len(b) {
+			t.decoded = make([]byte, 0, len(b))
+		}
+		t.decoded = t.decoded[:0]
+	}
+
+	raw := b
+	if b[0] != '<' || (t.options.separateCharData && bytes.HasPrefix(b, []byte("<![CDATA["))) {
+		// CharData that is not preceded by a regular tag, e.g. <!-- c -->CharData
+		t.consumeCharData(b)
+		b = nil
+	} else if b = t.consumeNonTagIdentifier(b); len(b) > 0 {
+		b = t.consumeTagName(b)
+		b = t.consumeAttrs(b)
+		t.consumeCharData(b)
+	}
+	if t.options.keepRaw {
+		t.extra.raw = raw[: len(raw)-len(b) : len(raw)-len(b)]
+	}
+	if t.textPending { // Only partial CharData is in the buffer, the rest can only be streamed using CopyText.
+		t.token.Data, t.extra.rawData = nil, nil
+	}
+
+	token := &t.token
+	if len(t.extra.rawData) == 0 {
+		t.extra.rawData = nil
+	}
+
+	if len(token.Name.Full) == 0 && token.SelfClosing && isDeclaration(token.Data) {
+		if t.validating() && t.started {
+			if err = t.recoverable(SyntaxError{Offset: t.offset, Err: ErrMisplacedDeclaration}); err != nil {
+				t.err = err
+				return err
+			}
+		}
+		if !t.decl.ok && !t.root {
+			t.decl.set(token.Data)
+		}
+	}
+	t.started = true
+
+	if t.options.rejectDirectives && isDirective(token.Data) && len(token.Name.Full) == 0 {
+		t.err = SyntaxError{Offset: t.offset, Msg: string(directiveName(token.Data)), Err: ErrDirectiveRejected}
+		return t.err
+	}
+
+	if t.options.maxAttrValueLen > 0 {
+		if err = t.checkAttrValueLen(token); err != nil {
+			t.err = err
+			return err
+		}
+	}
+
+	if t.validating() {
+		if err = t.recoverable(t.checkAttrNames(token)); err != nil {
+			t.err = err
+			return err
+		}
+		if err = t.recoverable(t.checkAmpersands(token)); err != nil {
+			t.err = err
+			return err
+		}
+		if err = t.recoverable(t.checkEndElement(token)); err != nil {
+			t.err = err
+			return err
+		}
+		if !t.options.strict { // Only Validate rejects them.
+			_ = t.recoverable(t.checkDuplicateAttrs(token))
+		}
+	}
+
+	if t.options.entityDecoding { // After checkAmpersands since it validates the undecoded values.
+		t.decodeAttrs(token.Attrs)
+		t.decodeAttrs(t.extra.nsDecls)
+	}
+
+	if err = t.recoverable(t.trackDepth(token)); err != nil {
+		t.err = err
+		return err
+	}
 
-	b = t.consumeNonTagIdentifier(b)
-	if len(b) > 0 {
+	if t.options.syntheticEndElements && token.SelfClosing && len(token.Name.Full) > 0 {
+		t.endPending = true
+		t.endOffset = t.offset + int64(len(raw)-len(b)-len("/>"))
+	}
+
+	return nil
+}
+
+// plainToken parses b into the token like nextToken does, but without any of the optional steps,
+// e.g. the validation or the entity decoding, so a Tokenizer with no option pays nothing for them.
+func (t *Tokenizer) plainToken(b []byte) {
+	t.tokens++
+	t.clearToken()
+	t.raw = b
+	if b[0] != '<' { // CharData that is not preceded by a regular tag, e.g. <!-- c -->CharData
+		t.consumeCharData(b)
+	} else if b = t.consumeNonTagIdentifier(b); len(b) > 0 {
 		b = t.consumeTagName(b)
 		b = t.consumeAttrs(b)
 		t.consumeCharData(b)
 	}
+	if t.textPending { // Only partial CharData is in the buffer, the rest can only be streamed using CopyText.
+		t.token.Data = nil
+	}
+
+	token := &t.token
+	if len(token.Name.Full) == 0 && token.SelfClosing && !t.decl.ok && !t.root && isDeclaration(token.Data) {
+		t.decl.set(token.Data)
+	}
+	t.started = true
+	_ = t.trackDepth(token) // It only fails when validating.
+}
+
+// validating reports whether the tokens are checked as in WithStrict, either to return
+// the issues as errors in strict mode or to report them to the warning handler.
+func (t *Tokenizer) validating() bool {
+	return t.options.strict || t.options.warningHandler != nil
+}
+
+// recoverable returns err in strict mode, otherwise, it reports err to
+// the warning handler and returns nil, so the tokenization continues.
+func (t *Tokenizer) recoverable(err error) error {
+	if err == nil || t.options.strict {
+		return err
+	}
+	if se, ok := err.(SyntaxError); ok && t.options.warningHandler != nil {
+		t.options.warningHandler(se)
+	}
+	return nil
+}
+
+// countToken counts a token that is about to be returned by Token, it latches and returns
+// ErrMaxTokensExceeded if the token would exceed the limit set by WithMaxTokens.
+func (t *Tokenizer) countToken() error {
+	if t.options.maxTokens > 0 && t.tokens >= t.options.maxTokens {
+		t.err = fmt.Errorf("byte pos %d: %w", t.n, ErrMaxTokensExceeded)
+		return t.err
+	}
+	t.tokens++
+	return nil
+}
+
+// isDeclaration reports whether b is an XML declaration, i.e. a ProcInst whose target is "xml",
+// not a ProcInst whose target only starts with "xml", e.g. <?xml-stylesheet ?>.
+func isDeclaration(b []byte) bool {
+	const prefix, suffix = "<?xml", "?>"
+	if len(b) < len(prefix)+len(suffix)+1 || string(b[:len(prefix)]) != prefix ||
+		string(b[len(b)-len(suffix):]) != suffix {
+		return false
+	}
+	switch b[len(prefix)] {
+	case ' ', '\t', '\r', '\n':
+		return true
+	}
+	return false
+}
+
+// isDirective reports whether b is a "<!" construct other than a comment or a CDATA section.
+func isDirective(b []byte) bool {
+	const comment, cdata = "<!--", "<![CDATA["
+	switch {
+	case len(b) < 2 || string(b[:2]) != "<!":
+		return false
+	case len(b) >= len(comment) && string(b[:len(comment)]) == comment:
+		return false
+	case len(b) >= len(cdata) && string(b[:len(cdata)]) == cdata:
+		return false
+	}
+	return true
+}
 
-	token = t.token
+// directiveName returns the directive's name including "<!", e.g. "<!DOCTYPE".
+func directiveName(b []byte) []byte {
+	for i := 2; i < len(b); i++ {
+		switch b[i] {
+		case ' ', '\t', '\r', '\n', '>', '[':
+			return b[:i]
+		}
+	}
+	return b
+}
+
+// Declaration returns the XML declaration of the document, e.g. <?xml version="1.0"
+// encoding="UTF-8" standalone="yes"?>, ok is false if the document has no declaration
+// or it is not read yet. It remains available until the Tokenizer is Reset.
+//
+// The standalone value is only reported, it never changes the tokenization: the Tokenizer never
+// loads an external DTD subset nor resolves an external entity, so a document is always tokenized
+// as if it were standalone="yes", e.g. a reference to an externally declared entity is kept as is
+// even with WithEntityDecoding, and the attribute values are never normalized by a DTD.
+func (t *Tokenizer) Declaration() (version, encoding string, standalone bool, ok bool) {
+	if !t.decl.ok {
+		return "", "", false, false
+	}
+	version = string(t.decl.lookup("version"))
+	encoding = string(t.decl.lookup("encoding"))
+	standalone = string(t.decl.lookup("standalone")) == "yes"
+	return version, encoding, standalone, true
+}
+
+// declaration represents an XML declaration, it is kept as is and only parsed on demand.
+type declaration struct {
+	raw   []byte // the pseudo-attributes of the XML declaration, the storage is reused by Reset
+	xml11 bool   // true when the version is "1.1"
+	ok    bool
+	small [64]byte // the storage of raw for a typical declaration, so keeping a copy does not allocate
+}
+
+// set keeps a copy of b, the XML declaration, see isDeclaration.
+func (d *declaration) set(b []byte) {
+	const prefix, suffix = "<?xml", "?>"
+	if d.raw == nil {
+		d.raw = d.small[:0]
+	}
+	d.raw = append(d.raw[:0], b[len(prefix):len(b)-len(suffix)]...)
+	d.xml11 = string(d.lookup("version")) == "1.1"
+	d.ok = true
+}
+
+// lookup returns the value of the pseudo-attribute of the given name, or nil if it is not found.
+func (d *declaration) lookup(name string) []byte {
+	b := d.raw
+	for len(b) > 0 {
+		var n, value []byte
+		if n, value, b = pseudoAttr(b); n == nil {
+			break
+		}
+		if string(n) == name {
+			return value
+		}
+	}
+	return nil
+}
+
+// pseudoAttr returns the next pseudo-attribute in the form of name="value" or name='value'
+// and the remaining bytes. name is nil if there is no more pseudo-attribute.
+func pseudoAttr(b []byte) (name, value, rest []byte) {
+	eq := bytes.IndexByte(b, '=')
+	if eq < 0 {
+		return nil, nil, nil
+	}
+	name = trim(b[:eq])
+	b = trimPrefix(b[eq+1:])
+	if len(b) == 0 || (b[0] != '"' && b[0] != '\'') {
+		return nil, nil, nil
+	}
+	end := bytes.IndexByte(b[1:], b[0])
+	if end < 0 {
+		return nil, nil, nil
+	}
+	return name, b[1 : end+1], b[end+2:]
+}
+
+// syntheticEndElement returns an end element of the previous self-closing token.
+// The depth is untouched since the self-closing token did not increase it.
+func (t *Tokenizer) syntheticEndElement() {
+	t.endPending = false
+	t.raw = nil
+	t.offset = t.endOffset
+	name := t.token.Name
+	t.clearToken()
+	t.token.Name = name
+	t.token.IsEndElement = true
+}
+
+// current returns the shared token as it is returned by Token, the empty slices are nil.
+func (t *Tokenizer) current() Token {
+	token := t.token
 	if len(token.Attrs) == 0 {
 		token.Attrs = nil
 	}
 	if len(token.Data) == 0 {
 		token.Data = nil
 	}
+	return token
+}
 
-	return token, nil
+// Err returns the error latched by the Tokenizer, the one that Token has returned or will return
+// without advancing, e.g. a SyntaxError or an io.ErrUnexpectedEOF of a truncated input. It returns
+// nil if no error is latched or the input ends cleanly with io.EOF, so like bufio.Scanner's Err,
+// it distinguishes the end of the input from a failure once the Token loop ends.
+func (t *Tokenizer) Err() error {
+	if t.err == nil || errors.Is(t.err, io.EOF) {
+		return nil
+	}
+	return t.err
+}
+
+// Depth returns the number of the currently open elements: it is incremented once Token
+// returns a start element and decremented once Token returns an end element, e.g. it is 1
+// right after <gpx> and 0 right after </gpx>. A self-closing element, including its synthetic
+// end element, does not change it. It is always tracked, so it has no extra cost.
+func (t *Tokenizer) Depth() int { return t.depth }
+
+// trackDepth tracks the depth of the open elements, it also validates
+// that no content appears after the root element when validating.
+func (t *Tokenizer) trackDepth(token *Token) error {
+	switch {
+	case token.IsEndElement:
+		if t.depth > 0 {
+			t.depth--
+		}
+		if t.validating() && t.depth == 0 {
+			return t.checkContentAfterRoot(t.charData)
+		}
+	case len(token.Name.Full) == 0:
+		if t.validating() && t.root && t.depth == 0 && !token.SelfClosing {
+			return t.checkContentAfterRoot(t.charData)
+		}
+	default:
+		var err error
+		if t.depth == 0 {
+			if t.validating() && t.root {
+				err = SyntaxError{Offset: t.offset, Msg: fmt.Sprintf("element <%s>", token.Name.Full), Err: ErrContentAfterRoot}
+			}
+			t.root = true
+		}
+		if !token.SelfClosing {
+			t.depth++
+		} else if t.validating() && t.depth == 0 && err == nil { // e.g. <root/>CharData
+			err = t.checkContentAfterRoot(t.charData)
+		}
+		return err
+	}
+	return nil
+}
+
+// checkContentAfterRoot returns SyntaxError if data, the untransformed CharData that comes
+// after the root element is closed, is not only whitespace.
+func (t *Tokenizer) checkContentAfterRoot(data []byte) error {
+	if data = t.ws.trimPrefix(data); len(data) == 0 {
+		return nil
+	}
+	return SyntaxError{Offset: t.offsetOf(data), Err: ErrContentAfterRoot}
+}
+
+// checkEndElement returns SyntaxError if the token is an end element that has
+// whitespace after its '<' or '/', which is only tolerated in lenient mode.
+func (t *Tokenizer) checkEndElement(token *Token) error {
+	if !token.IsEndElement || len(t.raw) < 3 {
+		return nil
+	}
+	if t.raw[1] != '/' || t.ws.is(t.raw[2]) {
+		return SyntaxError{Offset: t.offset, Msg: fmt.Sprintf("</%s>", token.Name.Full), Err: ErrMalformedEndElement}
+	}
+	return nil
+}
+
+// checkAttrNames validates that every attribute name of the token only contains the XML name
+// characters. The attributes parsed on demand by WithLazyAttrs are not validated.
+func (t *Tokenizer) checkAttrNames(token *Token) error {
+	if t.malformedAttr != nil {
+		return SyntaxError{Offset: t.offsetOf(t.malformedAttr), Msg: "attr with no name", Err: ErrInvalidAttrName}
+	}
+	for _, attrs := range [2][]Attr{token.Attrs, token.NamespaceDecls()} {
+		for i := range attrs {
+			name := attrs[i].Name.Full
+			if j := invalidNameChar(name); j >= 0 {
+				return SyntaxError{
+					Offset: t.offsetOf(name[j:]),
+					Msg:    fmt.Sprintf("attr %q", name),
+					Err:    ErrInvalidAttrName,
+				}
+			}
+			if len(attrs[i].Name.Local) == 0 { // e.g. foo:="x", the name ends with the ':'.
+				return SyntaxError{
+					Offset: t.offsetOf(name[len(name)-1:]),
+					Msg:    fmt.Sprintf("attr %q: no local name", name),
+					Err:    ErrInvalidAttrName,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkAttrValueLen returns ErrAttrValueTooLarge if any of the token's attribute values
+// is longer than the limit set by WithMaxAttrValueLen.
+func (t *Tokenizer) checkAttrValueLen(token *Token) error {
+	for _, attrs := range [2][]Attr{token.Attrs, token.NamespaceDecls()} {
+		for i := range attrs {
+			if value := attrs[i].Value; len(value) > t.options.maxAttrValueLen {
+				return SyntaxError{
+					Offset: t.offsetOf(value),
+					Msg:    fmt.Sprintf("attr %q: %d bytes, max is %d", attrs[i].Name.Full, len(value), t.options.maxAttrValueLen),
+					Err:    ErrAttrValueTooLarge,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// invalidNameChar returns the index of the first byte of b that is not a valid XML name
+// character, it returns -1 if there is none. Only letters, '_' and ':' may start a name.
+func invalidNameChar(b []byte) int {
+	for i := 0; i < len(b); {
+		r, size := rune(b[i]), 1
+		if r >= utf8.RuneSelf {
+			r, size = utf8.DecodeRune(b[i:])
+		}
+		switch {
+		case r == '_' || r == ':' || unicode.IsLetter(r):
+		case i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r)):
+		default:
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+// checkAmpersands validates that every '&' in the token's attribute values and
+// CharData starts an entity, e.g. &amp; or &#38;. CDATA content is not validated.
+func (t *Tokenizer) checkAmpersands(token *Token) error {
+	for i := range token.Attrs {
+		if j := bareAmpersand(token.Attrs[i].Value); j >= 0 {
+			return SyntaxError{
+				Offset: t.offsetOf(token.Attrs[i].Value[j:]),
+				Msg:    fmt.Sprintf("attr %s", token.Attrs[i].Name.Full),
+				Err:    ErrBareAmpersand,
+			}
+		}
+	}
+	if j := bareAmpersand(t.extra.attrsRaw); j >= 0 {
+		return SyntaxError{Offset: t.offsetOf(t.extra.attrsRaw[j:]), Err: ErrBareAmpersand}
+	}
+	if len(token.Name.Full) == 0 && token.SelfClosing { // ProcInst, Directive or Comment
+		return nil
+	}
+	const prefix, suffix = "<![CDATA[", "]]>"
+	b := t.charData
+	for len(b) > 0 {
+		text := b
+		if i := bytes.Index(b, []byte(prefix)); i >= 0 {
+			text, b = b[:i], b[i+len(prefix):]
+			if end := bytes.Index(b, []byte(suffix)); end >= 0 {
+				b = b[end+len(suffix):]
+			} else {
+				b = nil
+			}
+		} else {
+			b = nil
+		}
+		if j := bareAmpersand(text); j >= 0 {
+			return SyntaxError{Offset: t.offsetOf(text[j:]), Err: ErrBareAmpersand}
+		}
+	}
+	return nil
+}
+
+// bareAmpersand returns the index of the first '&' in b that does not
+// start an entity reference "&name;" or a character reference "&#...;",
+// it returns -1 if there is none.
+func bareAmpersand(b []byte) int {
+	for i := 0; i < len(b); i++ {
+		if b[i] != '&' {
+			continue
+		}
+		n := entityLen(b[i:])
+		if n == 0 {
+			return i
+		}
+		i += n - 1
+	}
+	return -1
+}
+
+// entityLen returns the length of the entity reference "&name;" or the character
+// reference "&#...;" at the start of b, it returns zero if there is none.
+func entityLen(b []byte) int {
+	if len(b) == 0 || b[0] != '&' {
+		return 0
+	}
+	j := 1
+	switch {
+	case j < len(b) && b[j] == '#':
+		j++
+		isDigit := isDecimal
+		if j < len(b) && b[j] == 'x' {
+			j++
+			isDigit = isHex
+		}
+		start := j
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		if j == start {
+			return 0
+		}
+	default:
+		start := j
+		for j < len(b) && isNameByte(b[j], j == start) {
+			j++
+		}
+		if j == start {
+			return 0
+		}
+	}
+	if j >= len(b) || b[j] != ';' {
+		return 0
+	}
+	return j + 1
+}
+
+// collectEntities appends the entity references of the CharData b, outside its CDATA sections, into the token's entities.
+func (t *Tokenizer) collectEntities(b []byte) {
+	const prefix, suffix = "<![CDATA[", "]]>"
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '&')
+		if i < 0 {
+			return
+		}
+		if j := bytes.Index(b[:i], []byte(prefix)); j >= 0 {
+			end := bytes.Index(b[j:], []byte(suffix))
+			if end < 0 {
+				return
+			}
+			b = b[j+end+len(suffix):]
+			continue
+		}
+		b = b[i:]
+		n := entityLen(b)
+		if n == 0 {
+			b = b[1:]
+			continue
+		}
+		t.extra.entities = append(t.extra.entities, b[:n:n])
+		b = b[n:]
+	}
+}
+
+func isDecimal(c byte) bool { return '0' <= c && c <= '9' }
+
+func isHex(c byte) bool { return isDecimal(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F') }
+
+// isNameByte reports whether c may be a part of an XML name, any non-ASCII byte is accepted.
+func isNameByte(c byte, first bool) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', c == '_', c == ':', c >= 0x80:
+		return true
+	case isDecimal(c), c == '-', c == '.':
+		return !first
+	}
+	return false
+}
+
+// offsetOf returns the byte position of b in the input stream,
+// b must be a subslice of current raw token bytes.
+func (t *Tokenizer) offsetOf(b []byte) int64 {
+	return t.n - int64(len(t.buf)) + int64(cap(t.buf)-cap(b))
 }
 
 // RawToken returns token in its raw bytes. At the end,
@@ -153,61 +1370,343 @@ func (t *Tokenizer) Token() (token Token, err error) {
 // The returned token bytes is only valid before next
 // Token or RawToken method invocation.
 func (t *Tokenizer) RawToken() (b []byte, err error) {
+	t.hasLast, t.unread = false, false
+	b, err = t.rawToken()
+	if err != nil && err != io.EOF { // The error is latched, nothing is read anymore.
+		t.stopReadAhead()
+	}
+	return t.ws.trim(b), err
+}
+
+// rawToken is like RawToken but the trailing whitespace of the
+// CharData is kept, so Token can apply the trimming policy.
+func (t *Tokenizer) rawToken() (b []byte, err error) {
 	if t.err != nil {
 		return nil, t.err
 	}
 
+	if t.keepLead {
+		t.lead = t.lead[:0]
+	}
+
 	var pivot, pos = t.cur, t.cur
-	var openclose int // zero means open '<' and close '>' is matched.
+	var openclose int       // zero means open '<' and close '>' is matched.
+	var text bool           // true when a CharData not preceded by a regular tag is found, e.g. <!-- c -->CharData
+	var ds directiveScanner // the scanning progress of a Directive, e.g. <!DOCTYPE
+	var quote byte          // the quote of the attribute value being scanned, e.g. '"' of <a b="c<d">
 	for {
 		if pos >= len(t.buf) {
 			pivot, pos = t.memmoveRemainingBytes(pivot)
 			if err = t.manageBuffer(); err != nil {
+				if t.spillable(err, pivot, openclose) {
+					if err = t.spillToken(pivot); err == nil {
+						pivot, pos, openclose = t.cur, t.cur, 0
+						continue
+					}
+					t.err = err
+					return nil, err
+				}
 				if openclose != 0 && errors.Is(err, io.EOF) {
-					err = io.ErrUnexpectedEOF
+					err = truncated(t.buf[pivot:pos])
 				}
 				t.err = err
+				t.offset = t.n - int64(len(t.buf)) + int64(pivot)
+				if openclose == 0 && !text { // Only whitespace remains.
+					t.keepLeading(pivot, pos)
+					return nil, err
+				}
 				return t.buf[pivot:pos], err
 			}
+			if quote != 0 { // The attribute value continues in the bytes just read.
+				pos, quote = skipQuoted(t.buf, pos, quote)
+				continue
+			}
+		}
+		if openclose > 0 { // Skip to the next delimiter, the other bytes of a tag need no scanning.
+			for pos < len(t.buf) && !isTagDelim[t.buf[pos]] {
+				pos++
+			}
+			if pos >= len(t.buf) {
+				continue
+			}
 		}
 		switch t.buf[pos] {
+		case '"', '\'':
+			if openclose == 1 && t.buf[pivot+1] != '!' && t.buf[pivot+1] != '?' {
+				// An attribute value of a regular tag, a '<' or '>' in it is a part of it, e.g. <a b="c<d>e">
+				pos, quote = skipQuoted(t.buf, pos+1, t.buf[pos])
+				continue
+			}
 		case '<':
 			if openclose == 0 {
+				if text {
+					buf := t.buf[pivot:pos:cap(t.buf)]
+					t.cur = pos
+					t.offset = t.n - int64(len(t.buf)) + int64(pivot)
+					return buf, err
+				}
+				t.keepLeading(pivot, pos)
 				pivot = pos
+				ds = directiveScanner{}
 			}
 			openclose++
 		case '>':
-			if openclose--; openclose != 0 {
+			if openclose == 0 {
+				break // Part of CharData.
+			}
+			switch constructEnd(t.buf[pivot:pos+1], &ds) {
+			case -1: // Inside a Comment, a CDATA, a ProcInst or a Directive, e.g. <!-- a > b -->
+				pos++
+				continue
+			case 1:
+				openclose = 0
+			default:
+				openclose--
+			}
+			if openclose != 0 {
 				break
 			}
 
 			switch t.buf[pivot+1] {
 			case '?', '!': // Maybe a ProcInst "<?target", a Directive "<!DOCTYPE" or a Comment "<!--"
-				buf := trim(t.buf[pivot : pos+1 : cap(t.buf)])
+				buf := t.buf[pivot : pos+1 : cap(t.buf)]
 				t.cur = pos + 1
+				t.offset = t.n - int64(len(t.buf)) + int64(pivot)
 				return buf, err
 			}
 
 			// Regular tag, check if next char represents CharData, include it.
-			pivot, pos = t.parseCharData(pivot, pos)
+			if !t.options.separateCharData {
+				pivot, pos = t.parseCharData(pivot, pos)
+			}
 
-			buf := trim(t.buf[pivot : pos+1 : cap(t.buf)])
+			buf := t.buf[pivot : pos+1 : cap(t.buf)]
 			t.cur = pos + 1
+			t.offset = t.n - int64(len(t.buf)) + int64(pivot)
 			return buf, err
+		case ' ', '\t', '\r', '\n':
+		default:
+			if openclose == 0 && !text && !t.isPadding(pos) && !t.ws.is(t.buf[pos]) {
+				text = true
+			}
 		}
 		pos++
 	}
 }
 
+// isTagDelim reports whether a byte is significant to find the end of a tag, see rawToken.
+var isTagDelim = [256]bool{'<': true, '>': true, '"': true, '\'': true}
+
+// skipQuoted returns the position right after the closing quote of an attribute value that
+// continues at pos in b, and a zero quote. If the closing quote is not in b yet, it returns
+// len(b) and the quote, so the scan continues once more bytes are read.
+func skipQuoted(b []byte, pos int, quote byte) (int, byte) {
+	i := bytes.IndexByte(b[pos:], quote)
+	if i < 0 {
+		return len(b), quote
+	}
+	return pos + i + 1, 0
+}
+
+// truncated returns io.ErrUnexpectedEOF wrapped with the name of the construct
+// that is truncated, b is the construct's bytes read so far, e.g. "<!-- c".
+func truncated(b []byte) error {
+	var name string
+	switch {
+	case bytes.HasPrefix(b, []byte("<!--")):
+		name = "comment"
+	case bytes.HasPrefix(b, []byte("<![CDATA[")):
+		name = "CDATA section"
+	case bytes.HasPrefix(b, []byte("<?")):
+		name = "processing instruction"
+	case bytes.HasPrefix(b, []byte("<!")):
+		name = "directive"
+	case bytes.HasPrefix(b, []byte("</")):
+		name = "end element"
+	default:
+		name = "start element"
+		var quote byte
+		for _, c := range b {
+			switch {
+			case quote == 0 && (c == '"' || c == '\''):
+				quote = c
+			case c == quote:
+				quote = 0
+			}
+		}
+		if quote != 0 {
+			name = "attribute value"
+		}
+	}
+	return fmt.Errorf("truncated %s: %w", name, io.ErrUnexpectedEOF)
+}
+
+// constructEnd reports whether b, the bytes from '<' to '>', is the whole Comment, CDATA,
+// ProcInst or Directive: 1 if it is, -1 if the '>' is inside of it, and 0 if b is none of them.
+// The ds holds the Directive's scanning progress of b, so b is only scanned once.
+func constructEnd(b []byte, ds *directiveScanner) int {
+	var open, term string
+	switch {
+	case len(b) < 2 || (b[1] != '!' && b[1] != '?'):
+		return 0
+	case b[1] == '?':
+		open, term = "<?", "?>"
+	case bytes.HasPrefix(b, []byte("<!--")):
+		open, term = "<!--", "-->"
+	case bytes.HasPrefix(b, []byte("<![CDATA[")):
+		open, term = "<![CDATA[", "]]>"
+	default:
+		if ds.n < len("<!") {
+			ds.n = len("<!")
+		}
+		for ; ds.n < len(b); ds.n++ {
+			if ds.next(b[ds.n]) {
+				return 1
+			}
+		}
+		return -1
+	}
+	if len(b) >= len(open)+len(term) && string(b[len(b)-len(term):]) == term {
+		return 1
+	}
+	return -1
+}
+
+// directiveScanner scans a Directive byte by byte, e.g. <!DOCTYPE x [ <!ATTLIST y z CDATA "a>b"> ]>,
+// to find its closing '>', which is not inside a quoted literal nor the internal subset.
+type directiveScanner struct {
+	n      int    // the number of bytes scanned, only used by constructEnd
+	quote  byte   // the quote of the literal being scanned, zero when it is not in a literal
+	subset int    // the depth of the internal subset "[ ]"
+	skip   string // the terminator of the Comment or ProcInst being skipped in the internal subset
+	last   [4]byte
+}
+
+// next scans c, it returns true if c is the Directive's closing '>'.
+func (s *directiveScanner) next(c byte) bool {
+	s.last = [4]byte{s.last[1], s.last[2], s.last[3], c}
+	switch {
+	case s.skip != "":
+		if string(s.last[len(s.last)-len(s.skip):]) == s.skip {
+			s.skip = ""
+		}
+	case s.quote != 0:
+		if c == s.quote {
+			s.quote = 0
+		}
+	case c == '"' || c == '\'':
+		s.quote = c
+	case c == '[':
+		s.subset++
+	case c == ']':
+		if s.subset > 0 {
+			s.subset--
+		}
+	case c == '>':
+		return s.subset == 0
+	case s.subset > 0 && string(s.last[:]) == "<!--":
+		s.skip, s.last = "-->", [4]byte{}
+	case s.subset > 0 && string(s.last[2:]) == "<?":
+		s.skip, s.last = "?>", [4]byte{}
+	}
+	return false
+}
+
+// spillable reports whether the token at pivot can be spilled on err.
+func (t *Tokenizer) spillable(err error, pivot, openclose int) bool {
+	return t.options.spill != nil && openclose > 0 && pivot+1 < len(t.buf) &&
+		(t.buf[pivot+1] == '!' || t.buf[pivot+1] == '?') &&
+		errors.Is(err, errAutoGrowBufferExceedMaxLimit)
+}
+
+// spillToken streams the token at pivot into spill in chunks, reusing the buffer
+// for every chunk, and sets the cursor right after the token's end.
+func (t *Tokenizer) spillToken(pivot int) error {
+	var open, term string
+	switch b := t.buf[pivot:]; {
+	case bytes.HasPrefix(b, []byte("<!--")):
+		open, term = "<!--", "-->"
+	case bytes.HasPrefix(b, []byte("<![CDATA[")):
+		open, term = "<![CDATA[", "]]>"
+	case bytes.HasPrefix(b, []byte("<?")):
+		open, term = "<?", "?>"
+	default:
+		open = "<!"
+	}
+
+	var ds directiveScanner // Only for a Directive, e.g. <!DOCTYPE x [ <!ENTITY y "z"> ]>
+	minEnd := pivot + len(open) + len(term)
+	for i := pivot + len(open); ; i++ {
+		if i >= len(t.buf) {
+			// The last bytes might be a part of the terminator, keep them.
+			keep := len(t.buf) - len(term) + 1
+			if len(term) == 0 {
+				keep = len(t.buf)
+			}
+			if err := t.options.spill(t.buf[pivot:keep], false); err != nil {
+				return err
+			}
+			t.countLines(t.n - int64(len(t.buf)) + int64(keep))
+			n := copy(t.buf, t.buf[keep:])
+			t.buf = t.buf[:n:cap(t.buf)]
+			pivot, i, minEnd, t.cur = 0, n, minEnd-keep, 0
+			if err := t.manageBuffer(); err != nil {
+				if errors.Is(err, io.EOF) {
+					err = truncated([]byte(open))
+				}
+				return err
+			}
+		}
+		if len(term) == 0 {
+			if !ds.next(t.buf[i]) {
+				continue
+			}
+		} else if t.buf[i] != '>' {
+			continue
+		} else if i+1 < minEnd || string(t.buf[i+1-len(term):i+1]) != term {
+			continue
+		}
+		t.cur = i + 1
+		return t.options.spill(t.buf[pivot:i+1], true)
+	}
+}
+
+// keepLeading keeps a copy of the whitespace between pivot and pos in lead when keepLead is set,
+// excluding the unused bytes preceding the first read.
+func (t *Tokenizer) keepLeading(pivot, pos int) {
+	if !t.keepLead {
+		return
+	}
+	if off := t.n - int64(len(t.buf)) + int64(pivot); off < 0 {
+		pivot -= int(off)
+	}
+	if pivot < pos {
+		t.lead = append(t.lead, t.buf[pivot:pos]...)
+	}
+}
+
+// isPadding reports whether the byte at pos is not a part of the document content,
+// i.e. the unused bytes preceding the first read or the UTF-8 byte order mark.
+func (t *Tokenizer) isPadding(pos int) bool {
+	const bom = "\xEF\xBB\xBF"
+	off := t.n - int64(len(t.buf)) + int64(pos)
+	return off < 0 || (off < int64(len(bom)) && t.buf[pos] == bom[off])
+}
+
 // parseCharData parses the next character sequence and if it represents
 // CharData or <![CDATA[ CharData ]]>, this method will include it in the previous token.
 // It returns the new pivot and new position.
 func (t *Tokenizer) parseCharData(pivot, pos int) (newPivot, newPos int) {
+	textStart := pos + 1
 	for i := pos + 1; ; i++ {
 		if i >= len(t.buf) {
+			textStart -= pivot // memmove shifts the bytes by pivot.
 			pivot, i = t.memmoveRemainingBytes(pivot)
 			pos = i - 1
 			if t.err = t.manageBuffer(); t.err != nil {
+				if errors.Is(t.err, errAutoGrowBufferExceedMaxLimit) {
+					t.textPending, t.textStart = true, textStart
+				}
 				break
 			}
 		}
@@ -216,21 +1715,32 @@ func (t *Tokenizer) parseCharData(pivot, pos int) (newPivot, newPos int) {
 		}
 
 		pos = i - 1
+		if t.options.noCDATA && !t.options.preserveWhitespace {
+			break
+		}
 		// Might be in the form of <![CDATA[ CharData ]]>
 		const prefix, suffix = "<![CDATA[", "]]>"
 		var k int = 1
+		var cdata bool
 		for j := i + 1; ; j++ {
 			if j >= len(t.buf) {
 				prevLast := len(t.buf)
 				pivot, j = t.memmoveRemainingBytes(pivot)
 				pos = pos - (prevLast - len(t.buf))
 				if t.err = t.manageBuffer(); t.err != nil {
+					if t.options.spill != nil && errors.Is(t.err, errAutoGrowBufferExceedMaxLimit) {
+						t.err = nil // Leave the CDATA for the next rawToken invocation to spill it.
+						return pivot, pos
+					}
 					if errors.Is(t.err, io.EOF) {
-						t.err = io.ErrUnexpectedEOF
+						t.err = truncated(t.buf[pos+1:]) // From '<', e.g. "<![CDATA[x"
 					}
 					break
 				}
 			}
+			if t.options.noCDATA { // Only the byte after '<' is needed, see isLeafEnd.
+				break
+			}
 			if k < len(prefix) {
 				if t.buf[j] != prefix[k] {
 					break
@@ -239,19 +1749,27 @@ func (t *Tokenizer) parseCharData(pivot, pos int) (newPivot, newPos int) {
 				continue
 			}
 			if t.buf[j] == '>' && string(t.buf[j-2:j+1]) == suffix {
-				pos = j
+				pos, cdata = j, true
 				break
 			}
 		}
+		if cdata && t.err == nil && t.options.mergeCharData {
+			i = pos // Continue to include the consecutive CharData and CDATA.
+			continue
+		}
 		break
 	}
 	return pivot, pos
 }
 
 func (t *Tokenizer) memmoveRemainingBytes(pivot int) (cur, last int) {
+	if t.fromBytes { // Never modify the caller's data, no more bytes will be read anyway.
+		return pivot, len(t.buf)
+	}
 	if pivot == 0 {
 		return t.cur, len(t.buf)
 	}
+	t.countLines(t.n - int64(len(t.buf)) + int64(pivot))
 	n := copy(t.buf, t.buf[pivot:])
 	t.buf = t.buf[:n:cap(t.buf)]
 	t.cur = 0
@@ -259,7 +1777,13 @@ func (t *Tokenizer) memmoveRemainingBytes(pivot int) (cur, last int) {
 }
 
 func (t *Tokenizer) manageBuffer() error {
-	growSize := len(t.buf) + t.options.readBufferSize
+	if t.fromBytes { // Every byte is already in the buffer.
+		return io.EOF
+	}
+	if t.r == nil {
+		return ErrNoReader
+	}
+	growSize := len(t.buf) + t.readSize()
 	start, end := len(t.buf), growSize
 	switch {
 	case growSize <= cap(t.buf): // Grow by reslice
@@ -275,20 +1799,126 @@ func (t *Tokenizer) manageBuffer() error {
 		start, end = n, cap(t.buf)
 	}
 
-	n, err := io.ReadAtLeast(t.r, t.buf[start:end], 1)
+	var r io.Reader = t.r
+	if t.ra != nil {
+		r = t.ra
+	}
+	n, err := io.ReadAtLeast(r, t.buf[start:end], 1)
 	t.buf = t.buf[: start+n : cap(t.buf)]
 	t.n += int64(n)
+	if t.lineEnding == "" && n > 0 {
+		t.detectLineEnding(t.buf[start : start+n])
+	}
+	if t.options.progress != nil && n > 0 {
+		t.options.progress(t.n)
+	}
 
 	return err
 }
 
+// readSize returns the number of bytes to be read on next manageBuffer invocation.
+func (t *Tokenizer) readSize() int {
+	size := t.options.readBufferSize
+	if !t.options.readerBufferReuse || t.ra != nil {
+		return size
+	}
+	r, ok := t.r.(interface{ Len() int })
+	if !ok {
+		return size
+	}
+	if n := r.Len(); n > size && len(t.buf)+n <= t.options.autoGrowBufferMaxLimitSize {
+		size = n
+	}
+	return size
+}
+
+// detectLineEnding detects the line ending from the first line terminator in b.
+func (t *Tokenizer) detectLineEnding(b []byte) {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		prev := t.lastByte
+		if i > 0 {
+			prev = b[i-1]
+		}
+		t.lineEnding = "\n"
+		if prev == '\r' {
+			t.lineEnding = "\r\n"
+		}
+		return
+	}
+	t.lastByte = b[len(b)-1]
+}
+
+// InputOffset returns the byte position in the input stream of the current token's start,
+// e.g. the '<' of a tag, or the "/>" of the self-closing tag of a synthetic end element.
+func (t *Tokenizer) InputOffset() int64 { return t.offset }
+
+// InputPos returns the line and the column, both are 1-based, of the current token's
+// start. The column is counted in bytes. It requires WithPositionTracking to be enabled,
+// otherwise, it always returns 1, 1.
+func (t *Tokenizer) InputPos() (line, column int) {
+	if !t.options.positionTracking {
+		return 1, 1
+	}
+	t.countLines(t.offset)
+	return t.line + 1, int(t.offset-t.lineStart) + 1
+}
+
+// countLines counts the line breaks up to the byte position to, the bytes must
+// still be in the buffer, so it is invoked before the bytes are discarded.
+func (t *Tokenizer) countLines(to int64) {
+	if !t.options.positionTracking || to <= t.counted {
+		return
+	}
+	base := t.n - int64(len(t.buf))
+	xml11 := t.decl.xml11
+	for i, c := range t.buf[t.counted-base : to-base] {
+		switch {
+		case c == '\n':
+		case xml11 && c == 0x85 && t.prev[1] == 0xC2: // NEL
+		case xml11 && c == 0xA8 && t.prev[1] == 0x80 && t.prev[0] == 0xE2: // LS
+		default:
+			t.prev[0], t.prev[1] = t.prev[1], c
+			continue
+		}
+		t.prev[0], t.prev[1] = t.prev[1], c
+		t.line++
+		t.lineStart = t.counted + int64(i) + 1
+	}
+	t.counted = to
+}
+
+// LineEnding returns the line ending of the document, "\r\n" or "\n", based on
+// the first line terminator read so far. It returns "\n" if none is found yet.
+func (t *Tokenizer) LineEnding() string {
+	if t.lineEnding == "" {
+		return "\n"
+	}
+	return t.lineEnding
+}
+
 func (t *Tokenizer) clearToken() {
 	t.token.Name.Prefix = nil
 	t.token.Name.Local = nil
 	t.token.Name.Full = nil
+	if c := cap(t.token.Attrs); c > maxRetainedAttrsBufferSize && c > t.options.attrsBufferSize {
+		t.token.Attrs = make([]Attr, 0, t.options.attrsBufferSize)
+	}
 	t.token.Attrs = t.token.Attrs[:0]
 	t.token.Data = nil
+	if t.token.x != nil { // Otherwise, no option sets the opt-in state.
+		t.extra.nsDecls = t.extra.nsDecls[:0]
+		t.extra.entities = t.extra.entities[:0]
+		t.extra.raw = nil
+		t.extra.attrsRaw = nil
+		t.extra.rawData = nil
+	}
+	t.charData = nil
+	t.malformedAttr = nil
+	if t.options.attrIndex {
+		t.attrIndex.reset()
+	}
 	t.token.SelfClosing = false
+	t.token.IsCDATA = false
 	t.token.IsEndElement = false
 }
 
@@ -299,85 +1929,491 @@ func (t *Tokenizer) consumeNonTagIdentifier(b []byte) []byte {
 	}
 	t.token.Data = b
 	t.token.SelfClosing = true
+	if t.options.commentTrim {
+		t.token.Data = t.trimComment(b)
+	}
 	return nil
 }
 
+// trimComment returns the comment b with the whitespace surrounding its content trimmed,
+// it returns b as is if b is not a comment or has nothing to trim.
+func (t *Tokenizer) trimComment(b []byte) []byte {
+	const prefix, suffix = "<!--", "-->"
+	if len(b) < len(prefix)+len(suffix) || string(b[:len(prefix)]) != prefix ||
+		string(b[len(b)-len(suffix):]) != suffix {
+		return b
+	}
+	content := b[len(prefix) : len(b)-len(suffix)]
+	trimmed := t.ws.trim(content)
+	if len(trimmed) == len(content) {
+		return b
+	}
+	t.scratch = append(t.scratch[:0], prefix...)
+	t.scratch = append(t.scratch, trimmed...)
+	t.scratch = append(t.scratch, suffix...)
+	return t.scratch
+}
+
 func (t *Tokenizer) consumeTagName(b []byte) []byte {
 	var pos, fullpos int
 	for i := 0; i < len(b); i++ {
 		switch b[i] {
 		case '<':
-			if b[i+1] == '/' {
+			j := i + 1
+			for j < len(b) && t.ws.is(b[j]) {
+				j++
+			}
+			if j < len(b) && b[j] == '/' { // A truncated token may end with '<'. Tolerate spacing, e.g. < / a>
 				t.token.IsEndElement = true
-				i++
+				for j++; j < len(b) && t.ws.is(b[j]); j++ {
+				}
+				i = j - 1
 			}
 			pos = i + 1
 			fullpos = i + 1
 		case ':':
-			t.token.Name.Prefix = trim(b[pos:i])
+			t.token.Name.Prefix = t.ws.trim(b[pos:i])
 			pos = i + 1
-		case '>', ' ': // e.g. <gpx>, <trkpt lat="-7.1872750" lon="110.3450230">
+		case '>', ' ', '\t', '\r', '\n': // e.g. <gpx>, <trkpt lat="-7.1872750" lon="110.3450230">, <trkpt\n lat="-7.1872750">
 			if b[i] == '>' && b[i-1] == '/' { // In case we encounter <name/>
 				i--
 			}
-			t.token.Name.Local = trim(b[pos:i])
-			t.token.Name.Full = trim(b[fullpos:i])
+			t.token.Name.Local = t.ws.trim(b[pos:i])
+			t.token.Name.Full = t.ws.trim(b[fullpos:i])
 			return b[i:]
+		default:
+			if t.ws != nil && t.ws[b[i]] { // The XML-standard whitespace is handled above.
+				t.token.Name.Local = t.ws.trim(b[pos:i])
+				t.token.Name.Full = t.ws.trim(b[fullpos:i])
+				return b[i:]
+			}
 		}
 	}
 	return b
 }
 
 func (t *Tokenizer) consumeAttrs(b []byte) []byte {
-	var prefix, local, full []byte
-	var pos, fullpos int
-	var inquote bool
+	if t.options.namesOnly { // Only the SelfClosing is needed.
+		b = t.consumeLazyAttrs(b)
+		t.extra.attrsRaw = nil
+		return b
+	}
+	if t.options.lazyAttrs {
+		return t.consumeLazyAttrs(b)
+	}
+	s := attrScanner{b: b, ws: t.ws}
+	for {
+		attr, ok := s.next()
+		if !ok {
+			break
+		}
+		if t.options.separateNamespaceDecls && isNamespaceDecl(&attr) {
+			t.extra.nsDecls = append(t.extra.nsDecls, attr)
+			continue
+		}
+		t.token.Attrs = append(t.token.Attrs, attr)
+	}
+	if t.options.sortAttrs {
+		sortAttrs(t.token.Attrs)
+		sortAttrs(t.extra.nsDecls)
+	}
+	if s.selfClosing {
+		t.token.SelfClosing = true
+	}
+	t.malformedAttr = s.malformed
+	return s.rest()
+}
+
+// sortAttrs stable sorts attrs by Name.Full using insertion sort, attrs are
+// usually few, so it does not allocate unlike sort.SliceStable.
+func sortAttrs(attrs []Attr) {
+	for i := 1; i < len(attrs); i++ {
+		for j := i; j > 0 && bytes.Compare(attrs[j].Name.Full, attrs[j-1].Name.Full) < 0; j-- {
+			attrs[j], attrs[j-1] = attrs[j-1], attrs[j]
+		}
+	}
+}
+
+// isNamespaceDecl reports whether attr is a namespace declaration, e.g. xmlns="ns" or xmlns:foo="ns".
+func isNamespaceDecl(attr *Attr) bool {
+	if len(attr.Name.Prefix) == 0 {
+		return string(attr.Name.Local) == "xmlns"
+	}
+	return string(attr.Name.Prefix) == "xmlns"
+}
+
+// consumeLazyAttrs only records the attributes region, the attributes
+// will be parsed on demand by Token's Attr method.
+func (t *Tokenizer) consumeLazyAttrs(b []byte) []byte {
+	var quote byte // the quote of the value being scanned, zero when not in a value
 	for i := range b {
 		switch b[i] {
-		case ':':
-			if !inquote {
-				prefix = trim(b[pos:i])
-				pos = i + 1
+		case quote:
+			quote = 0
+		case '"', '\'':
+			if quote == 0 {
+				quote = b[i]
 			}
-		case '=':
-			if !inquote {
-				local = trim(b[pos:i])
-				full = trim(b[fullpos:i])
-				pos = i + 1
-			}
-		case '"':
-			inquote = !inquote
-			if !inquote {
-				if len(full) == 0 { // Ignore malformed attr
-					continue
+		case '>':
+			if quote != 0 {
+				continue
+			}
+			if last := t.ws.trimSuffix(b[:i]); len(last) > 0 && last[len(last)-1] == '/' {
+				t.token.SelfClosing = true
+			}
+			t.extra.attrsRaw = b[:i]
+			return b[i+1:]
+		}
+	}
+	return b
+}
+
+// attrScanner scans attributes from the tag bytes that come after the tag name.
+type attrScanner struct {
+	b           []byte // bytes to scan
+	cur         int    // cursor byte position
+	end         int    // position right after '>', zero means '>' is not found yet
+	selfClosing bool   // true when '/' is found
+	malformed   []byte // the bytes starting from the first malformed attr that is ignored, e.g. ="ns2"
+	ws          *whitespace
+}
+
+// next returns the next attribute, ok is false when there is no more attribute.
+func (s *attrScanner) next() (attr Attr, ok bool) {
+	var prefix, local, full []byte
+	var pos, fullpos = s.cur, s.cur
+	var quote byte // the quote of the value being scanned, zero when not in a value
+	for i := s.cur; i < len(s.b); i++ {
+		if quote != 0 {
+			if s.b[i] != quote { // e.g. the " of b='it"s', it is a part of the value.
+				continue
+			}
+			quote = 0
+			if len(full) == 0 { // Ignore malformed attr
+				if s.malformed == nil {
+					s.malformed = s.ws.trimPrefix(s.b[fullpos:])
 				}
-				t.token.Attrs = append(t.token.Attrs, Attr{
-					Name:  Name{Prefix: prefix, Local: local, Full: full},
-					Value: trim(b[pos+1 : i]),
-				})
-				prefix, local, full = nil, nil, nil
-				pos = i + 1
-				fullpos = i + 1
+				continue
 			}
+			s.cur = i + 1
+			return Attr{
+				Name:  Name{Prefix: prefix, Local: local, Full: full},
+				Value: s.ws.trim(s.b[pos+1 : i]),
+			}, true
+		}
+		switch s.b[i] {
+		case ':':
+			prefix = s.ws.trim(s.b[pos:i])
+			pos = i + 1
+		case '=':
+			local = s.ws.trim(s.b[pos:i])
+			full = s.ws.trim(s.b[fullpos:i])
+			pos = i + 1
+		case '"', '\'':
+			quote = s.b[i]
+			pos = i // The value starts right after the quote.
 		case '/':
-			t.token.SelfClosing = true
+			s.selfClosing = true
 		case '>':
-			return b[i+1:]
+			s.cur, s.end = len(s.b), i+1
+			return attr, false
 		}
 	}
-	return b
+	s.cur = len(s.b)
+	return attr, false
+}
+
+// rest returns the remaining bytes after '>', or all the bytes if '>' is not found.
+func (s *attrScanner) rest() []byte {
+	if s.end == 0 {
+		return s.b
+	}
+	return s.b[s.end:]
 }
 
 func (t *Tokenizer) consumeCharData(b []byte) {
 	const prefix, suffix = "<![CDATA[", "]]>"
-	b = trimPrefix(b)
-	if len(b) >= len(prefix) && string(b[:len(prefix)]) == prefix {
-		b = b[len(prefix):]
+	t.charData = b
+	if t.options.namesOnly {
+		return
+	}
+	c := t.ws.trim(b)
+	if t.plain && bytes.IndexByte(c, '<') < 0 { // No CDATA section, the trimmed CharData is the Data.
+		t.token.Data = c
+		return
+	}
+	if t.options.rawCharData {
+		t.extra.rawData = c
+	}
+	if len(c) == 0 && len(b) > 0 && t.options.preserveWhitespace && t.isLeafEnd() {
+		t.token.Data = b // e.g. <sep> </sep>
+		return
+	}
+	if t.options.collectEntities {
+		t.collectEntities(c)
+	}
+	decode := t.options.entityDecoding
+	if i := bytes.Index(c, []byte(prefix)); i == 0 {
+		// Whitespace surrounding CDATA is insignificant, only its content is subject to trimming.
+		b = c[len(prefix):]
+		if end := bytes.Index(b, []byte(suffix)); end >= 0 {
+			if len(t.ws.trimPrefix(b[end+len(suffix):])) == 0 {
+				b, decode = b[:end], false
+				t.token.IsCDATA = true
+			} else if t.options.mergeCharData { // e.g. <![CDATA[text]]>more
+				// Only the whitespace preceding the CDATA section is insignificant, the trailing
+				// whitespace of the text is subject to trimming as if the Data started with text.
+				b, decode = t.mergeCharData(t.ws.trimPrefix(t.charData)), false
+			} else {
+				decode = false
+			}
+		}
+	} else if i > 0 { // e.g. text<![CDATA[more]]>
+		// Without WithMergeCharData, the CharData still ends with the first CDATA section, so
+		// both are merged into the logical text, its CDATA wrapper must not be in the Data.
+		b, decode = t.mergeCharData(b), false
+	}
+
+	switch t.options.trimMode {
+	case TrimNone:
+		t.token.Data = b
+	case TrimLeading:
+		t.token.Data = t.ws.trimPrefix(b)
+	case TrimTrailing:
+		t.token.Data = t.ws.trimSuffix(b)
+	default:
+		t.token.Data = t.ws.trim(b)
+	}
+
+	// The CharData is complete in the buffer by now, so no reference, e.g. &#x1F600;,
+	// is split even if the CharData is scanned across the buffer refills.
+	if decode && bytes.IndexByte(t.token.Data, '&') >= 0 {
+		t.token.Data = t.decode(t.token.Data)
+	}
+
+	if t.options.latin1Fallback && !utf8.Valid(t.token.Data) {
+		t.transcoded = appendLatin1Fallback(t.transcoded[:0], t.token.Data)
+		t.token.Data = t.transcoded
+	}
+}
+
+// windows1252 maps the bytes 0x80 to 0x9F of Windows-1252 to their runes, the undefined
+// bytes are mapped to the C1 control characters of the same value, like Latin-1 does.
+var windows1252 = [32]rune{
+	'\u20AC', '\u0081', '\u201A', '\u0192', '\u201E', '\u2026', '\u2020', '\u2021',
+	'\u02C6', '\u2030', '\u0160', '\u2039', '\u0152', '\u008D', '\u017D', '\u008F',
+	'\u0090', '\u2018', '\u2019', '\u201C', '\u201D', '\u2022', '\u2013', '\u2014',
+	'\u02DC', '\u2122', '\u0161', '\u203A', '\u0153', '\u009D', '\u017E', '\u0178',
+}
+
+// appendLatin1Fallback appends b into dst, transcoding every byte that is not a part of
+// a valid UTF-8 sequence from Windows-1252 into UTF-8.
+func appendLatin1Fallback(dst, b []byte) []byte {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r != utf8.RuneError || size > 1 {
+			dst, b = append(dst, b[:size]...), b[size:]
+			continue
+		}
+		r = rune(b[0])
+		if 0x80 <= r && r < 0xA0 {
+			r = windows1252[r-0x80]
+		}
+		dst, b = utf8.AppendRune(dst, r), b[1:]
+	}
+	return dst
+}
+
+// isLeafEnd reports whether the current token is a start element immediately followed by
+// an end element after its CharData, i.e. the CharData is the entire content of a leaf element.
+func (t *Tokenizer) isLeafEnd() bool {
+	if len(t.token.Name.Full) == 0 || t.token.SelfClosing || t.token.IsEndElement {
+		return false
+	}
+	return t.cur+1 < len(t.buf) && t.buf[t.cur] == '<' && t.buf[t.cur+1] == '/'
+}
+
+// decode appends the entity-decoded b into the decoded buffer and returns it.
+func (t *Tokenizer) decode(b []byte) []byte {
+	start := len(t.decoded)
+	t.decoded = appendDecoded(t.decoded, b)
+	return t.decoded[start:len(t.decoded):len(t.decoded)]
+}
+
+// decodeAttrs decodes the entities of the attribute values.
+func (t *Tokenizer) decodeAttrs(attrs []Attr) {
+	for i := range attrs {
+		if bytes.IndexByte(attrs[i].Value, '&') >= 0 {
+			attrs[i].Value = t.decode(attrs[i].Value)
+		}
+	}
+}
+
+// appendDecoded appends b into dst with its entities decoded, CDATA sections are
+// appended as is, e.g. "a &amp; b<![CDATA[&amp;]]>" becomes "a & b<![CDATA[&amp;]]>".
+func appendDecoded(dst, b []byte) []byte {
+	const prefix, suffix = "<![CDATA[", "]]>"
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '&')
+		if i < 0 {
+			return append(dst, b...)
+		}
+		if j := bytes.Index(b[:i], []byte(prefix)); j >= 0 {
+			end := bytes.Index(b[j:], []byte(suffix))
+			if end < 0 {
+				return append(dst, b...)
+			}
+			end += j + len(suffix)
+			dst, b = append(dst, b[:end]...), b[end:]
+			continue
+		}
+		dst, b = append(dst, b[:i]...), b[i:]
+		r, n := decodeEntity(b)
+		if n == 0 { // Unknown or malformed, keep as is.
+			dst, b = append(dst, '&'), b[1:]
+			continue
+		}
+		dst, b = utf8.AppendRune(dst, r), b[n:]
+	}
+	return dst
+}
+
+// decodeEntity decodes the entity at the start of b, e.g. &amp; or &#169; or &#xA9;,
+// it returns the rune and the length of the entity, n is zero if it is not valid.
+func decodeEntity(b []byte) (r rune, n int) {
+	const maxLen = len("&#x10FFFF;")
+	if len(b) > maxLen {
+		b = b[:maxLen]
+	}
+	end := bytes.IndexByte(b, ';')
+	if end < 2 {
+		return 0, 0
+	}
+	switch name := b[1:end]; string(name) {
+	case "lt":
+		return '<', end + 1
+	case "gt":
+		return '>', end + 1
+	case "amp":
+		return '&', end + 1
+	case "quot":
+		return '"', end + 1
+	case "apos":
+		return '\'', end + 1
+	default:
+		if name[0] != '#' || len(name) < 2 {
+			return 0, 0
+		}
+		digits, base := name[1:], rune(10)
+		if digits[0] == 'x' {
+			digits, base = digits[1:], 16
+		}
+		if len(digits) == 0 {
+			return 0, 0
+		}
+		for _, c := range digits {
+			var d rune
+			switch {
+			case '0' <= c && c <= '9':
+				d = rune(c - '0')
+			case base == 16 && 'a' <= c && c <= 'f':
+				d = rune(c-'a') + 10
+			case base == 16 && 'A' <= c && c <= 'F':
+				d = rune(c-'A') + 10
+			default:
+				return 0, 0
+			}
+			r = r*base + d
+		}
+		if r == 0 || !utf8.ValidRune(r) {
+			return 0, 0
+		}
+		return r, end + 1
+	}
+}
+
+// mergeCharData merges the consecutive CharData and CDATA sections of b into scratch.
+func (t *Tokenizer) mergeCharData(b []byte) []byte {
+	const prefix, suffix = "<![CDATA[", "]]>"
+	t.scratch = t.scratch[:0]
+	for len(b) > 0 {
+		i := bytes.Index(b, []byte(prefix))
+		if i < 0 {
+			t.scratch = t.appendText(t.scratch, b)
+			break
+		}
+		t.scratch = t.appendText(t.scratch, b[:i])
+		b = b[i+len(prefix):]
+		end := bytes.Index(b, []byte(suffix))
+		if end < 0 {
+			t.scratch = append(t.scratch, b...)
+			break
+		}
+		t.scratch = append(t.scratch, b[:end]...)
+		b = b[end+len(suffix):]
+	}
+	return t.scratch
+}
+
+// appendText appends the text b into dst, decoding its entities if WithEntityDecoding is enabled.
+func (t *Tokenizer) appendText(dst, b []byte) []byte {
+	if t.options.entityDecoding {
+		return appendDecoded(dst, b)
+	}
+	return append(dst, b...)
+}
+
+// whitespace is a set of whitespace chars, a nil whitespace is the XML-standard whitespace.
+type whitespace [256]bool
+
+// newWhitespace returns the XML-standard whitespace extended with chars, it returns nil if
+// chars is empty, so the XML-standard whitespace can be trimmed without a lookup.
+func newWhitespace(chars string) *whitespace {
+	if len(chars) == 0 {
+		return nil
+	}
+	w := &whitespace{'\r': true, '\n': true, ' ': true, '\t': true}
+	for i := 0; i < len(chars); i++ {
+		if chars[i] < utf8.RuneSelf {
+			w[chars[i]] = true
+		}
+	}
+	return w
+}
+
+// is reports whether c is a whitespace.
+func (w *whitespace) is(c byte) bool {
+	if w == nil {
+		return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+	}
+	return w[c]
+}
+
+func (w *whitespace) trim(b []byte) []byte {
+	if w == nil {
+		return trim(b)
 	}
-	if end := len(b) - len(suffix); end >= 0 && string(b[end:]) == suffix {
-		b = b[:end]
+	return w.trimSuffix(w.trimPrefix(b))
+}
+
+func (w *whitespace) trimPrefix(b []byte) []byte {
+	if w == nil {
+		return trimPrefix(b)
+	}
+	for len(b) > 0 && w[b[0]] {
+		b = b[1:]
+	}
+	return b
+}
+
+func (w *whitespace) trimSuffix(b []byte) []byte {
+	if w == nil {
+		return trimSuffix(b)
+	}
+	for len(b) > 0 && w[b[len(b)-1]] {
+		b = b[:len(b)-1]
 	}
-	t.token.Data = trim(b)
+	return b
 }
 
 func trim(b []byte) []byte {
@@ -386,38 +2422,29 @@ func trim(b []byte) []byte {
 	return b
 }
 
+// trimPrefix trims the leading XML-standard whitespace, a line break is trimmed whether it is
+// LF, CRLF or a lone CR, e.g. of a classic Mac OS file or a file of mixed line endings.
 func trimPrefix(b []byte) []byte {
-	var start int
-	for i := 0; i < len(b); i++ {
-		switch b[i] {
-		case '\r':
-			if i+1 < len(b) && b[i+1] == '\n' {
-				start += 2
-				i++
-			}
-		case '\n', ' ', '\t':
-			start++
+	for len(b) > 0 {
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			b = b[1:]
 		default:
-			return b[start:]
+			return b
 		}
 	}
-	return b[start:]
+	return b
 }
 
+// trimSuffix trims the trailing XML-standard whitespace, see trimPrefix.
 func trimSuffix(b []byte) []byte {
-	var end int = len(b)
-	for i := len(b) - 1; i >= 0; i-- {
-		switch b[i] {
-		case '\n':
-			end--
-			if i-1 > 0 && b[i-1] == '\r' {
-				end--
-			}
-		case ' ', '\t':
-			end--
+	for len(b) > 0 {
+		switch b[len(b)-1] {
+		case ' ', '\t', '\r', '\n':
+			b = b[:len(b)-1]
 		default:
-			return b[:end]
+			return b
 		}
 	}
-	return b[:end]
+	return b
 }
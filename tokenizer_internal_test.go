@@ -2,10 +2,13 @@ package xmltokenizer
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -28,9 +31,9 @@ func TestOptions(t *testing.T) {
 				WithAutoGrowBufferMaxLimitSize(-1),
 			},
 			expectedOptions: options{
-				readBufferSize:             defaultReadBufferSize,
-				autoGrowBufferMaxLimitSize: autoGrowBufferMaxLimitSize,
-				attrsBufferSize:            defaultAttrsBufferSize,
+				readBufferSize:             4 << 10,
+				autoGrowBufferMaxLimitSize: 1000 << 10,
+				attrsBufferSize:            16,
 			},
 		},
 		{
@@ -42,7 +45,7 @@ func TestOptions(t *testing.T) {
 			expectedOptions: options{
 				readBufferSize:             4 << 10,
 				autoGrowBufferMaxLimitSize: 4 << 10,
-				attrsBufferSize:            defaultAttrsBufferSize,
+				attrsBufferSize:            16,
 			},
 		},
 	}
@@ -112,10 +115,221 @@ func TestAutoGrowBuffer(t *testing.T) {
 	}
 }
 
+func TestRetainedAttrsBufferSize(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("<root>")
+	sb.WriteString("<a")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&sb, " a%d=\"%d\"", i, i)
+	}
+	sb.WriteString("/>")
+	sb.WriteString(`<b x="1" y="2"/>`)
+	sb.WriteString("</root>")
+
+	tt := []struct {
+		name        string
+		opts        []Option
+		expectedCap int
+	}{
+		{name: "default", expectedCap: DefaultAttrsBufferSize},
+		{name: "custom beyond soft maximum", opts: []Option{WithAttrBufferSize(2000)}, expectedCap: 2000},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tok := New(strings.NewReader(sb.String()), tc.opts...)
+			tok.Token() // root
+
+			token, _ := tok.Token()
+			if len(token.Attrs) != 1000 {
+				t.Fatalf("expected len(Attrs): %d, got: %d", 1000, len(token.Attrs))
+			}
+
+			token, _ = tok.Token()
+			if len(token.Attrs) != 2 {
+				t.Fatalf("expected len(Attrs): %d, got: %d", 2, len(token.Attrs))
+			}
+			if c := cap(tok.token.Attrs); c != tc.expectedCap {
+				t.Fatalf("expected cap(Attrs): %d, got: %d", tc.expectedCap, c)
+			}
+		})
+	}
+
+	t.Run("PutToken", func(t *testing.T) {
+		token := &Token{Attrs: make([]Attr, 1000)}
+		PutToken(token)
+		if token.Attrs != nil {
+			t.Fatalf("expected Attrs is released, got cap: %d", cap(token.Attrs))
+		}
+
+		token = &Token{Attrs: make([]Attr, 0, DefaultAttrsBufferSize)}
+		PutToken(token)
+		if cap(token.Attrs) != DefaultAttrsBufferSize {
+			t.Fatalf("expected cap(Attrs): %d, got: %d", DefaultAttrsBufferSize, cap(token.Attrs))
+		}
+	})
+
+	t.Run("steady state allocs", func(t *testing.T) {
+		r := strings.NewReader(`<b x="1" y="2"/>`)
+		tok := New(r)
+		alloc := testing.AllocsPerRun(10, func() {
+			r.Reset(`<b x="1" y="2"/>`)
+			tok.Reset(r)
+			tok.Token()
+		})
+		if alloc != 0 {
+			t.Fatalf("expected alloc: 0, got: %g", alloc)
+		}
+	})
+}
+
+func TestTrim(t *testing.T) {
+	tt := []struct {
+		in       string
+		prefix   string
+		suffix   string
+		expected string
+	}{
+		{in: "x\r\n", prefix: "x\r\n", suffix: "x", expected: "x"},
+		{in: "\r\n", prefix: "", suffix: "", expected: ""},
+		{in: "\r\nx", prefix: "x", suffix: "\r\nx", expected: "x"},
+		{in: "x \r\n", prefix: "x \r\n", suffix: "x", expected: "x"},
+		{in: "x\r\n\r\n", prefix: "x\r\n\r\n", suffix: "x", expected: "x"},
+		{in: " \t\nx y\n\t ", prefix: "x y\n\t ", suffix: " \t\nx y", expected: "x y"},
+		{in: "x\r", prefix: "x\r", suffix: "x", expected: "x"},
+		{in: "x\n", prefix: "x\n", suffix: "x", expected: "x"},
+		{in: "\r", prefix: "", suffix: "", expected: ""},
+		{in: "\rx", prefix: "x", suffix: "\rx", expected: "x"},
+		{in: "\r x \r", prefix: "x \r", suffix: "\r x", expected: "x"},
+		{in: "x\n\r\r\n", prefix: "x\n\r\r\n", suffix: "x", expected: "x"},
+		{in: "x\ry\r", prefix: "x\ry\r", suffix: "x\ry", expected: "x\ry"},
+	}
+
+	for _, tc := range tt {
+		t.Run(fmt.Sprintf("%q", tc.in), func(t *testing.T) {
+			if s := string(trimPrefix([]byte(tc.in))); s != tc.prefix {
+				t.Fatalf("trimPrefix: expected: %q, got: %q", tc.prefix, s)
+			}
+			if s := string(trimSuffix([]byte(tc.in))); s != tc.suffix {
+				t.Fatalf("trimSuffix: expected: %q, got: %q", tc.suffix, s)
+			}
+			if s := string(trim([]byte(tc.in))); s != tc.expected {
+				t.Fatalf("trim: expected: %q, got: %q", tc.expected, s)
+			}
+		})
+	}
+}
+
+func TestMaxRetainedBuffer(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "ride_bedugul_laps.tcx"))
+	if err != nil {
+		panic(err)
+	}
+
+	tok := New(strings.NewReader(string(data)), WithReaderBufferReuse(true)) // Grow the buffer to the file size.
+	for {
+		if _, err := tok.Token(); err != nil {
+			break
+		}
+	}
+	if grown := cap(tok.buf); grown < 64<<10 {
+		t.Fatalf("expected the buffer to grow, got cap: %d", grown)
+	}
+
+	tok.Reset(strings.NewReader("<a/>"))
+	if cap(tok.buf) < 64<<10 {
+		t.Fatalf("expected the buffer to be retained by default, got cap: %d", cap(tok.buf))
+	}
+
+	tok.Reset(strings.NewReader("<a/>"), WithMaxRetainedBuffer(16<<10))
+	if cap(tok.buf) > 16<<10 {
+		t.Fatalf("expected the buffer to shrink, got cap: %d", cap(tok.buf))
+	}
+	token, err := tok.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(token.Name.Local) != "a" {
+		t.Fatalf("expected: a, got: %s", token.Name.Local)
+	}
+}
+
+func TestCDATAAliasesBuffer(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "cdata.xml"))
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	tok := New(f)
+	var n int
+	for {
+		token, err := tok.Token()
+		if err != nil {
+			break
+		}
+		if !token.IsCDATA {
+			continue
+		}
+		n++
+		buf := tok.buf[:cap(tok.buf)]
+		if !inRange(buf, token.Data) {
+			t.Fatalf("expected CDATA body %q to alias the buffer", token.Data)
+		}
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 CDATA, got: %d", n)
+	}
+}
+
+// inRange reports whether b is a subslice of buf.
+func inRange(buf, b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for i := 0; i+len(b) <= len(buf); i++ {
+		if &buf[i] == &b[0] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestConsumeTagNameTrailingOpenBracket(t *testing.T) {
+	for _, in := range []string{"<", "<a><", "</"} {
+		t.Run(fmt.Sprintf("%q", in), func(t *testing.T) {
+			tok := New(nil)
+			tok.consumeTagName([]byte(in)) // Must not panic.
+		})
+	}
+}
+
 type fnReader func(b []byte) (n int, err error)
 
 func (f fnReader) Read(b []byte) (n int, err error) { return f(b) }
 
+func TestAppendLatin1Fallback(t *testing.T) {
+	tt := []struct {
+		name     string
+		in       string
+		expected string
+	}{
+		{name: "valid utf-8", in: "caf\u00e9 \ufffd", expected: "caf\u00e9 \ufffd"},
+		{name: "windows-1252", in: "\x80 \x92 \x9f", expected: "\u20ac \u2019 \u0178"},
+		{name: "undefined windows-1252", in: "\x81", expected: "\u0081"},
+		{name: "latin-1", in: "\xe9\xff", expected: "\u00e9\u00ff"},
+		{name: "incomplete sequence", in: "\xe2\x80", expected: "\u00e2\u20ac"},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			if out := string(appendLatin1Fallback(nil, []byte(tc.in))); out != tc.expected {
+				t.Fatalf("expected: %q, got: %q", tc.expected, out)
+			}
+		})
+	}
+}
+
 func TestReset(t *testing.T) {
 	r := fnReader(func(b []byte) (n int, err error) { return len(b), nil })
 	tok := New(r)
@@ -149,7 +363,137 @@ func TestReset(t *testing.T) {
 	if expected := newBufferSize; len(tok.buf) != expected {
 		t.Fatalf("expected len(t.buf): %d, got: %d", expected, len(tok.buf))
 	}
-	if expected := newBufferSize + defaultReadBufferSize; cap(tok.buf) != expected {
+	if expected := newBufferSize + DefaultReadBufferSize; cap(tok.buf) != expected {
 		t.Fatalf("expected len(t.buf): %d, got: %d", expected, len(tok.buf))
 	}
 }
+
+// endlessReader repeats data forever, so the goroutine of WithReadAhead never exits on its own.
+type endlessReader struct {
+	data string
+	off  int
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.data[r.off%len(r.data)]
+		r.off++
+	}
+	return len(p), nil
+}
+
+func TestReadAheadStop(t *testing.T) {
+	tt := []struct {
+		name string
+		r    io.Reader
+		opts []Option
+		next func(tok *Tokenizer) error
+		err  error
+	}{
+		{
+			name: "close",
+			r:    &endlessReader{data: "<a/>"},
+			next: func(tok *Tokenizer) error {
+				if _, err := tok.Token(); err != nil {
+					return err
+				}
+				tok.Close()
+				_, err := tok.Token()
+				return err
+			},
+			err: ErrClosed,
+		},
+		{
+			name: "syntax error",
+			r:    &endlessReader{data: "<a/>"},
+			opts: []Option{WithStrict(true)},
+			next: func(tok *Tokenizer) error {
+				for {
+					if _, err := tok.Token(); err != nil {
+						return err
+					}
+				}
+			},
+			err: ErrContentAfterRoot,
+		},
+		{
+			name: "raw token exceeds the buffer limit",
+			r:    &endlessReader{data: "<a"},
+			opts: []Option{WithReadBufferSize(64), WithAutoGrowBufferMaxLimitSize(256)},
+			next: func(tok *Tokenizer) error {
+				_, err := tok.RawToken()
+				return err
+			},
+			err: errAutoGrowBufferExceedMaxLimit,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := New(tc.r, append(tc.opts, WithReadAhead(true))...)
+			ra := tok.ra
+			if err := tc.next(tok); !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if tok.ra != nil {
+				t.Fatalf("expected the read ahead to be stopped")
+			}
+			select { // The stop does not wait for an in-flight read, the goroutine exits once it returns.
+			case <-ra.exited:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected the goroutine to exit")
+			}
+		})
+	}
+
+	t.Run("blocking read", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		tok := New(pr, WithReadAhead(true))
+		ra := tok.ra
+		closed := make(chan struct{})
+		go func() {
+			tok.Close() // Must not wait for the read of pr that never returns.
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected Close to return while the read is in-flight")
+		}
+		pw.Close() // Releases the read, so the goroutine exits.
+		select {
+		case <-ra.exited:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the goroutine to exit")
+		}
+	})
+
+	t.Run("buffers are reused by reset", func(t *testing.T) {
+		tok := New(strings.NewReader("<a/>"), WithReadBufferSize(64), WithReadAhead(true))
+		for {
+			if _, err := tok.Token(); err != nil {
+				break
+			}
+		}
+		<-tok.ra.exited // Exited on io.EOF, so stop does not find it reading.
+		tok.Close()
+		if len(tok.raBufs) != 2 {
+			t.Fatalf("expected 2 buffers to be taken back, got: %d", len(tok.raBufs))
+		}
+		bufs := map[*byte]bool{&tok.raBufs[0][:1][0]: true, &tok.raBufs[1][:1][0]: true}
+
+		tok.Reset(strings.NewReader("<b/>"), WithReadBufferSize(64), WithReadAhead(true))
+		for {
+			if _, err := tok.Token(); err != nil {
+				break
+			}
+		}
+		<-tok.ra.exited
+		tok.Close()
+		for _, buf := range tok.raBufs {
+			if !bufs[&buf[:1][0]] {
+				t.Fatalf("expected the buffers of the previous read ahead to be reused")
+			}
+		}
+	})
+}
@@ -2,6 +2,7 @@ package xmltokenizer_test
 
 import (
 	"bytes"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
@@ -10,17 +11,30 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/muktihari/xmltokenizer"
 	"github.com/muktihari/xmltokenizer/internal/gpx"
+	gpxschema "github.com/muktihari/xmltokenizer/internal/gpx/schema"
+	"github.com/muktihari/xmltokenizer/internal/plist"
+	"github.com/muktihari/xmltokenizer/internal/tcx"
 	"github.com/muktihari/xmltokenizer/internal/xlsx"
 	"github.com/muktihari/xmltokenizer/internal/xlsx/schema"
 )
 
 var tokenHeader = xmltokenizer.Token{Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>`), SelfClosing: true}
 
+// ignoreUnexported ignores Token's unexported fields that hold internal state.
+var ignoreUnexported = cmpopts.IgnoreUnexported(xmltokenizer.Token{})
+
+// ignoreIsCDATA ignores Token's IsCDATA, it is tested separately in TestIsCDATA.
+var ignoreIsCDATA = cmpopts.IgnoreFields(xmltokenizer.Token{}, "IsCDATA")
+
 func TestTokenWithInmemXML(t *testing.T) {
 	tt := []struct {
 		name      string
@@ -131,6 +145,29 @@ func TestTokenWithInmemXML(t *testing.T) {
 			},
 			err: io.ErrUnexpectedEOF,
 		},
+		{
+			name: "right angle bracket inside attribute value",
+			xml:  `<sample path="foo>bar">text</sample>`,
+			expecteds: []xmltokenizer.Token{
+				{
+					Name: xmltokenizer.Name{Local: []byte("sample"), Full: []byte("sample")},
+					Attrs: []xmltokenizer.Attr{
+						{Name: xmltokenizer.Name{Local: []byte("path"), Full: []byte("path")}, Value: []byte("foo>bar")},
+					},
+					Data: []byte("text"),
+				},
+				{Name: xmltokenizer.Name{Local: []byte("sample"), Full: []byte("sample")}, IsEndElement: true},
+			},
+		},
+		{
+			name: "byte order mark",
+			xml:  "\xEF\xBB\xBF<?xml version=\"1.0\" encoding=\"UTF-8\"?><a>text</a>",
+			expecteds: []xmltokenizer.Token{
+				tokenHeader,
+				{Name: xmltokenizer.Name{Local: []byte("a"), Full: []byte("a")}, Data: []byte("text")},
+				{Name: xmltokenizer.Name{Local: []byte("a"), Full: []byte("a")}, IsEndElement: true},
+			},
+		},
 		{
 			name: "unexpected quote before attr name",
 			xml:  "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a =\"ns2\"></a>",
@@ -187,7 +224,7 @@ func TestTokenWithInmemXML(t *testing.T) {
 					}
 					return
 				}
-				if diff := cmp.Diff(token, tc.expecteds[i]); diff != "" {
+				if diff := cmp.Diff(token, tc.expecteds[i], ignoreUnexported, ignoreIsCDATA); diff != "" {
 					t.Fatalf("%d: %s", i, diff)
 				}
 			}
@@ -265,6 +302,30 @@ func TestTokenWithSmallXMLFiles(t *testing.T) {
 				IsEndElement: true,
 			},
 		}},
+		{filename: "cdata_after_text.xml", expecteds: []xmltokenizer.Token{
+			tokenHeader,
+			{Name: xmltokenizer.Name{Local: []byte("content"), Full: []byte("content")}},
+			{
+				Name: xmltokenizer.Name{Local: []byte("data"), Full: []byte("data")},
+				Data: []byte("text <element>"),
+			},
+			{
+				Name:         xmltokenizer.Name{Local: []byte("data"), Full: []byte("data")},
+				IsEndElement: true,
+			},
+			{
+				Name: xmltokenizer.Name{Local: []byte("data"), Full: []byte("data")},
+				Data: []byte("a &amp; b & c"),
+			},
+			{
+				Name:         xmltokenizer.Name{Local: []byte("data"), Full: []byte("data")},
+				IsEndElement: true,
+			},
+			{
+				Name:         xmltokenizer.Name{Local: []byte("content"), Full: []byte("content")},
+				IsEndElement: true,
+			},
+		}},
 		{filename: filepath.Join("corrupted", "cdata_truncated.xml"), expecteds: []xmltokenizer.Token{
 			tokenHeader,
 			{Name: xmltokenizer.Name{Local: []byte("content"), Full: []byte("content")}},
@@ -283,6 +344,20 @@ func TestTokenWithSmallXMLFiles(t *testing.T) {
 			{Data: []byte("<!--\n  Copyright 2024 Example Licence Authors.\n-->"), SelfClosing: true},
 			tokenHeader,
 		}},
+		{filename: "comment_in_content.xml", expecteds: []xmltokenizer.Token{
+			tokenHeader,
+			{Name: xmltokenizer.Name{Local: []byte("content"), Full: []byte("content")}},
+			{Name: xmltokenizer.Name{Local: []byte("p"), Full: []byte("p")}, Data: []byte("before")},
+			{Data: []byte("<!-- c -->"), SelfClosing: true},
+			{Data: []byte("after")},
+			{Name: xmltokenizer.Name{Local: []byte("p"), Full: []byte("p")}, IsEndElement: true},
+			{Name: xmltokenizer.Name{Local: []byte("p"), Full: []byte("p")}, Data: []byte("a &gt; b")},
+			{Data: []byte("<?pi data?>"), SelfClosing: true},
+			{Data: []byte("and more")},
+			{Name: xmltokenizer.Name{Local: []byte("p"), Full: []byte("p")}, IsEndElement: true},
+			{Name: xmltokenizer.Name{Local: []byte("content"), Full: []byte("content")}, IsEndElement: true},
+			{Data: []byte("<!-- trailing comment -->"), SelfClosing: true},
+		}},
 		{filename: "dtd.xml", expecteds: []xmltokenizer.Token{
 			tokenHeader,
 			{
@@ -330,7 +405,7 @@ func TestTokenWithSmallXMLFiles(t *testing.T) {
 					return
 				}
 
-				if diff := cmp.Diff(token, tc.expecteds[i]); diff != "" {
+				if diff := cmp.Diff(token, tc.expecteds[i], ignoreUnexported, ignoreIsCDATA); diff != "" {
 					t.Fatal(diff)
 				}
 			}
@@ -338,160 +413,3860 @@ func TestTokenWithSmallXMLFiles(t *testing.T) {
 	}
 }
 
-func TestTokenOnGPXFiles(t *testing.T) {
-	filepath.Walk("testdata", func(path string, info fs.FileInfo, _ error) error {
-		t.Run(path, func(t *testing.T) {
-			if info.IsDir() {
-				return
-			}
-			if strings.ToLower(filepath.Ext(path)) != ".gpx" {
-				return
-			}
-
-			data, err := os.ReadFile(path)
-			if err != nil {
-				t.Skip(err)
-			}
+func TestRawData(t *testing.T) {
+	tt := []struct {
+		name      string
+		opts      []xmltokenizer.Option
+		expecteds []string
+	}{
+		{
+			name: "with raw char data",
+			opts: []xmltokenizer.Option{xmltokenizer.WithRawCharData(true)},
+			expecteds: []string{
+				"<![CDATA[ text ]]>",
+				"<![CDATA[<element>text</element>]]>",
+				"<![CDATA[\n      <element>text</element>\n    ]]>",
+			},
+		},
+		{
+			name:      "without raw char data",
+			expecteds: []string{"", "", ""},
+		},
+	}
 
-			gpx1, err := gpx.UnmarshalWithXMLTokenizer(bytes.NewReader(data))
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", "cdata.xml"))
 			if err != nil {
-				t.Fatalf("xmltokenizer: %v", err)
+				panic(err)
 			}
+			defer f.Close()
 
-			gpx2, err := gpx.UnmarshalWithStdlibXML(bytes.NewReader(data))
-			if err != nil {
-				t.Fatalf("xml: %v", err)
+			tok := xmltokenizer.New(f, append(tc.opts, xmltokenizer.WithReadBufferSize(1))...)
+			var rawData []string
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(token.Name.Local) == "data" && !token.IsEndElement {
+					rawData = append(rawData, string(token.RawData()))
+				}
 			}
 
-			if diff := cmp.Diff(gpx1, gpx2,
-				cmp.Transformer("float64", func(x float64) uint64 {
-					return math.Float64bits(x)
-				}),
-			); diff != "" {
+			if diff := cmp.Diff(rawData, tc.expecteds); diff != "" {
 				t.Fatal(diff)
 			}
 		})
-
-		return nil
-	})
-}
-
-func TestTokenOnXLSXFiles(t *testing.T) {
-	path := filepath.Join("testdata", "xlsx_sheet1.xml")
-
-	data, err := os.ReadFile(path)
-	if err != nil {
-		t.Skip(err)
-	}
-
-	sheet1, err := xlsx.UnmarshalWithXMLTokenizer(bytes.NewReader(data))
-	if err != nil {
-		t.Fatalf("xmltokenizer: %v", err)
-	}
-	sheet2, err := xlsx.UnmarshalWithStdlibXML(bytes.NewReader(data))
-	if err != nil {
-		t.Fatalf("xml: %v", err)
-	}
-
-	if diff := cmp.Diff(sheet1, sheet2); diff != "" {
-		t.Fatal(diff)
 	}
 }
 
-func TestAutoGrowBufferCorrectness(t *testing.T) {
-	path := filepath.Join("testdata", "xlsx_sheet1.xml")
-	f, err := os.Open(path)
+func TestLazyAttrs(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "xlsx_sheet1.xml"))
 	if err != nil {
 		panic(err)
 	}
-	defer f.Close()
 
-	tok := xmltokenizer.New(f,
+	eager := xmltokenizer.New(bytes.NewReader(data))
+	lazy := xmltokenizer.New(bytes.NewReader(data),
 		xmltokenizer.WithReadBufferSize(1),
+		xmltokenizer.WithLazyAttrs(true),
 	)
 
-	var token xmltokenizer.Token
-	var sheetData1 schema.SheetData
-loop:
 	for {
-		token, err = tok.Token()
-		if err == io.EOF {
+		token1, err1 := eager.Token()
+		token2, err2 := lazy.Token()
+		if err1 != err2 {
+			t.Fatalf("expected error: %v, got: %v", err1, err2)
+		}
+		if err1 == io.EOF {
 			break
 		}
-		if err != nil {
-			t.Fatal(err)
+		if err1 != nil {
+			t.Fatal(err1)
 		}
 
-		switch string(token.Name.Local) {
-		case "sheetData":
-			se := xmltokenizer.GetToken().Copy(token)
-			err = sheetData1.UnmarshalToken(tok, se)
-			xmltokenizer.PutToken(se)
-			if err != nil {
-				t.Fatal(err)
+		if token2.Attrs != nil {
+			t.Fatalf("expected nil Attrs, got: %v", token2.Attrs)
+		}
+		if token1.SelfClosing != token2.SelfClosing {
+			t.Fatalf("%s: expected SelfClosing: %t, got: %t",
+				token1.Name.Full, token1.SelfClosing, token2.SelfClosing)
+		}
+		for _, attr := range token1.Attrs {
+			attr2, ok := token2.Attr(string(attr.Name.Local))
+			if !ok {
+				t.Fatalf("%s: attr %q is not found", token1.Name.Full, attr.Name.Full)
+			}
+			if diff := cmp.Diff(attr2, attr); diff != "" {
+				t.Fatal(diff)
 			}
-			break loop
+		}
+		if _, ok := token2.Attr("unknown"); ok {
+			t.Fatalf("expected attr is not found")
 		}
 	}
+}
 
-	f2, err := os.Open(path)
-	if err != nil {
-		panic(err)
+func TestContentAfterRoot(t *testing.T) {
+	tt := []struct {
+		name   string
+		xml    string
+		strict bool
+		opts   []xmltokenizer.Option
+		offset int64
+		err    error
+	}{
+		{
+			name:   "trailing comment",
+			xml:    "<?xml version=\"1.0\"?>\n<body><goodbye /></body><!-- missing final newline -->",
+			strict: true,
+		},
+		{
+			name:   "trailing element",
+			xml:    "<?xml version=\"1.0\"?>\n<body><goodbye /></body><extra/>",
+			strict: true,
+			offset: 46,
+			err:    xmltokenizer.ErrContentAfterRoot,
+		},
+		{
+			name:   "trailing chardata",
+			xml:    "<?xml version=\"1.0\"?>\n<body><goodbye /></body> extra",
+			strict: true,
+			offset: 47,
+			err:    xmltokenizer.ErrContentAfterRoot,
+		},
+		{
+			name:   "self-closing root with trailing chardata",
+			xml:    "<a/>junk",
+			strict: true,
+			offset: 4,
+			err:    xmltokenizer.ErrContentAfterRoot,
+		},
+		{
+			name:   "trailing newline with TrimNone",
+			xml:    "<a>x</a>\n",
+			strict: true,
+			opts:   []xmltokenizer.Option{xmltokenizer.WithTrimMode(xmltokenizer.TrimNone)},
+		},
+		{
+			name:   "self-closing root with trailing newline with TrimNone",
+			xml:    "<a/>\r\n",
+			strict: true,
+			opts:   []xmltokenizer.Option{xmltokenizer.WithTrimMode(xmltokenizer.TrimNone)},
+		},
+		{
+			name:   "trailing chardata with TrimNone",
+			xml:    "<a>x</a>\n junk",
+			strict: true,
+			opts:   []xmltokenizer.Option{xmltokenizer.WithTrimMode(xmltokenizer.TrimNone)},
+			offset: 10,
+			err:    xmltokenizer.ErrContentAfterRoot,
+		},
+		{
+			name:   "trailing element in lenient mode",
+			xml:    "<?xml version=\"1.0\"?>\n<body><goodbye /></body><extra/>",
+			strict: false,
+		},
 	}
-	defer f2.Close()
 
-	sheetData2, err := xlsx.UnmarshalWithStdlibXML(f2)
-	if err != nil {
-		t.Fatal(err)
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(
+				strings.NewReader(tc.xml),
+				append([]xmltokenizer.Option{
+					xmltokenizer.WithReadBufferSize(1),
+					xmltokenizer.WithStrict(tc.strict),
+				}, tc.opts...)...,
+			)
+
+			var err error
+			for {
+				if _, err = tok.Token(); err != nil {
+					break
+				}
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+
+			var syntaxErr xmltokenizer.SyntaxError
+			if errors.As(err, &syntaxErr) && syntaxErr.Offset != tc.offset {
+				t.Fatalf("expected offset: %d, got: %d", tc.offset, syntaxErr.Offset)
+			}
+		})
 	}
+}
 
-	if diff := cmp.Diff(sheetData1, sheetData2); diff != "" {
-		t.Fatal(err)
+func TestMisplacedDeclaration(t *testing.T) {
+	tt := []struct {
+		name   string
+		xml    string
+		strict bool
+		offset int64
+		err    error
+	}{
+		{
+			name:   "declaration after the first declaration",
+			xml:    "<?xml version=\"1.0\"?>\n<?xml version=\"1.0\"?>\n<a/>",
+			strict: true,
+			offset: 22,
+			err:    xmltokenizer.ErrMisplacedDeclaration,
+		},
+		{
+			name:   "declaration after a comment",
+			xml:    "<!-- c --><?xml version=\"1.0\"?><a/>",
+			strict: true,
+			offset: 10,
+			err:    xmltokenizer.ErrMisplacedDeclaration,
+		},
+		{
+			name:   "declaration inside the root",
+			xml:    "<a><?xml version=\"1.0\"?></a>",
+			strict: true,
+			offset: 3,
+			err:    xmltokenizer.ErrMisplacedDeclaration,
+		},
+		{
+			name:   "declaration inside the root in lenient mode",
+			xml:    "<a><?xml version=\"1.0\"?></a>",
+			strict: false,
+		},
+		{
+			name:   "stylesheet after the declaration",
+			xml:    "<?xml version=\"1.0\"?>\n<?xml-stylesheet href=\"a.xsl\"?>\n<a><?xml-stylesheet href=\"b.xsl\"?></a>",
+			strict: true,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(
+				strings.NewReader(tc.xml),
+				xmltokenizer.WithReadBufferSize(1),
+				xmltokenizer.WithStrict(tc.strict),
+			)
+
+			var err error
+			var procInsts int
+			for {
+				var token xmltokenizer.Token
+				if token, err = tok.Token(); err != nil {
+					break
+				}
+				if bytes.HasPrefix(token.Data, []byte("<?")) {
+					procInsts++
+				}
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+
+			var syntaxErr xmltokenizer.SyntaxError
+			if errors.As(err, &syntaxErr) && syntaxErr.Offset != tc.offset {
+				t.Fatalf("expected offset: %d, got: %d", tc.offset, syntaxErr.Offset)
+			}
+			if err == nil && procInsts != strings.Count(tc.xml, "<?") {
+				t.Fatalf("expected every ProcInst to be passed through, got: %d", procInsts)
+			}
+		})
 	}
 }
 
-func TestRawTokenWithInmemXML(t *testing.T) {
+func TestInvalidAttrName(t *testing.T) {
 	tt := []struct {
-		name      string
-		xml       string
-		expecteds []string
-		err       error
+		name   string
+		xml    string
+		strict bool
+		offset int64
+		err    error
 	}{
 		{
-			name: "simple xml happy flow",
-			xml: `<?xml version="1.0" encoding="UTF-8"?>
-<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN"
-	"http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
-<body xmlns:foo="ns1" xmlns="ns2" xmlns:tag="ns3" ` +
-				"\r\n\t" + `  >
-	<hello lang="en">World &lt;&gt;&apos;&quot; &#x767d;&#40300;翔</hello>
-	<query>&何; &is-it;</query>
-	<goodbye />
-	<outer foo:attr="value" xmlns:tag="ns4">
-	<inner/>
-	</outer>
-	<tag:name>
-	<![CDATA[Some text here.]]>
-	</tag:name>
-</body><!-- missing final newline -->`, // Note: retrieved from stdlib xml test.
-			expecteds: []string{
-				"<?xml version=\"1.0\" encoding=\"UTF-8\"?>",
-				"<!DOCTYPE html PUBLIC \"-//W3C//DTD XHTML 1.0 Transitional//EN\"\n" +
-					"	\"http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd\">",
-				"<body xmlns:foo=\"ns1\" xmlns=\"ns2\" xmlns:tag=\"ns3\" " +
-					"\r\n\t" + "  >",
-				"<hello lang=\"en\">World &lt;&gt;&apos;&quot; &#x767d;&#40300;翔",
-				"</hello>",
-				"<query>&何; &is-it;",
-				"</query>",
-				"<goodbye />",
-				"<outer foo:attr=\"value\" xmlns:tag=\"ns4\">",
-				"<inner/>",
-				"</outer>",
-				"<tag:name>\n	<![CDATA[Some text here.]]>",
-				"</tag:name>",
-				"</body>",
-				"<!-- missing final newline -->",
+			name:   "space in name",
+			xml:    `<a b c="1"/>`,
+			strict: true,
+			offset: 4,
+			err:    xmltokenizer.ErrInvalidAttrName,
+		},
+		{
+			name:   "leading digit",
+			xml:    `<a ok="1" 1st="2"/>`,
+			strict: true,
+			offset: 10,
+			err:    xmltokenizer.ErrInvalidAttrName,
+		},
+		{
+			name:   "stray punctuation",
+			xml:    `<a><b x!y="1"></b></a>`,
+			strict: true,
+			offset: 7,
+			err:    xmltokenizer.ErrInvalidAttrName,
+		},
+		{
+			name:   "no name",
+			xml:    `<a ="ns2"></a>`,
+			strict: true,
+			offset: 3,
+			err:    xmltokenizer.ErrInvalidAttrName,
+		},
+		{
+			name:   "prefix with no local name",
+			xml:    `<a b="1" foo:="x"/>`,
+			strict: true,
+			offset: 12,
+			err:    xmltokenizer.ErrInvalidAttrName,
+		},
+		{
+			name:   "prefix with no local name in lenient mode",
+			xml:    `<a b="1" foo:="x"/>`,
+			strict: false,
+		},
+		{
+			name:   "valid names",
+			xml:    `<a xmlns:x="ns" x:b-c.d_e="1" _f="2" ñ1="3"/>`,
+			strict: true,
+		},
+		{
+			name:   "stray punctuation in lenient mode",
+			xml:    `<a><b x!y="1"></b></a>`,
+			strict: false,
+		},
+		{
+			name:   "single quotes",
+			xml:    `<a b='1' c="2"/>`,
+			strict: true,
+		},
+		{
+			name:   "quote of the other kind in value",
+			xml:    `<a b='it"s' c="it's"><d e='>'/></a>`,
+			strict: true,
+		},
+		{
+			name:   "space in name with single quotes",
+			xml:    `<a b c='1'/>`,
+			strict: true,
+			offset: 4,
+			err:    xmltokenizer.ErrInvalidAttrName,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(
+				strings.NewReader(tc.xml),
+				xmltokenizer.WithReadBufferSize(1),
+				xmltokenizer.WithStrict(tc.strict),
+			)
+
+			var err error
+			for {
+				if _, err = tok.Token(); err != nil {
+					break
+				}
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+
+			var syntaxErr xmltokenizer.SyntaxError
+			if errors.As(err, &syntaxErr) && syntaxErr.Offset != tc.offset {
+				t.Fatalf("expected offset: %d, got: %d", tc.offset, syntaxErr.Offset)
+			}
+		})
+	}
+
+	t.Run("prefix with no local name is kept in lenient mode", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader(`<a b="1" foo:="x"/>`))
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []xmltokenizer.Attr{
+			{Name: xmltokenizer.Name{Local: []byte("b"), Full: []byte("b")}, Value: []byte("1")},
+			{Name: xmltokenizer.Name{Prefix: []byte("foo"), Full: []byte("foo:")}, Value: []byte("x")},
+		}
+		if diff := cmp.Diff(token.Attrs, expected, cmpopts.EquateEmpty()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("single-quoted values", func(t *testing.T) {
+		const xml = `<a b='it"s' c="it's" d = '>'/>`
+		expected := []xmltokenizer.Attr{
+			{Name: xmltokenizer.Name{Local: []byte("b"), Full: []byte("b")}, Value: []byte(`it"s`)},
+			{Name: xmltokenizer.Name{Local: []byte("c"), Full: []byte("c")}, Value: []byte("it's")},
+			{Name: xmltokenizer.Name{Local: []byte("d"), Full: []byte("d")}, Value: []byte(">")},
+		}
+		for _, lazy := range []bool{false, true} {
+			tok := xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithStrict(true), xmltokenizer.WithLazyAttrs(lazy))
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var attrs []xmltokenizer.Attr
+			for _, local := range []string{"b", "c", "d"} {
+				attr, _ := token.Attr(local)
+				attrs = append(attrs, attr)
+			}
+			if diff := cmp.Diff(attrs, expected, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatalf("lazy %t: %s", lazy, diff)
+			}
+			if !token.SelfClosing {
+				t.Fatalf("lazy %t: expected self-closing", lazy)
+			}
+		}
+	})
+}
+
+func TestTrimMode(t *testing.T) {
+	const xml = "<a>\n\t  fixed  width \t\n</a><b> <![CDATA[  cdata ]]> </b>"
+
+	tt := []struct {
+		mode      xmltokenizer.TrimMode
+		expecteds []string
+	}{
+		{mode: xmltokenizer.TrimBoth, expecteds: []string{"fixed  width", "cdata"}},
+		{mode: xmltokenizer.TrimNone, expecteds: []string{"\n\t  fixed  width \t\n", "  cdata "}},
+		{mode: xmltokenizer.TrimLeading, expecteds: []string{"fixed  width \t\n", "cdata "}},
+		{mode: xmltokenizer.TrimTrailing, expecteds: []string{"\n\t  fixed  width", "  cdata"}},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]", i), func(t *testing.T) {
+			tok := xmltokenizer.New(
+				strings.NewReader(xml),
+				xmltokenizer.WithReadBufferSize(1),
+				xmltokenizer.WithTrimMode(tc.mode),
+			)
+
+			var datas []string
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !token.IsEndElement {
+					datas = append(datas, string(token.Data))
+				}
+			}
+
+			if diff := cmp.Diff(datas, tc.expecteds); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+
+	t.Run("line endings", func(t *testing.T) {
+		// A lone CR, e.g. of a classic Mac OS file, is trimmed like LF and CRLF.
+		const xml = "<r><a>\rx\r</a><b>\r\nx\r\n</b><c>\nx\n</c><d>\r\n\rx\n\r</d></r>"
+		tok := xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithReadBufferSize(1))
+		var datas []string
+		for {
+			token, err := tok.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !token.IsEndElement && string(token.Name.Local) != "r" {
+				datas = append(datas, string(token.Data))
+			}
+		}
+		if diff := cmp.Diff(datas, []string{"x", "x", "x", "x"}); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestSlashInAttrValue(t *testing.T) {
+	const xml = `<a href="http://x/y">text</a><b href="/"/>`
+
+	for _, lazy := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lazy=%t", lazy), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithLazyAttrs(lazy))
+
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.SelfClosing {
+				t.Fatalf("<a>: '/' inside a quoted attribute value must not mark the tag as self-closing")
+			}
+			if v := string(token.AttrValue("href")); v != "http://x/y" {
+				t.Fatalf("expected href: %q, got: %q", "http://x/y", v)
+			}
+			if string(token.Data) != "text" {
+				t.Fatalf("expected Data: %q, got: %q", "text", token.Data)
+			}
+
+			tok.Token() // </a>
+			token, err = tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !token.SelfClosing {
+				t.Fatalf("<b/>: expected self-closing")
+			}
+		})
+	}
+}
+
+func TestSyntheticEndElements(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "self_closing.xml"))
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	expecteds := []xmltokenizer.Token{
+		tokenHeader,
+		{Name: xmltokenizer.Name{Local: []byte("a"), Full: []byte("a")}, SelfClosing: true},
+		{Name: xmltokenizer.Name{Local: []byte("a"), Full: []byte("a")}, IsEndElement: true},
+		{Name: xmltokenizer.Name{Local: []byte("b"), Full: []byte("b")}, SelfClosing: true},
+		{Name: xmltokenizer.Name{Local: []byte("b"), Full: []byte("b")}, IsEndElement: true},
+	}
+
+	tok := xmltokenizer.New(f,
+		xmltokenizer.WithReadBufferSize(1),
+		xmltokenizer.WithSyntheticEndElements(true),
+	)
+	var i int
+	for ; ; i++ {
+		token, err := tok.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(token, expecteds[i], ignoreUnexported); diff != "" {
+			t.Fatalf("%d: %s", i, diff)
+		}
+	}
+	if i != len(expecteds) {
+		t.Fatalf("expected %d tokens, got: %d", len(expecteds), i)
+	}
+}
+
+func TestRejectDirectives(t *testing.T) {
+	tt := []struct {
+		name     string
+		xml      string
+		err      error
+		expected string
+	}{
+		{
+			name:     "doctype",
+			xml:      "<?xml version=\"1.0\"?>\n<!DOCTYPE note [<!ENTITY x \"y\">]><note>&x;</note>",
+			err:      xmltokenizer.ErrDirectiveRejected,
+			expected: "byte pos 22: <!DOCTYPE: directive rejected",
+		},
+		{
+			name:     "entity",
+			xml:      "<!ENTITY xxe SYSTEM \"file:///etc/passwd\"><note/>",
+			err:      xmltokenizer.ErrDirectiveRejected,
+			expected: "byte pos 0: <!ENTITY: directive rejected",
+		},
+		{
+			name: "comment and cdata are allowed",
+			xml:  "<!-- c --><note><![CDATA[<x>]]></note>",
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(tc.xml),
+				xmltokenizer.WithReadBufferSize(1),
+				xmltokenizer.WithRejectDirectives(true),
+			)
+			var err error
+			for err == nil {
+				_, err = tok.Token()
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if err != nil && err.Error() != tc.expected {
+				t.Fatalf("expected: %q, got: %q", tc.expected, err.Error())
+			}
+			if _, err2 := tok.Token(); tc.err != nil && !errors.Is(err2, tc.err) {
+				t.Fatalf("expected latched error: %v, got: %v", tc.err, err2)
+			}
+		})
+	}
+}
+
+func TestBareAmpersand(t *testing.T) {
+	tt := []struct {
+		name     string
+		xml      string
+		strict   bool
+		err      error
+		expected string
+	}{
+		{name: "lenient text", xml: "<company>AT&T</company>"},
+		{name: "lenient attr", xml: `<company name="AT&T"/>`},
+		{
+			name:     "strict text",
+			xml:      "<company>AT&T</company>",
+			strict:   true,
+			err:      xmltokenizer.ErrBareAmpersand,
+			expected: "byte pos 11: bare '&' is not allowed",
+		},
+		{
+			name:     "strict attr",
+			xml:      `<company name="AT&T"/>`,
+			strict:   true,
+			err:      xmltokenizer.ErrBareAmpersand,
+			expected: "byte pos 17: attr name: bare '&' is not allowed",
+		},
+		{
+			name:     "strict unterminated entity",
+			xml:      "<a>&amp;&lt</a>",
+			strict:   true,
+			err:      xmltokenizer.ErrBareAmpersand,
+			expected: "byte pos 8: bare '&' is not allowed",
+		},
+		{
+			name:   "strict valid entities",
+			xml:    `<a b="&quot;x&#34;">&amp; &#x767d; &#40300; &is-it; <![CDATA[AT&T]]></a>`,
+			strict: true,
+		},
+		{
+			name:   "strict cdata",
+			xml:    "<a><![CDATA[AT&T]]></a>",
+			strict: true,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(tc.xml), xmltokenizer.WithStrict(tc.strict))
+			var err error
+			for err == nil {
+				_, err = tok.Token()
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if err != nil && err.Error() != tc.expected {
+				t.Fatalf("expected: %q, got: %q", tc.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestWarningHandler(t *testing.T) {
+	tt := []struct {
+		name     string
+		xml      string
+		strict   bool
+		warnings []error
+		offsets  []int64
+		err      error
+	}{
+		{
+			name:     "bare ampersand",
+			xml:      `<a>AT&T</a>`,
+			warnings: []error{xmltokenizer.ErrBareAmpersand},
+			offsets:  []int64{5},
+		},
+		{
+			name:     "duplicate attr",
+			xml:      `<a><b x="1" y="2" x="3"/></a>`,
+			warnings: []error{xmltokenizer.ErrDuplicateAttr},
+			offsets:  []int64{18},
+		},
+		{
+			name:     "several issues",
+			xml:      `<a x="1" x="2">AT&T</a><b/>`,
+			warnings: []error{xmltokenizer.ErrBareAmpersand, xmltokenizer.ErrDuplicateAttr, xmltokenizer.ErrContentAfterRoot},
+			offsets:  []int64{17, 9, 23},
+		},
+		{
+			name: "well-formed",
+			xml:  `<?xml version="1.0"?><a x="1">AT&amp;T</a>`,
+		},
+		{
+			name:   "strict",
+			xml:    `<a>AT&T</a>`,
+			strict: true,
+			err:    xmltokenizer.ErrBareAmpersand,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			var warnings []error
+			var offsets []int64
+			tok := xmltokenizer.New(strings.NewReader(tc.xml),
+				xmltokenizer.WithStrict(tc.strict),
+				xmltokenizer.WithWarningHandler(func(se xmltokenizer.SyntaxError) {
+					warnings = append(warnings, se.Err)
+					offsets = append(offsets, se.Offset)
+				}),
+			)
+			var err error
+			for err == nil {
+				_, err = tok.Token()
+			}
+			if tc.err == nil && err != io.EOF {
+				t.Fatalf("expected: %v, got: %v", io.EOF, err)
+			}
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Fatalf("expected: %v, got: %v", tc.err, err)
+			}
+			if diff := cmp.Diff(warnings, tc.warnings, cmpopts.EquateErrors()); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(offsets, tc.offsets); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestKeepRaw(t *testing.T) {
+	const xml = "<?xml version=\"1.0\"?>\n" +
+		"<row r=\"1\" spans=\"1:3\">\n" +
+		"  <c r=\"A1\"\tt=\"s\" ><v>0</v></c>\n" +
+		"  <!-- comment -->text\n" +
+		"  <c r=\"C1\" />\n" +
+		"</row>"
+
+	expecteds := []string{
+		"<?xml version=\"1.0\"?>",
+		"<row r=\"1\" spans=\"1:3\">",
+		"<c r=\"A1\"\tt=\"s\" >",
+		"<v>",
+		"</v>",
+		"</c>",
+		"<!-- comment -->",
+		"text\n  ",
+		"<c r=\"C1\" />",
+		"</row>",
+	}
+
+	tok := xmltokenizer.New(strings.NewReader(xml),
+		xmltokenizer.WithReadBufferSize(1),
+		xmltokenizer.WithKeepRaw(true),
+	)
+
+	var pos int
+	for i, expected := range expecteds {
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if string(token.Raw()) != expected {
+			t.Fatalf("%d: expected Raw: %q, got: %q", i, expected, token.Raw())
+		}
+		// Raw must be the exact source slice.
+		idx := strings.Index(xml[pos:], string(token.Raw()))
+		if idx < 0 {
+			t.Fatalf("%d: Raw %q is not found in the source", i, token.Raw())
+		}
+		pos += idx + len(token.Raw())
+	}
+
+	if _, err := tok.Token(); err != io.EOF {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+
+	tok = xmltokenizer.New(strings.NewReader(xml))
+	token, _ := tok.Token()
+	if token.Raw() != nil {
+		t.Fatalf("expected nil Raw when WithKeepRaw is not enabled, got: %q", token.Raw())
+	}
+}
+
+func TestTokenLatchedError(t *testing.T) {
+	tt := []struct {
+		name   string
+		xml    string
+		opts   []xmltokenizer.Option
+		tokens int // number of tokens returned before the error
+		err    error
+	}{
+		{name: "EOF", xml: "<a></a>", tokens: 2, err: io.EOF},
+		{name: "truncated tag", xml: "<a><b", tokens: 1, err: io.ErrUnexpectedEOF},
+		{name: "truncated cdata", xml: "<a><![CDATA[text", tokens: 1, err: io.ErrUnexpectedEOF},
+		{
+			name:   "syntax error",
+			xml:    "<a></a><b/>",
+			opts:   []xmltokenizer.Option{xmltokenizer.WithStrict(true)},
+			tokens: 2,
+			err:    xmltokenizer.ErrContentAfterRoot,
+		},
+		{
+			name: "buffer exceed max limit",
+			xml:  "<a>" + strings.Repeat("x", 8<<10) + "</a>",
+			opts: []xmltokenizer.Option{
+				xmltokenizer.WithReadBufferSize(8),
+				xmltokenizer.WithAutoGrowBufferMaxLimitSize(16),
+			},
+			tokens: 1,
+			err:    errors.New("could not grow buffer"), // not exported, matched by message.
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(tc.xml), tc.opts...)
+
+			var n int
+			var err error
+			for {
+				if _, err = tok.Token(); err != nil {
+					break
+				}
+				n++
+			}
+			if n != tc.tokens {
+				t.Fatalf("expected %d tokens before error, got: %d", tc.tokens, n)
+			}
+			if !errors.Is(err, tc.err) && !strings.Contains(err.Error(), tc.err.Error()) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+
+			for j := 0; j < 3; j++ {
+				token, err2 := tok.Token()
+				if err2 == nil || err2.Error() != err.Error() {
+					t.Fatalf("[%d] expected latched error: %v, got: %v", j, err, err2)
+				}
+				if diff := cmp.Diff(token, xmltokenizer.Token{}, ignoreUnexported); diff != "" {
+					t.Fatalf("[%d] expected empty token: %s", j, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestErr(t *testing.T) {
+	tt := []struct {
+		name string
+		xml  string
+		opts []xmltokenizer.Option
+		err  error
+	}{
+		{name: "EOF", xml: "<a><b/></a>"},
+		{name: "truncated tag", xml: `<a><b x="1`, err: io.ErrUnexpectedEOF},
+		{name: "truncated cdata", xml: "<a><![CDATA[text", err: io.ErrUnexpectedEOF},
+		{
+			name: "syntax error",
+			xml:  "<a></a><b/>",
+			opts: []xmltokenizer.Option{xmltokenizer.WithStrict(true)},
+			err:  xmltokenizer.ErrContentAfterRoot,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(tc.xml), tc.opts...)
+			if err := tok.Err(); err != nil {
+				t.Fatalf("expected nil before the first token, got: %v", err)
+			}
+
+			var lastErr error
+			for {
+				if _, lastErr = tok.Token(); lastErr != nil {
+					break
+				}
+			}
+
+			err := tok.Err()
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if err != nil && err != lastErr {
+				t.Fatalf("expected the error returned by Token: %v, got: %v", lastErr, err)
+			}
+
+			tok.Reset(strings.NewReader("<a/>"))
+			if err = tok.Err(); err != nil {
+				t.Fatalf("expected nil after Reset, got: %v", err)
+			}
+		})
+	}
+
+	t.Run("truncated file", func(t *testing.T) {
+		f, err := os.Open(filepath.Join("testdata", "corrupted", "cdata_truncated.xml"))
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+
+		tok := xmltokenizer.New(f)
+		for {
+			if _, err := tok.Token(); err != nil {
+				break
+			}
+		}
+		if err := tok.Err(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected error: %v, got: %v", io.ErrUnexpectedEOF, err)
+		}
+	})
+}
+
+func TestSeparateNamespaceDecls(t *testing.T) {
+	const xml = `<body xmlns:foo="ns1" xmlns="ns2" xmlns:tag="ns3" ` + "\r\n\t" + `  >` +
+		`<outer foo:attr="value" xmlnsx="x"/></body>`
+
+	tok := xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithSeparateNamespaceDecls(true))
+
+	expecteds := []struct {
+		token   xmltokenizer.Token
+		nsDecls []xmltokenizer.Attr
+	}{
+		{
+			token: xmltokenizer.Token{Name: xmltokenizer.Name{Local: []byte("body"), Full: []byte("body")}},
+			nsDecls: []xmltokenizer.Attr{
+				{Name: xmltokenizer.Name{Prefix: []byte("xmlns"), Local: []byte("foo"), Full: []byte("xmlns:foo")}, Value: []byte("ns1")},
+				{Name: xmltokenizer.Name{Local: []byte("xmlns"), Full: []byte("xmlns")}, Value: []byte("ns2")},
+				{Name: xmltokenizer.Name{Prefix: []byte("xmlns"), Local: []byte("tag"), Full: []byte("xmlns:tag")}, Value: []byte("ns3")},
+			},
+		},
+		{
+			token: xmltokenizer.Token{
+				Name: xmltokenizer.Name{Local: []byte("outer"), Full: []byte("outer")},
+				Attrs: []xmltokenizer.Attr{
+					{Name: xmltokenizer.Name{Prefix: []byte("foo"), Local: []byte("attr"), Full: []byte("foo:attr")}, Value: []byte("value")},
+					{Name: xmltokenizer.Name{Local: []byte("xmlnsx"), Full: []byte("xmlnsx")}, Value: []byte("x")},
+				},
+				SelfClosing: true,
+			},
+		},
+		{token: xmltokenizer.Token{Name: xmltokenizer.Name{Local: []byte("body"), Full: []byte("body")}, IsEndElement: true}},
+	}
+
+	for i, expected := range expecteds {
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if diff := cmp.Diff(token, expected.token, ignoreUnexported); diff != "" {
+			t.Fatalf("%d: %s", i, diff)
+		}
+		if diff := cmp.Diff(token.NamespaceDecls(), expected.nsDecls); diff != "" {
+			t.Fatalf("%d: NamespaceDecls: %s", i, diff)
+		}
+	}
+}
+
+func TestSortAttrs(t *testing.T) {
+	const (
+		xml1 = `<a z="1" xmlns:b="ns" b:y="2" x="3" xmlns="ns0" x="4"/>`
+		xml2 = `<a xmlns="ns0" x="3" b:y="2" xmlns:b="ns" x="4" z="1"/>`
+	)
+
+	tt := []struct {
+		name     string
+		opts     []xmltokenizer.Option
+		expected string
+	}{
+		{
+			name:     "sorted",
+			opts:     []xmltokenizer.Option{xmltokenizer.WithSortAttrs(true)},
+			expected: `<a b:y="2" x="3" x="4" xmlns="ns0" xmlns:b="ns" z="1"/>`,
+		},
+		{
+			name: "separated namespace decls are sorted on their own",
+			opts: []xmltokenizer.Option{
+				xmltokenizer.WithSortAttrs(true),
+				xmltokenizer.WithSeparateNamespaceDecls(true),
+			},
+			expected: `<a b:y="2" x="3" x="4" z="1" xmlns="ns0" xmlns:b="ns"/>`,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			token1, err := xmltokenizer.New(strings.NewReader(xml1), tc.opts...).Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			token2, err := xmltokenizer.New(strings.NewReader(xml2), tc.opts...).Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(token1, token2, ignoreUnexported); diff != "" {
+				t.Fatal(diff)
+			}
+			if token1.String() != tc.expected {
+				t.Fatalf("expected: %s, got: %s", tc.expected, token1)
+			}
+		})
+	}
+
+	t.Run("unsorted", func(t *testing.T) {
+		token1, _ := xmltokenizer.New(strings.NewReader(xml1)).Token()
+		token2, _ := xmltokenizer.New(strings.NewReader(xml2)).Token()
+		if cmp.Equal(token1, token2, ignoreUnexported) {
+			t.Fatalf("expected the attributes in the document order")
+		}
+	})
+}
+
+func TestNewlineAfterTagName(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "newline_after_name.xml"))
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	tok := xmltokenizer.New(f)
+
+	expecteds := []xmltokenizer.Token{
+		{Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>`), SelfClosing: true},
+		{Name: xmltokenizer.Name{Local: []byte("trk"), Full: []byte("trk")}},
+		{
+			Name: xmltokenizer.Name{Local: []byte("trkpt"), Full: []byte("trkpt")},
+			Attrs: []xmltokenizer.Attr{
+				{Name: xmltokenizer.Name{Local: []byte("lat"), Full: []byte("lat")}, Value: []byte("-7.1872750")},
+				{Name: xmltokenizer.Name{Local: []byte("lon"), Full: []byte("lon")}, Value: []byte("110.3450230")},
+			},
+		},
+		{Name: xmltokenizer.Name{Local: []byte("ele"), Full: []byte("ele")}, Data: []byte("1")},
+		{Name: xmltokenizer.Name{Local: []byte("ele"), Full: []byte("ele")}, IsEndElement: true},
+		{Name: xmltokenizer.Name{Local: []byte("trkpt"), Full: []byte("trkpt")}, IsEndElement: true},
+		{
+			Name: xmltokenizer.Name{Local: []byte("trkpt"), Full: []byte("trkpt")},
+			Attrs: []xmltokenizer.Attr{
+				{Name: xmltokenizer.Name{Local: []byte("lat"), Full: []byte("lat")}, Value: []byte("-7.1872751")},
+			},
+			SelfClosing: true,
+		},
+		{
+			Name: xmltokenizer.Name{Prefix: []byte("gpxtpx"), Local: []byte("hr"), Full: []byte("gpxtpx:hr")},
+			Attrs: []xmltokenizer.Attr{
+				{Name: xmltokenizer.Name{Local: []byte("unit"), Full: []byte("unit")}, Value: []byte("bpm")},
+			},
+			Data: []byte("90"),
+		},
+		{Name: xmltokenizer.Name{Prefix: []byte("gpxtpx"), Local: []byte("hr"), Full: []byte("gpxtpx:hr")}, IsEndElement: true},
+		{Name: xmltokenizer.Name{Local: []byte("name"), Full: []byte("name")}, Data: []byte("x")},
+		{Name: xmltokenizer.Name{Local: []byte("name"), Full: []byte("name")}, IsEndElement: true},
+		{Name: xmltokenizer.Name{Local: []byte("trk"), Full: []byte("trk")}, IsEndElement: true},
+	}
+
+	for i, expected := range expecteds {
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if diff := cmp.Diff(token, expected, ignoreUnexported); diff != "" {
+			t.Fatalf("%d: %s", i, diff)
+		}
+	}
+	if _, err := tok.Token(); err != io.EOF {
+		t.Fatalf("expected: %v, got: %v", io.EOF, err)
+	}
+}
+
+func TestSpacedEndElement(t *testing.T) {
+	tt := []struct {
+		name string
+		xml  string
+		err  error // only in strict mode
+	}{
+		{name: "space after slash", xml: "<foo>text</ foo >", err: xmltokenizer.ErrMalformedEndElement},
+		{name: "space before slash", xml: "<foo>text< /foo>", err: xmltokenizer.ErrMalformedEndElement},
+		{name: "spaces around slash", xml: "<foo>text<\t/\nfoo>", err: xmltokenizer.ErrMalformedEndElement},
+		{name: "space before right angle bracket", xml: "<foo>text</foo >"},
+	}
+
+	for i, tc := range tt {
+		for _, strict := range []bool{false, true} {
+			t.Run(fmt.Sprintf("[%d]: %s: strict=%t", i, tc.name, strict), func(t *testing.T) {
+				tok := xmltokenizer.New(strings.NewReader(tc.xml), xmltokenizer.WithStrict(strict))
+				if _, err := tok.Token(); err != nil {
+					t.Fatal(err)
+				}
+
+				token, err := tok.Token()
+				if strict && tc.err != nil {
+					if !errors.Is(err, tc.err) {
+						t.Fatalf("expected error: %v, got: %v", tc.err, err)
+					}
+					var syntaxErr xmltokenizer.SyntaxError
+					if errors.As(err, &syntaxErr) && syntaxErr.Offset != int64(len("<foo>text")) {
+						t.Fatalf("expected offset: %d, got: %d", len("<foo>text"), syntaxErr.Offset)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !token.IsEndElement || string(token.Name.Full) != "foo" || token.SelfClosing {
+					t.Fatalf("expected </foo>, got: %s", token)
+				}
+			})
+		}
+	}
+}
+
+func TestNoReader(t *testing.T) {
+	tok := xmltokenizer.New(nil)
+	if _, err := tok.Token(); !errors.Is(err, xmltokenizer.ErrNoReader) {
+		t.Fatalf("expected error: %v, got: %v", xmltokenizer.ErrNoReader, err)
+	}
+	if _, err := tok.RawToken(); !errors.Is(err, xmltokenizer.ErrNoReader) {
+		t.Fatalf("expected error: %v, got: %v", xmltokenizer.ErrNoReader, err)
+	}
+
+	tok.Reset(strings.NewReader("<a/>"))
+	token, err := tok.Token()
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	if string(token.Name.Local) != "a" {
+		t.Fatalf("expected: a, got: %s", token.Name.Local)
+	}
+}
+
+func TestLongAttrValue(t *testing.T) {
+	const maxLimit = 64 << 10
+
+	for _, n := range []int{1, 4095, 4096, 4097, maxLimit - 64} {
+		t.Run(fmt.Sprintf("value len %d", n), func(t *testing.T) {
+			value := strings.Repeat("v", n)
+			xml := `<root><a x="1" y="` + value + `" z="3"/></root>`
+
+			tok := xmltokenizer.New(strings.NewReader(xml),
+				xmltokenizer.WithReadBufferSize(1),
+				xmltokenizer.WithAutoGrowBufferMaxLimitSize(maxLimit),
+			)
+			if _, err := tok.Token(); err != nil {
+				t.Fatal(err)
+			}
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(token.Attrs) != 3 {
+				t.Fatalf("expected 3 attrs, got: %d", len(token.Attrs))
+			}
+			if string(token.Attrs[1].Value) != value || string(token.Attrs[2].Value) != "3" {
+				t.Fatalf("unexpected attrs value")
+			}
+			if !token.SelfClosing {
+				t.Fatalf("expected SelfClosing")
+			}
+		})
+	}
+
+	t.Run("exceeding max limit", func(t *testing.T) {
+		xml := `<root><a x="1" y="` + strings.Repeat("v", maxLimit) + `" z="3"/></root>`
+		tok := xmltokenizer.New(strings.NewReader(xml),
+			xmltokenizer.WithReadBufferSize(1),
+			xmltokenizer.WithAutoGrowBufferMaxLimitSize(maxLimit),
+		)
+		if _, err := tok.Token(); err != nil {
+			t.Fatal(err)
+		}
+		// The truncated tag must not be returned as a token with missing attributes.
+		token, err := tok.Token()
+		if err == nil {
+			t.Fatalf("expected error, got token %q with %d attrs", token.Name.Full, len(token.Attrs))
+		}
+	})
+}
+
+func TestCharDataSeam(t *testing.T) {
+	modes := []xmltokenizer.TrimMode{xmltokenizer.TrimBoth, xmltokenizer.TrimNone, xmltokenizer.TrimLeading, xmltokenizer.TrimTrailing}
+	all := func(data ...string) [4][]string { return [4][]string{data, data, data, data} }
+
+	tt := []struct {
+		name      string
+		xml       string
+		merge     bool
+		expecteds [4][]string // the non-empty Data of the tokens, indexed by the TrimMode
+	}{
+		{
+			name:      "text to cdata",
+			xml:       "<v>a <![CDATA[ b]]></v>",
+			merge:     true,
+			expecteds: all("a  b"),
+		},
+		{
+			name:      "text to cdata surrounded by whitespace",
+			xml:       "<v> a <![CDATA[ b ]]> </v>",
+			merge:     true,
+			expecteds: [4][]string{{"a  b"}, {" a  b  "}, {"a  b  "}, {" a  b"}},
+		},
+		{
+			name:      "cdata to text",
+			xml:       "<v><![CDATA[a ]]> b</v>",
+			merge:     true,
+			expecteds: all("a  b"),
+		},
+		{
+			name:      "cdata to text surrounded by whitespace",
+			xml:       "<v> <![CDATA[ a ]]> b </v>",
+			merge:     true,
+			expecteds: [4][]string{{"a  b"}, {" a  b "}, {"a  b "}, {" a  b"}},
+		},
+		{
+			name:      "whitespace-only text between cdata",
+			xml:       "<v><![CDATA[a]]> <![CDATA[b]]></v>",
+			merge:     true,
+			expecteds: all("a b"),
+		},
+		{
+			name:      "text to cdata to text",
+			xml:       "<v>a <![CDATA[ b ]]> c </v>",
+			merge:     true,
+			expecteds: [4][]string{{"a  b  c"}, {"a  b  c "}, {"a  b  c "}, {"a  b  c"}},
+		},
+		{
+			name:      "text to cdata to text without whitespace",
+			xml:       "<v>a<![CDATA[b]]>c</v>",
+			merge:     true,
+			expecteds: all("abc"),
+		},
+		{
+			name:      "whitespace-only cdata at the edge",
+			xml:       "<v>a<![CDATA[ ]]></v>",
+			merge:     true,
+			expecteds: [4][]string{{"a"}, {"a "}, {"a "}, {"a"}},
+		},
+		{
+			name:      "text to cdata without merge",
+			xml:       "<v>a <![CDATA[ b]]></v>",
+			expecteds: all("a  b"),
+		},
+		{
+			name:      "text to cdata surrounded by whitespace without merge",
+			xml:       "<v> a <![CDATA[ b ]]> </v>",
+			expecteds: [4][]string{{"a  b"}, {" a  b "}, {"a  b "}, {" a  b"}},
+		},
+		{
+			name:      "cdata to text without merge",
+			xml:       "<v><![CDATA[a ]]> b</v>",
+			expecteds: [4][]string{{"a", "b"}, {"a ", " b"}, {"a ", "b"}, {"a", " b"}},
+		},
+		{
+			name:      "cdata to text surrounded by whitespace without merge",
+			xml:       "<v> <![CDATA[ a ]]> b </v>",
+			expecteds: [4][]string{{"a", "b"}, {" a ", " b "}, {"a ", "b "}, {" a", " b"}},
+		},
+		{
+			name:      "text to cdata to text without merge",
+			xml:       "<v>a <![CDATA[ b ]]> c </v>",
+			expecteds: [4][]string{{"a  b", "c"}, {"a  b ", " c "}, {"a  b ", "c "}, {"a  b", " c"}},
+		},
+	}
+
+	for i, tc := range tt {
+		for j, mode := range modes {
+			t.Run(fmt.Sprintf("[%d][%d]: %s", i, j, tc.name), func(t *testing.T) {
+				for _, entityDecoding := range []bool{false, true} {
+					tok := xmltokenizer.New(strings.NewReader(tc.xml),
+						xmltokenizer.WithReadBufferSize(1),
+						xmltokenizer.WithTrimMode(mode),
+						xmltokenizer.WithMergeCharData(tc.merge),
+						xmltokenizer.WithEntityDecoding(entityDecoding),
+					)
+					var result []string
+					for {
+						token, err := tok.Token()
+						if err == io.EOF {
+							break
+						}
+						if err != nil {
+							t.Fatal(err)
+						}
+						if len(token.Data) > 0 {
+							result = append(result, string(token.Data))
+						}
+					}
+					if diff := cmp.Diff(result, tc.expecteds[j]); diff != "" {
+						t.Fatalf("entityDecoding %t: %s", entityDecoding, diff)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSeparateCharData(t *testing.T) {
+	const xml = `<?xml version="1.0"?>` + "\n" +
+		`<a x="1"> hi &amp; <b/>tail<![CDATA[ <c> ]]><!-- c --><d>text</d>` + "\n  " + `</a>`
+
+	tok := xmltokenizer.New(strings.NewReader(xml),
+		xmltokenizer.WithReadBufferSize(1),
+		xmltokenizer.WithEntityDecoding(true),
+		xmltokenizer.WithSeparateCharData(true),
+		xmltokenizer.WithMergeCharData(true),
+	)
+
+	expected := []string{
+		`procinst(xml version="1.0")`,
+		`<a x="1">`, `chardata(hi &)`,
+		`<b/>`, `chardata(tail)`, `cdata(<c>)`, `comment( c )`,
+		`<d>`, `chardata(text)`, `</d>`,
+		`</a>`,
+	}
+	var result []string
+	for {
+		token, err := tok.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(token.Name.Full) > 0 && len(token.Data) > 0 {
+			t.Fatalf("expected no Data for %s, got: %q", token, token.Data)
+		}
+		result = append(result, token.String())
+	}
+	if diff := cmp.Diff(result, expected); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestTokenOnBlockingReader(t *testing.T) {
+	// Every chunk is followed by the tokens that are expected to be returned
+	// before the next chunk is written, while the reader blocks instead of EOF.
+	type step struct {
+		chunk  string
+		tokens []string
+	}
+
+	tt := []struct {
+		name  string
+		opts  []xmltokenizer.Option
+		steps []step
+	}{
+		{
+			name: "default",
+			steps: []step{
+				{chunk: `<?xml version="1.0"?>`, tokens: []string{`procinst(xml version="1.0")`}},
+				{chunk: `<stream:stream xmlns="jabber:client">`},
+				{chunk: `<message to="a">`, tokens: []string{`<stream:stream xmlns="jabber:client">`}},
+				{chunk: `<body>hi</body>`, tokens: []string{`<message to="a">`, `<body>`}},
+				{chunk: `</message>`, tokens: []string{`</body>`}},
+				{chunk: `<!-- c -->`, tokens: []string{`</message>`, `comment( c )`}},
+				{chunk: `<presence/>`},
+				{chunk: `</stream:stream>`, tokens: []string{`<presence/>`}},
+			},
+		},
+		{
+			name: "separate chardata",
+			opts: []xmltokenizer.Option{xmltokenizer.WithSeparateCharData(true)},
+			steps: []step{
+				{chunk: `<?xml version="1.0"?>`, tokens: []string{`procinst(xml version="1.0")`}},
+				{chunk: `<stream:stream xmlns="jabber:client">`, tokens: []string{`<stream:stream xmlns="jabber:client">`}},
+				{chunk: `<message to="a">`, tokens: []string{`<message to="a">`}},
+				{chunk: `<body>hi`, tokens: []string{`<body>`}},
+				{chunk: `</bo`, tokens: []string{`chardata(hi)`}},
+				{chunk: `dy>`, tokens: []string{`</body>`}},
+				{chunk: `</message>`, tokens: []string{`</message>`}},
+				{chunk: `<!-- c -->`, tokens: []string{`comment( c )`}},
+				{chunk: `<presence/>`, tokens: []string{`<presence/>`}},
+				{chunk: `</stream:stream>`, tokens: []string{`</stream:stream>`}},
+			},
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			pr, pw := io.Pipe()
+			defer pr.Close()
+
+			tokens := make(chan string)
+			go func() {
+				defer close(tokens)
+				tok := xmltokenizer.New(pr, tc.opts...)
+				for {
+					token, err := tok.Token()
+					if err != nil {
+						return
+					}
+					tokens <- token.String()
+				}
+			}()
+
+			for j, step := range tc.steps {
+				if _, err := pw.Write([]byte(step.chunk)); err != nil {
+					t.Fatalf("[%d]: %v", j, err)
+				}
+				for _, expected := range step.tokens {
+					select {
+					case token := <-tokens:
+						if token != expected {
+							t.Fatalf("[%d]: expected: %s, got: %s", j, expected, token)
+						}
+					case <-time.After(5 * time.Second):
+						t.Fatalf("[%d]: expected %s to be returned before the next chunk", j, expected)
+					}
+				}
+			}
+			pw.Close()
+			for token := range tokens { // The tokens pending for the end of the CharData, if any.
+				_ = token
+			}
+		})
+	}
+}
+
+func TestMergeCharData(t *testing.T) {
+	v := xmltokenizer.Name{Local: []byte("v"), Full: []byte("v")}
+	p := xmltokenizer.Name{Local: []byte("p"), Full: []byte("p")}
+	b := xmltokenizer.Name{Local: []byte("b"), Full: []byte("b")}
+
+	tt := []struct {
+		name      string
+		xml       string
+		expecteds []xmltokenizer.Token
+	}{
+		{
+			name: "text followed by cdata",
+			xml:  "<v>text<![CDATA[more]]></v>",
+			expecteds: []xmltokenizer.Token{
+				{Name: v, Data: []byte("textmore")},
+				{Name: v, IsEndElement: true},
+			},
+		},
+		{
+			name: "consecutive cdata",
+			xml:  "<v><![CDATA[a<b>]]><![CDATA[c]]>d</v>",
+			expecteds: []xmltokenizer.Token{
+				{Name: v, Data: []byte("a<b>cd")},
+				{Name: v, IsEndElement: true},
+			},
+		},
+		{
+			name: "single cdata surrounded by whitespace",
+			xml:  "<v>\n  <![CDATA[ a ]]>\n</v>",
+			expecteds: []xmltokenizer.Token{
+				{Name: v, Data: []byte("a")},
+				{Name: v, IsEndElement: true},
+			},
+		},
+		{
+			name: "text followed by a child element is not merged",
+			xml:  "<p>text<b>x</b>tail</p>",
+			expecteds: []xmltokenizer.Token{
+				{Name: p, Data: []byte("text")},
+				{Name: b, Data: []byte("x")},
+				{Name: b, IsEndElement: true, Data: []byte("tail")},
+				{Name: p, IsEndElement: true},
+			},
+		},
+		{
+			name: "cdata followed by a child element is not merged",
+			xml:  "<p><![CDATA[a]]>b<b/></p>",
+			expecteds: []xmltokenizer.Token{
+				{Name: p, Data: []byte("ab")},
+				{Name: b, SelfClosing: true},
+				{Name: p, IsEndElement: true},
+			},
+		},
+		{
+			name: "text followed by a comment is not merged",
+			xml:  "<v>a<!-- c -->b</v>",
+			expecteds: []xmltokenizer.Token{
+				{Name: v, Data: []byte("a")},
+				{Data: []byte("<!-- c -->"), SelfClosing: true},
+				{Data: []byte("b")},
+				{Name: v, IsEndElement: true},
+			},
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(tc.xml),
+				xmltokenizer.WithReadBufferSize(1),
+				xmltokenizer.WithMergeCharData(true),
+			)
+			for j, expected := range tc.expecteds {
+				token, err := tok.Token()
+				if err != nil {
+					t.Fatalf("%d: %v", j, err)
+				}
+				if diff := cmp.Diff(token, expected, ignoreUnexported, ignoreIsCDATA); diff != "" {
+					t.Fatalf("%d: %s", j, diff)
+				}
+			}
+			if _, err := tok.Token(); err != io.EOF {
+				t.Fatalf("expected EOF, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestLineEnding(t *testing.T) {
+	tt := []struct {
+		filename string
+		expected string
+	}{
+		{filename: "cdata.xml", expected: "\n"},
+		{filename: "cdata_clrf.xml", expected: "\r\n"},
+	}
+
+	for _, tc := range tt {
+		for _, size := range []int{1, 4096} {
+			t.Run(fmt.Sprintf("%s read buffer %d", tc.filename, size), func(t *testing.T) {
+				f, err := os.Open(filepath.Join("testdata", tc.filename))
+				if err != nil {
+					panic(err)
+				}
+				defer f.Close()
+
+				tok := xmltokenizer.New(f, xmltokenizer.WithReadBufferSize(size))
+				for {
+					if _, err = tok.Token(); err != nil {
+						break
+					}
+				}
+				if err != io.EOF {
+					t.Fatal(err)
+				}
+				if le := tok.LineEnding(); le != tc.expected {
+					t.Fatalf("expected: %q, got: %q", tc.expected, le)
+				}
+			})
+		}
+	}
+
+	tok := xmltokenizer.New(strings.NewReader("<a/>"))
+	tok.Token()
+	if le := tok.LineEnding(); le != "\n" {
+		t.Fatalf("expected default: %q, got: %q", "\n", le)
+	}
+}
+
+func TestDeclaration(t *testing.T) {
+	type decl struct {
+		Version    string
+		Encoding   string
+		Standalone bool
+		OK         bool
+	}
+
+	tt := []struct {
+		name     string
+		filename string
+		xml      string
+		expected decl
+	}{
+		{filename: "cdata.xml", expected: decl{Version: "1.0", Encoding: "UTF-8", OK: true}},
+		{filename: "copyright_header.xml", expected: decl{Version: "1.0", Encoding: "UTF-8", OK: true}},
+		{filename: "xlsx_sheet1.xml", expected: decl{Version: "1.0", Encoding: "UTF-8", Standalone: true, OK: true}},
+		{name: "single quotes", xml: "<?xml version='1.1' encoding='ISO-8859-1' standalone='no'?><a/>",
+			expected: decl{Version: "1.1", Encoding: "ISO-8859-1", OK: true}},
+		{name: "without declaration", xml: "<a><b/></a>", expected: decl{}},
+		{name: "stylesheet is not a declaration", xml: "<?xml-stylesheet href='a.xsl'?><a/>", expected: decl{}},
+		{name: "declaration after root is ignored", xml: "<a/><?xml version=\"1.0\"?>", expected: decl{}},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s%s", i, tc.name, tc.filename), func(t *testing.T) {
+			var r io.Reader = strings.NewReader(tc.xml)
+			if tc.filename != "" {
+				f, err := os.Open(filepath.Join("testdata", tc.filename))
+				if err != nil {
+					panic(err)
+				}
+				defer f.Close()
+				r = f
+			}
+
+			tok := xmltokenizer.New(r)
+			if _, _, _, ok := tok.Declaration(); ok {
+				t.Fatalf("expected no declaration before the first Token")
+			}
+			for {
+				if _, err := tok.Token(); err != nil {
+					break
+				}
+			}
+
+			var d decl
+			d.Version, d.Encoding, d.Standalone, d.OK = tok.Declaration()
+			if diff := cmp.Diff(d, tc.expected); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestDeclarationAllocs(t *testing.T) {
+	const xml = `<?xml version="1.1" encoding="UTF-8"?><a><b/></a>`
+	r := strings.NewReader(xml)
+	tok := xmltokenizer.New(r)
+
+	alloc := testing.AllocsPerRun(10, func() {
+		r.Reset(xml)
+		tok.Reset(r)
+		for {
+			if _, err := tok.Token(); err != nil {
+				break
+			}
+		}
+	})
+	if alloc != 0 {
+		t.Fatalf("expected alloc: 0, got: %g", alloc)
+	}
+
+	version, encoding, _, ok := tok.Declaration()
+	if version != "1.1" || encoding != "UTF-8" || !ok {
+		t.Fatalf("unexpected declaration: %q %q %t", version, encoding, ok)
+	}
+}
+
+func TestStandaloneDeclaration(t *testing.T) {
+	const body = `<!DOCTYPE a SYSTEM "http://example.com/a.dtd">` +
+		`<a b="&ext; &amp;">&ext; &amp; &#169;</a>`
+
+	for i, standalone := range []string{"yes", "no"} {
+		t.Run(fmt.Sprintf("[%d]: standalone=%q", i, standalone), func(t *testing.T) {
+			xml := `<?xml version="1.0" standalone="` + standalone + `"?>` + body
+			tok := xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithEntityDecoding(true))
+
+			var a xmltokenizer.Token
+			for {
+				token, err := tok.Token()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(token.Name.Local) == "a" {
+					a = token
+					break
+				}
+			}
+
+			if _, _, s, _ := tok.Declaration(); s != (standalone == "yes") {
+				t.Fatalf("expected standalone: %t, got: %t", standalone == "yes", s)
+			}
+			// The external entity is never resolved, only the predefined ones are decoded.
+			if attr, _ := a.Attr("b"); string(attr.Value) != "&ext; &" {
+				t.Fatalf("unexpected attr value: %q", attr.Value)
+			}
+			if string(a.Data) != "&ext; & ©" {
+				t.Fatalf("unexpected data: %q", a.Data)
+			}
+		})
+	}
+}
+
+func TestExternalEntityNotResolved(t *testing.T) {
+	const xml = `<!DOCTYPE x [<!ENTITY e SYSTEM "file:///etc/passwd">]><x>&e;</x>`
+
+	for _, decoding := range []bool{false, true} {
+		t.Run(fmt.Sprintf("entityDecoding=%t", decoding), func(t *testing.T) {
+			var n int
+			r := strings.NewReader(xml)
+			tok := xmltokenizer.New(readerFunc(func(p []byte) (int, error) {
+				m, err := r.Read(p)
+				n += m
+				return m, err
+			}), xmltokenizer.WithEntityDecoding(decoding))
+
+			var data string
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(token.Name.Local) == "x" && !token.IsEndElement {
+					data = string(token.Data)
+				}
+			}
+
+			if data != "&e;" {
+				t.Fatalf("expected Data: %q, got: %q", "&e;", data)
+			}
+			// Only the input is read, the external entity is never loaded.
+			if n != len(xml) {
+				t.Fatalf("expected read bytes: %d, got: %d", len(xml), n)
+			}
+		})
+	}
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestReaderBufferReuse(t *testing.T) {
+	for _, filename := range []string{"cdata.xml", "dtd.xml", "xlsx_sheet1.xml", "ride_bedugul_laps.tcx"} {
+		t.Run(filename, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", filename))
+			if err != nil {
+				panic(err)
+			}
+
+			for _, r := range []io.Reader{
+				bytes.NewReader(data),
+				bytes.NewBuffer(data),
+				strings.NewReader(string(data)),
+			} {
+				expectedTok := xmltokenizer.New(bytes.NewReader(data))
+				tok := xmltokenizer.New(r, xmltokenizer.WithReaderBufferReuse(true))
+				for i := 0; ; i++ {
+					expected, expectedErr := expectedTok.Token()
+					token, err := tok.Token()
+					if err != expectedErr {
+						t.Fatalf("%T: %d: expected error: %v, got: %v", r, i, expectedErr, err)
+					}
+					if err != nil {
+						break
+					}
+					if diff := cmp.Diff(token, expected, ignoreUnexported); diff != "" {
+						t.Fatalf("%T: %d: %s", r, i, diff)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLessThanInAttrValue(t *testing.T) {
+	const xml = `<a title="x<y" alt='1 < 2'>text</a><b/>`
+
+	for _, lazy := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lazy=%t", lazy), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(xml),
+				xmltokenizer.WithReadBufferSize(1),
+				xmltokenizer.WithLazyAttrs(lazy),
+			)
+
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v := string(token.AttrValue("title")); v != "x<y" {
+				t.Fatalf("expected title: %q, got: %q", "x<y", v)
+			}
+			if string(token.Data) != "text" {
+				t.Fatalf("expected Data: %q, got: %q", "text", token.Data)
+			}
+
+			tok.Token() // </a>
+			token, err = tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(token.Name.Full) != "b" || !token.SelfClosing {
+				t.Fatalf("expected <b/>, got: <%s>", token.Name.Full)
+			}
+		})
+	}
+}
+
+func TestSpill(t *testing.T) {
+	blob := strings.Repeat("QUJD<RA>==", 50<<10) // 500 KB, '<' and '>' must not end the token.
+
+	tt := []struct {
+		name     string
+		xml      string
+		spilled  []string
+		expected []string // Name.Local or Data of the returned tokens
+		err      error
+	}{
+		{
+			name:     "comment",
+			xml:      "<a><!--" + blob + "--><b>x</b></a>",
+			spilled:  []string{"<!--" + blob + "-->"},
+			expected: []string{"a", "b", "b", "a"},
+		},
+		{
+			name:     "cdata after a tag",
+			xml:      "<a>text<![CDATA[" + blob + "]]></a>",
+			spilled:  []string{"<![CDATA[" + blob + "]]>"},
+			expected: []string{"a", "a"},
+		},
+		{
+			name:     "procinst and directive",
+			xml:      "<?pi " + blob + "?><!DOCTYPE a [<!ENTITY e \"" + blob + "\">]><a/>",
+			spilled:  []string{"<?pi " + blob + "?>", "<!DOCTYPE a [<!ENTITY e \"" + blob + "\">]>"},
+			expected: []string{"a"},
+		},
+		{
+			name:     "small comment is not spilled",
+			xml:      "<a><!-- x > y < z --></a>",
+			expected: []string{"a", "<!-- x > y < z -->", "a"},
+		},
+		{
+			name:     "unterminated",
+			xml:      "<a><!--" + blob,
+			expected: []string{"a"},
+			err:      io.ErrUnexpectedEOF,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			var spilled []string
+			var cur []byte
+			var maxChunk int
+			spill := func(chunk []byte, last bool) error {
+				if len(chunk) > maxChunk {
+					maxChunk = len(chunk)
+				}
+				cur = append(cur, chunk...)
+				if last {
+					spilled = append(spilled, string(cur))
+					cur = cur[:0]
+				}
+				return nil
+			}
+
+			tok := xmltokenizer.New(strings.NewReader(tc.xml),
+				xmltokenizer.WithReadBufferSize(1<<10),
+				xmltokenizer.WithAutoGrowBufferMaxLimitSize(64<<10),
+				xmltokenizer.WithSpill(spill),
+			)
+
+			var results []string
+			var err error
+			for {
+				var token xmltokenizer.Token
+				if token, err = tok.Token(); err != nil {
+					break
+				}
+				if len(token.Name.Local) > 0 {
+					results = append(results, string(token.Name.Local))
+				} else {
+					results = append(results, string(token.Data))
+				}
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if tc.err != nil {
+				if len(cur) == 0 { // Unterminated, last is never true.
+					t.Fatalf("expected partial chunks to be spilled")
+				}
+			}
+			if diff := cmp.Diff(results, tc.expected); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(spilled, tc.spilled); diff != "" {
+				t.Fatalf("%.1000s", diff)
+			}
+			if maxChunk > 128<<10 {
+				t.Fatalf("expected bounded chunk, got: %d", maxChunk)
+			}
+		})
+	}
+
+	t.Run("spill error", func(t *testing.T) {
+		errSpill := errors.New("spill error")
+		tok := xmltokenizer.New(strings.NewReader("<!--"+blob+"--><a/>"),
+			xmltokenizer.WithReadBufferSize(1<<10),
+			xmltokenizer.WithAutoGrowBufferMaxLimitSize(64<<10),
+			xmltokenizer.WithSpill(func(chunk []byte, last bool) error { return errSpill }),
+		)
+		if _, err := tok.Token(); !errors.Is(err, errSpill) {
+			t.Fatalf("expected: %v, got: %v", errSpill, err)
+		}
+	})
+}
+
+func TestInputPos(t *testing.T) {
+	type pos struct {
+		Name         string
+		Line, Column int
+	}
+
+	tt := []struct {
+		name      string
+		xml       string
+		expecteds []pos
+	}{
+		{
+			name: "xml 1.0",
+			xml:  "<?xml version=\"1.0\"?>\n<a>\r\n  <b/>\u0085<c>text\n</c><!-- \n -->\n\t<d/></a>",
+			expecteds: []pos{
+				{Name: "", Line: 1, Column: 1},
+				{Name: "a", Line: 2, Column: 1},
+				{Name: "b", Line: 3, Column: 3},
+				{Name: "c", Line: 3, Column: 9}, // NEL is not a line break in XML 1.0.
+				{Name: "c", Line: 4, Column: 1},
+				{Name: "", Line: 4, Column: 5},
+				{Name: "d", Line: 6, Column: 2},
+				{Name: "a", Line: 6, Column: 6},
+			},
+		},
+		{
+			name: "xml 1.1 with NEL and LS",
+			xml:  "<?xml version=\"1.1\"?>\u0085<a>\u0085  <b/>\u2028<c>text\u0085</c>\r\u0085<d/></a>",
+			expecteds: []pos{
+				{Name: "", Line: 1, Column: 1},
+				{Name: "", Line: 1, Column: 22}, // NEL is not a whitespace, it is a CharData.
+				{Name: "a", Line: 2, Column: 1},
+				{Name: "b", Line: 3, Column: 3},
+				{Name: "c", Line: 4, Column: 1},
+				{Name: "c", Line: 5, Column: 1},
+				{Name: "d", Line: 6, Column: 1},
+				{Name: "a", Line: 6, Column: 5},
+			},
+		},
+	}
+
+	for i, tc := range tt {
+		for _, size := range []int{1, 4096} {
+			t.Run(fmt.Sprintf("[%d]: %s: read buffer size %d", i, tc.name, size), func(t *testing.T) {
+				tok := xmltokenizer.New(strings.NewReader(tc.xml),
+					xmltokenizer.WithReadBufferSize(size),
+					xmltokenizer.WithPositionTracking(true),
+				)
+				var results []pos
+				for {
+					token, err := tok.Token()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					line, column := tok.InputPos()
+					results = append(results, pos{Name: string(token.Name.Local), Line: line, Column: column})
+				}
+				if diff := cmp.Diff(results, tc.expecteds); diff != "" {
+					t.Fatal(diff)
+				}
+			})
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("\n\n<a/>"))
+		tok.Token()
+		if line, column := tok.InputPos(); line != 1 || column != 1 {
+			t.Fatalf("expected: 1:1, got: %d:%d", line, column)
+		}
+	})
+}
+
+func TestCommentAndCharDataTrim(t *testing.T) {
+	tt := []struct {
+		filename     string
+		commentTrim  bool
+		charDataTrim bool
+		expected     []string // Data of the first tokens
+	}{
+		{
+			filename:     "copyright_header.xml",
+			commentTrim:  false,
+			charDataTrim: true,
+			expected:     []string{"<!--\n  Copyright 2024 Example Licence Authors.\n-->"},
+		},
+		{
+			filename:     "copyright_header.xml",
+			commentTrim:  true,
+			charDataTrim: true,
+			expected:     []string{"<!--Copyright 2024 Example Licence Authors.-->"},
+		},
+		{
+			filename:     "comment_in_content.xml",
+			commentTrim:  false,
+			charDataTrim: true,
+			expected:     []string{`<?xml version="1.0" encoding="UTF-8"?>`, "", "before", "<!-- c -->", "after"},
+		},
+		{
+			filename:     "comment_in_content.xml",
+			commentTrim:  true,
+			charDataTrim: true,
+			expected:     []string{`<?xml version="1.0" encoding="UTF-8"?>`, "", "before", "<!--c-->", "after"},
+		},
+		{
+			filename:     "comment_in_content.xml",
+			commentTrim:  true,
+			charDataTrim: false,
+			expected:     []string{`<?xml version="1.0" encoding="UTF-8"?>`, "\n  ", "before", "<!--c-->", "after"},
+		},
+		{
+			filename:     "comment_in_content.xml",
+			commentTrim:  false,
+			charDataTrim: false,
+			expected:     []string{`<?xml version="1.0" encoding="UTF-8"?>`, "\n  ", "before", "<!-- c -->", "after"},
+		},
+	}
+
+	for i, tc := range tt {
+		name := fmt.Sprintf("[%d]: %s: commentTrim=%t charDataTrim=%t", i, tc.filename, tc.commentTrim, tc.charDataTrim)
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tc.filename))
+			if err != nil {
+				panic(err)
+			}
+			defer f.Close()
+
+			tok := xmltokenizer.New(f,
+				xmltokenizer.WithCommentTrim(tc.commentTrim),
+				xmltokenizer.WithCharDataTrim(tc.charDataTrim),
+			)
+			var results []string
+			for range tc.expected {
+				token, err := tok.Token()
+				if err != nil {
+					t.Fatal(err)
+				}
+				results = append(results, string(token.Data))
+			}
+			if diff := cmp.Diff(results, tc.expected); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func FuzzToken(f *testing.F) {
+	for _, seed := range []string{
+		"<",
+		"<a><",
+		"</",
+		"<a>text</a><",
+		`<a b="1"/><!-- c --><?pi?><![CDATA[x]]>`,
+		"<?xml version=\"1.0\"?>\n<a><b>1</b></a>",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, opts := range [][]xmltokenizer.Option{
+			nil,
+			{xmltokenizer.WithReadBufferSize(1), xmltokenizer.WithStrict(true)},
+			{xmltokenizer.WithLazyAttrs(true), xmltokenizer.WithMergeCharData(true)},
+		} {
+			tok := xmltokenizer.New(bytes.NewReader(data), opts...)
+			for i := 0; i <= len(data); i++ { // Every token consumes at least a byte.
+				if _, err := tok.Token(); err != nil {
+					break
+				}
+			}
+		}
+	})
+}
+
+func TestEntityDecoding(t *testing.T) {
+	tt := []struct {
+		name     string
+		in       string
+		opts     []xmltokenizer.Option
+		expected []string // attribute a's value and the CharData of the root
+	}{
+		{
+			name:     "decimal",
+			in:       `<r a="&#169;">&#169;</r>`,
+			expected: []string{"©", "©"},
+		},
+		{
+			name:     "hexadecimal",
+			in:       `<r a="&#xA9;&#x1F600;">&#xa9;</r>`,
+			expected: []string{"©😀", "©"},
+		},
+		{
+			name:     "predefined",
+			in:       `<r a="&lt;&gt;&amp;&quot;&apos;">&lt;b&gt;</r>`,
+			expected: []string{`<>&"'`, "<b>"},
+		},
+		{
+			name:     "mixed",
+			in:       `<r a="x &amp; &#38; y">x &amp; &#38; y</r>`,
+			expected: []string{"x & & y", "x & & y"},
+		},
+		{
+			name:     "unknown and malformed kept as is",
+			in:       `<r a="&nbsp; &#; &#xZ; &#0; &#1114112; &amp">&foo;</r>`,
+			expected: []string{"&nbsp; &#; &#xZ; &#0; &#1114112; &amp", "&foo;"},
+		},
+		{
+			name:     "cdata is not decoded",
+			in:       `<r a="&amp;"><![CDATA[&amp;]]></r>`,
+			expected: []string{"&", "&amp;"},
+		},
+		{
+			name:     "merged cdata",
+			in:       `<r a="&amp;">&amp;<![CDATA[&amp;]]>&#38;</r>`,
+			opts:     []xmltokenizer.Option{xmltokenizer.WithMergeCharData(true)},
+			expected: []string{"&", "&&amp;&"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]xmltokenizer.Option{
+				xmltokenizer.WithReadBufferSize(1),
+				xmltokenizer.WithEntityDecoding(true),
+			}, tc.opts...)
+			tok := xmltokenizer.New(strings.NewReader(tc.in), opts...)
+
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(token.Attrs) != 1 {
+				t.Fatalf("expected 1 attr, got: %d", len(token.Attrs))
+			}
+			result := []string{string(token.Attrs[0].Value), string(token.Data)}
+
+			if diff := cmp.Diff(result, tc.expected); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader(`<r a="&amp;">&#38;</r>`))
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := string(token.Attrs[0].Value); v != "&amp;" {
+			t.Fatalf("expected: %q, got: %q", "&amp;", v)
+		}
+	})
+}
+
+func TestEntityDecodingAcrossBufferBoundaries(t *testing.T) {
+	const text = `&#x1F600; &#128512;&amp;&lt;x&gt;&#xA9;&#169;`
+	const expected = "\U0001F600 \U0001F600&<x>\u00A9\u00A9"
+
+	for size := 1; size <= len(text); size++ {
+		t.Run(fmt.Sprintf("read buffer %d", size), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader("<a>"+text+"</a>"),
+				xmltokenizer.WithReadBufferSize(size),
+				xmltokenizer.WithEntityDecoding(true),
+			)
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := string(token.Data); s != expected {
+				t.Fatalf("expected: %q, got: %q", expected, s)
+			}
+		})
+	}
+
+	// The CharData exceeding the buffer limit is streamed in chunks of the read buffer size.
+	for size := 1; size <= 16; size++ {
+		t.Run(fmt.Sprintf("streamed read buffer %d", size), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader("<a>"+strings.Repeat(text, 64)+"</a>"),
+				xmltokenizer.WithReadBufferSize(size),
+				xmltokenizer.WithAutoGrowBufferMaxLimitSize(16),
+			)
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(tok.TextReader(&token))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := string(b); s != strings.Repeat(expected, 64) {
+				t.Fatalf("expected: %q, got: %q", strings.Repeat(expected, 64), s)
+			}
+		})
+	}
+}
+
+func TestDirectiveInternalSubset(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "dtd_attlist.xml"))
+	if err != nil {
+		panic(err)
+	}
+	start := bytes.Index(data, []byte("<!DOCTYPE"))
+	end := bytes.Index(data, []byte("]>")) + len("]>")
+	doctype := string(data[start:end])
+
+	for _, size := range []int{1, 4096} {
+		t.Run(fmt.Sprintf("read buffer size %d", size), func(t *testing.T) {
+			tok := xmltokenizer.New(bytes.NewReader(data), xmltokenizer.WithReadBufferSize(size))
+
+			var result []string // Name.Full or Data of the returned tokens
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(token.Name.Full) > 0 {
+					result = append(result, string(token.Name.Full))
+				} else {
+					result = append(result, string(token.Data))
+				}
+			}
+
+			expected := []string{
+				`<?xml version="1.0" encoding="UTF-8"?>`,
+				doctype,
+				"note", "to", "to", "body", "body", "note",
+			}
+			if diff := cmp.Diff(result, expected); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	tt := []struct {
+		filename string
+		expected string // the truncated construct named in the error
+	}{
+		{filename: "tag_truncated.xml", expected: "truncated start element"},
+		{filename: "attr_value_truncated.xml", expected: "truncated attribute value"},
+		{filename: "end_element_truncated.xml", expected: "truncated end element"},
+		{filename: "comment_truncated.xml", expected: "truncated comment"},
+		{filename: "cdata_truncated.xml", expected: "truncated CDATA section"},
+		{filename: "procinst_truncated.xml", expected: "truncated processing instruction"},
+		{filename: "doctype_truncated.xml", expected: "truncated directive"},
+	}
+
+	for _, tc := range tt {
+		for _, size := range []int{1, 4096} {
+			t.Run(fmt.Sprintf("%s read buffer size %d", tc.filename, size), func(t *testing.T) {
+				f, err := os.Open(filepath.Join("testdata", "corrupted", tc.filename))
+				if err != nil {
+					panic(err)
+				}
+				defer f.Close()
+
+				tok := xmltokenizer.New(f, xmltokenizer.WithReadBufferSize(size))
+				for {
+					if _, err = tok.Token(); err != nil {
+						break
+					}
+				}
+				if !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Fatalf("expected: %v, got: %v", io.ErrUnexpectedEOF, err)
+				}
+				if !strings.Contains(err.Error(), tc.expected) {
+					t.Fatalf("expected error containing %q, got: %v", tc.expected, err)
+				}
+			})
+		}
+	}
+}
+
+func TestNamesOnly(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "xlsx_sheet1.xml"))
+	if err != nil {
+		panic(err)
+	}
+
+	type element struct {
+		Name         string
+		SelfClosing  bool
+		IsEndElement bool
+	}
+	elements := func(namesOnly bool) (result []element) {
+		tok := xmltokenizer.New(bytes.NewReader(data),
+			xmltokenizer.WithReadBufferSize(1),
+			xmltokenizer.WithNamesOnly(namesOnly),
+		)
+		for {
+			token, err := tok.Token()
+			if err == io.EOF {
+				return result
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(token.Name.Full) == 0 {
+				continue
+			}
+			if namesOnly && (token.Attrs != nil || token.Data != nil) {
+				t.Fatalf("expected nil Attrs and Data, got: %s", token.String())
+			}
+			result = append(result, element{
+				Name:         string(token.Name.Full),
+				SelfClosing:  token.SelfClosing,
+				IsEndElement: token.IsEndElement,
+			})
+		}
+	}
+
+	if diff := cmp.Diff(elements(true), elements(false)); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestNoCDATA(t *testing.T) {
+	t.Run("CDATA-free input is unaffected", func(t *testing.T) {
+		data, err := os.ReadFile(filepath.Join("testdata", "hike_mt_prau.gpx"))
+		if err != nil {
+			panic(err)
+		}
+
+		tok := xmltokenizer.New(bytes.NewReader(data), xmltokenizer.WithReadBufferSize(1<<10))
+		noCDATA := xmltokenizer.New(bytes.NewReader(data), xmltokenizer.WithReadBufferSize(1<<10), xmltokenizer.WithNoCDATA(true))
+		for i := 0; ; i++ {
+			expected, err := tok.Token()
+			token, err2 := noCDATA.Token()
+			if err2 != err {
+				t.Fatalf("[%d]: expected error: %v, got: %v", i, err, err2)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(token, expected, ignoreUnexported); diff != "" {
+				t.Fatalf("[%d]: %s", i, diff)
+			}
+		}
+	})
+
+	t.Run("CDATA is mis-tokenized", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<a>text<![CDATA[<b>]]></a>"), xmltokenizer.WithNoCDATA(true))
+		expecteds := []xmltokenizer.Token{
+			{Name: xmltokenizer.Name{Local: []byte("a"), Full: []byte("a")}, Data: []byte("text")},
+			{Data: []byte("<![CDATA[<b>]]>"), SelfClosing: true},
+			{Name: xmltokenizer.Name{Local: []byte("a"), Full: []byte("a")}, IsEndElement: true},
+		}
+		for i, expected := range expecteds {
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(token, expected, ignoreUnexported); diff != "" {
+				t.Fatalf("[%d]: %s", i, diff)
+			}
+		}
+	})
+}
+
+func TestPreserveWhitespace(t *testing.T) {
+	tt := []struct {
+		name      string
+		opts      []xmltokenizer.Option
+		expecteds map[string]string
+	}{
+		{
+			name: "default",
+			expecteds: map[string]string{
+				"csv": "", "sep": "", "tab": "", "newline": "", "empty": "", "name": "padded", "row": "", "cell": "a",
+			},
+		},
+		{
+			name: "preserve whitespace",
+			opts: []xmltokenizer.Option{xmltokenizer.WithPreserveWhitespace(true)},
+			expecteds: map[string]string{
+				"csv": "", "sep": " ", "tab": "\t", "newline": "\n", "empty": "", "name": "padded", "row": "", "cell": "a",
+			},
+		},
+		{
+			name: "preserve whitespace without cdata",
+			opts: []xmltokenizer.Option{xmltokenizer.WithPreserveWhitespace(true), xmltokenizer.WithNoCDATA(true)},
+			expecteds: map[string]string{
+				"csv": "", "sep": " ", "tab": "\t", "newline": "\n", "empty": "", "name": "padded", "row": "", "cell": "a",
+			},
+		},
+	}
+
+	for i, tc := range tt {
+		for _, size := range []int{1, 4096} {
+			t.Run(fmt.Sprintf("[%d]: %s, read buffer %d", i, tc.name, size), func(t *testing.T) {
+				f, err := os.Open(filepath.Join("testdata", "preserve_whitespace.xml"))
+				if err != nil {
+					panic(err)
+				}
+				defer f.Close()
+
+				tok := xmltokenizer.New(f, append(tc.opts, xmltokenizer.WithReadBufferSize(size))...)
+				datas := make(map[string]string)
+				for {
+					token, err := tok.Token()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(token.Name.Full) > 0 && !token.IsEndElement {
+						datas[string(token.Name.Local)] = string(token.Data)
+					}
+				}
+				if diff := cmp.Diff(datas, tc.expecteds); diff != "" {
+					t.Fatal(diff)
+				}
+			})
+		}
+	}
+}
+
+func TestLatin1Fallback(t *testing.T) {
+	tt := []struct {
+		latin1Fallback bool
+		expecteds      map[string]string
+	}{
+		{
+			latin1Fallback: false,
+			expecteds:      map[string]string{"title": "It\x92s \x93quoted\x94 caf\xe9", "valid": "It’s fine"},
+		},
+		{
+			latin1Fallback: true,
+			expecteds:      map[string]string{"title": "It’s “quoted” café", "valid": "It’s fine"},
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: latin1 fallback %t", i, tc.latin1Fallback), func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", "windows1252_as_utf8.xml"))
+			if err != nil {
+				panic(err)
+			}
+			defer f.Close()
+
+			tok := xmltokenizer.New(f, xmltokenizer.WithLatin1Fallback(tc.latin1Fallback))
+			datas := make(map[string]string)
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(token.Data) > 0 && len(token.Name.Full) > 0 {
+					datas[string(token.Name.Local)] = string(token.Data)
+				}
+			}
+			if diff := cmp.Diff(datas, tc.expecteds); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestWhitespaceChars(t *testing.T) {
+	const xml = "<a\fk=\"\f v \v\">\f\v text \f<b/>\f</a>\f\n"
+
+	tok := xmltokenizer.New(strings.NewReader(xml),
+		xmltokenizer.WithReadBufferSize(1),
+		xmltokenizer.WithWhitespaceChars("\v\f"),
+	)
+	var result []string
+	for {
+		token, err := tok.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := string(token.Name.Full)
+		for _, attr := range token.Attrs {
+			s += fmt.Sprintf(" %s=%q", attr.Name.Full, attr.Value)
+		}
+		result = append(result, fmt.Sprintf("%s %q", s, token.Data))
+	}
+	expected := []string{`a k="v" "text"`, `b ""`, `a ""`}
+	if diff := cmp.Diff(result, expected); diff != "" {
+		t.Fatal(diff)
+	}
+
+	t.Run("default", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader("<a>\f text \f</a>"))
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(token.Data) != "\f text \f" {
+			t.Fatalf("expected the form feeds to be kept, got: %q", token.Data)
+		}
+	})
+}
+
+func TestOptionGetters(t *testing.T) {
+	tt := []struct {
+		name                       string
+		options                    []xmltokenizer.Option
+		readBufferSize             int
+		autoGrowBufferMaxLimitSize int
+		attrBufferSize             int
+	}{
+		{
+			name:                       "default",
+			readBufferSize:             4 << 10,
+			autoGrowBufferMaxLimitSize: 1000 << 10,
+			attrBufferSize:             16,
+		},
+		{
+			name: "less than 0",
+			options: []xmltokenizer.Option{
+				xmltokenizer.WithReadBufferSize(-1),
+				xmltokenizer.WithAttrBufferSize(-1),
+				xmltokenizer.WithAutoGrowBufferMaxLimitSize(-1),
+			},
+			readBufferSize:             4 << 10,
+			autoGrowBufferMaxLimitSize: 1000 << 10,
+			attrBufferSize:             16,
+		},
+		{
+			name: "readBufferSize > maxLimitGrowBufferSize",
+			options: []xmltokenizer.Option{
+				xmltokenizer.WithReadBufferSize(4 << 10),
+				xmltokenizer.WithAutoGrowBufferMaxLimitSize(1 << 10),
+				xmltokenizer.WithAttrBufferSize(32),
+			},
+			readBufferSize:             4 << 10,
+			autoGrowBufferMaxLimitSize: 4 << 10,
+			attrBufferSize:             32,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tok := xmltokenizer.New(nil, tc.options...)
+			if n := tok.ReadBufferSize(); n != tc.readBufferSize {
+				t.Fatalf("expected ReadBufferSize: %d, got: %d", tc.readBufferSize, n)
+			}
+			if n := tok.AutoGrowBufferMaxLimitSize(); n != tc.autoGrowBufferMaxLimitSize {
+				t.Fatalf("expected AutoGrowBufferMaxLimitSize: %d, got: %d", tc.autoGrowBufferMaxLimitSize, n)
+			}
+			if n := tok.AttrBufferSize(); n != tc.attrBufferSize {
+				t.Fatalf("expected AttrBufferSize: %d, got: %d", tc.attrBufferSize, n)
+			}
+		})
+	}
+}
+
+func TestDefaultBufferSizes(t *testing.T) {
+	if xmltokenizer.DefaultReadBufferSize != 4<<10 {
+		t.Fatalf("expected DefaultReadBufferSize: %d, got: %d", 4<<10, xmltokenizer.DefaultReadBufferSize)
+	}
+	if xmltokenizer.DefaultMaxBufferSize != 1000<<10 {
+		t.Fatalf("expected DefaultMaxBufferSize: %d, got: %d", 1000<<10, xmltokenizer.DefaultMaxBufferSize)
+	}
+	if xmltokenizer.DefaultAttrsBufferSize != 16 {
+		t.Fatalf("expected DefaultAttrsBufferSize: %d, got: %d", 16, xmltokenizer.DefaultAttrsBufferSize)
+	}
+
+	tok := xmltokenizer.New(nil)
+	if n := tok.ReadBufferSize(); n != xmltokenizer.DefaultReadBufferSize {
+		t.Fatalf("expected ReadBufferSize: %d, got: %d", xmltokenizer.DefaultReadBufferSize, n)
+	}
+	if n := tok.AutoGrowBufferMaxLimitSize(); n != xmltokenizer.DefaultMaxBufferSize {
+		t.Fatalf("expected AutoGrowBufferMaxLimitSize: %d, got: %d", xmltokenizer.DefaultMaxBufferSize, n)
+	}
+	if n := tok.AttrBufferSize(); n != xmltokenizer.DefaultAttrsBufferSize {
+		t.Fatalf("expected AttrBufferSize: %d, got: %d", xmltokenizer.DefaultAttrsBufferSize, n)
+	}
+
+	// The sizes can be derived from the defaults.
+	tok = xmltokenizer.New(nil,
+		xmltokenizer.WithReadBufferSize(10*xmltokenizer.DefaultReadBufferSize),
+		xmltokenizer.WithAttrBufferSize(2*xmltokenizer.DefaultAttrsBufferSize),
+	)
+	if n := tok.ReadBufferSize(); n != 40<<10 {
+		t.Fatalf("expected ReadBufferSize: %d, got: %d", 40<<10, n)
+	}
+	if n := tok.AttrBufferSize(); n != 32 {
+		t.Fatalf("expected AttrBufferSize: %d, got: %d", 32, n)
+	}
+}
+
+func TestInvalidBufferConfig(t *testing.T) {
+	const xml = `<a><b>text</b></a>`
+	contradictory := []xmltokenizer.Option{
+		xmltokenizer.WithReadBufferSize(4 << 10),
+		xmltokenizer.WithAutoGrowBufferMaxLimitSize(1 << 10),
+		xmltokenizer.WithStrictBufferConfig(true),
+	}
+
+	tt := []struct {
+		name string
+		new  func() *xmltokenizer.Tokenizer
+		err  error
+	}{
+		{
+			name: "contradictory",
+			new:  func() *xmltokenizer.Tokenizer { return xmltokenizer.New(strings.NewReader(xml), contradictory...) },
+			err:  xmltokenizer.ErrInvalidBufferConfig,
+		},
+		{
+			name: "contradictory not strict",
+			new: func() *xmltokenizer.Tokenizer {
+				return xmltokenizer.New(strings.NewReader(xml), append(contradictory, xmltokenizer.WithStrictBufferConfig(false))...)
+			},
+		},
+		{
+			name: "equal",
+			new: func() *xmltokenizer.Tokenizer {
+				return xmltokenizer.New(strings.NewReader(xml),
+					xmltokenizer.WithReadBufferSize(1<<10),
+					xmltokenizer.WithAutoGrowBufferMaxLimitSize(1<<10),
+				)
+			},
+		},
+		{
+			name: "contradictory on Reset",
+			new: func() *xmltokenizer.Tokenizer {
+				tok := xmltokenizer.New(nil)
+				tok.Reset(strings.NewReader(xml), contradictory...)
+				return tok
+			},
+			err: xmltokenizer.ErrInvalidBufferConfig,
+		},
+		{
+			name: "valid on Reset after contradictory",
+			new: func() *xmltokenizer.Tokenizer {
+				tok := xmltokenizer.New(nil, contradictory...)
+				tok.Reset(strings.NewReader(xml))
+				return tok
+			},
+		},
+		{
+			name: "SetOptions ignores the buffer options",
+			new: func() *xmltokenizer.Tokenizer {
+				tok := xmltokenizer.New(strings.NewReader(xml))
+				tok.SetOptions(contradictory...)
+				return tok
+			},
+		},
+		{
+			name: "NewFromBytes ignores the buffer options",
+			new:  func() *xmltokenizer.Tokenizer { return xmltokenizer.NewFromBytes([]byte(xml), contradictory...) },
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := tc.new()
+			var err error
+			for err == nil {
+				_, err = tok.Token()
+			}
+			if tc.err == nil && err != io.EOF {
+				t.Fatalf("expected: %v, got: %v", io.EOF, err)
+			}
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Fatalf("expected: %v, got: %v", tc.err, err)
+			}
+
+			if tc.err != nil {
+				if _, err = tc.new().RawToken(); !errors.Is(err, tc.err) {
+					t.Fatalf("RawToken: expected: %v, got: %v", tc.err, err)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxTokens(t *testing.T) {
+	const xml = `<a><b/><c>text</c></a>`
+
+	tt := []struct {
+		name      string
+		opts      []xmltokenizer.Option
+		expecteds []string
+		err       error
+	}{
+		{
+			name:      "unlimited",
+			opts:      []xmltokenizer.Option{xmltokenizer.WithMaxTokens(0)},
+			expecteds: []string{"<a>", "<b/>", "<c>", "</c>", "</a>"},
+			err:       io.EOF,
+		},
+		{
+			name:      "exactly the limit",
+			opts:      []xmltokenizer.Option{xmltokenizer.WithMaxTokens(5)},
+			expecteds: []string{"<a>", "<b/>", "<c>", "</c>", "</a>"},
+			err:       io.EOF,
+		},
+		{
+			name:      "exceeded",
+			opts:      []xmltokenizer.Option{xmltokenizer.WithMaxTokens(3)},
+			expecteds: []string{"<a>", "<b/>", "<c>"},
+			err:       xmltokenizer.ErrMaxTokensExceeded,
+		},
+		{
+			name: "synthetic end element is counted",
+			opts: []xmltokenizer.Option{
+				xmltokenizer.WithMaxTokens(2),
+				xmltokenizer.WithSyntheticEndElements(true),
+			},
+			expecteds: []string{"<a>", "<b/>"},
+			err:       xmltokenizer.ErrMaxTokensExceeded,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(xml), tc.opts...)
+
+			var tokens []string
+			var err error
+			for {
+				var token xmltokenizer.Token
+				if token, err = tok.Token(); err != nil {
+					break
+				}
+				tokens = append(tokens, token.String())
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if diff := cmp.Diff(tokens, tc.expecteds); diff != "" {
+				t.Fatal(diff)
+			}
+			if _, err2 := tok.Token(); err2 != err {
+				t.Fatalf("expected the error to be latched, got: %v", err2)
+			}
+		})
+	}
+}
+
+func TestMaxAttrValueLen(t *testing.T) {
+	style := strings.Repeat("color:red;", 100<<10) // 1 MB
+	xml := `<html xmlns="http://www.w3.org/1999/xhtml"><p class="x" id="p1">a</p>` +
+		`<div class="y" style="` + style + `">b</div></html>`
+	html := `<html xmlns="http://www.w3.org/1999/xhtml">`
+
+	tt := []struct {
+		name      string
+		opts      []xmltokenizer.Option
+		expecteds []string
+		err       error
+		msg       string
+		offset    int64
+	}{
+		{
+			name:      "unlimited",
+			opts:      []xmltokenizer.Option{xmltokenizer.WithMaxAttrValueLen(0)},
+			expecteds: []string{html, `<p class="x" id="p1">`, "</p>", "<div>", "</div>", "</html>"},
+			err:       io.EOF,
+		},
+		{
+			name:      "exactly the limit",
+			opts:      []xmltokenizer.Option{xmltokenizer.WithMaxAttrValueLen(len(style))},
+			expecteds: []string{html, `<p class="x" id="p1">`, "</p>", "<div>", "</div>", "</html>"},
+			err:       io.EOF,
+		},
+		{
+			name:      "exceeded",
+			opts:      []xmltokenizer.Option{xmltokenizer.WithMaxAttrValueLen(64)},
+			expecteds: []string{html, `<p class="x" id="p1">`, "</p>"},
+			err:       xmltokenizer.ErrAttrValueTooLarge,
+			msg:       fmt.Sprintf(`attr "style": %d bytes, max is 64`, len(style)),
+			offset:    int64(strings.Index(xml, "color")),
+		},
+		{
+			name: "separated namespace decl is limited",
+			opts: []xmltokenizer.Option{
+				xmltokenizer.WithMaxAttrValueLen(16),
+				xmltokenizer.WithSeparateNamespaceDecls(true),
+			},
+			err:    xmltokenizer.ErrAttrValueTooLarge,
+			msg:    `attr "xmlns": 28 bytes, max is 16`,
+			offset: int64(strings.Index(xml, "http")),
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(xml), append(tc.opts,
+				xmltokenizer.WithAutoGrowBufferMaxLimitSize(2<<20))...)
+
+			var tokens []string
+			var err error
+			for {
+				var token xmltokenizer.Token
+				if token, err = tok.Token(); err != nil {
+					break
+				}
+				if string(token.Name.Local) == "div" && !token.IsEndElement {
+					if attr, _ := token.Attr("style"); len(attr.Value) != len(style) {
+						t.Fatalf("expected style of %d bytes, got: %d", len(style), len(attr.Value))
+					}
+					token.Attrs = nil // Too large to be compared.
+				}
+				tokens = append(tokens, token.String())
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if diff := cmp.Diff(tokens, tc.expecteds); diff != "" {
+				t.Fatal(diff)
+			}
+
+			var syntaxErr xmltokenizer.SyntaxError
+			if errors.As(err, &syntaxErr) && (syntaxErr.Msg != tc.msg || syntaxErr.Offset != tc.offset) {
+				t.Fatalf("expected msg: %q at %d, got: %q at %d", tc.msg, tc.offset, syntaxErr.Msg, syntaxErr.Offset)
+			}
+			if _, err2 := tok.Token(); err2 != err {
+				t.Fatalf("expected the error to be latched, got: %v", err2)
+			}
+		})
+	}
+}
+
+func TestDepth(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "hike_mt_prau.gpx"))
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	tok := xmltokenizer.New(f)
+	if depth := tok.Depth(); depth != 0 {
+		t.Fatalf("expected depth before the first token: 0, got: %d", depth)
+	}
+
+	expecteds := []struct {
+		token string
+		depth int
+	}{
+		{token: `procinst(xml version="1.0" encoding="UTF-8")`, depth: 0},
+		{token: "<gpx>", depth: 1},
+		{token: "<metadata>", depth: 2},
+		{token: "<time>", depth: 3},
+		{token: "</time>", depth: 2},
+		{token: "</metadata>", depth: 1},
+		{token: "<trk>", depth: 2},
+		{token: "<name>", depth: 3},
+		{token: "</name>", depth: 2},
+		{token: "<type>", depth: 3},
+		{token: "</type>", depth: 2},
+		{token: "<trkseg>", depth: 3},
+		{token: "<trkpt>", depth: 4},
+		{token: "<ele>", depth: 5},
+	}
+	for i, expected := range expecteds {
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := token.String()
+		if len(token.Name.Full) > 0 && !token.IsEndElement {
+			name = "<" + string(token.Name.Full) + ">"
+		}
+		if name != expected.token || tok.Depth() != expected.depth {
+			t.Fatalf("[%d]: expected %s at depth %d, got: %s at depth %d", i, expected.token, expected.depth, name, tok.Depth())
+		}
+	}
+
+	var maxDepth int
+	for {
+		token, err := tok.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Depth() > maxDepth {
+			maxDepth = tok.Depth()
+		}
+		if string(token.Name.Full) == "trkseg" && token.IsEndElement && tok.Depth() != 2 {
+			t.Fatalf("expected depth after </trkseg>: 2, got: %d", tok.Depth())
+		}
+	}
+	if maxDepth != 5 {
+		t.Fatalf("expected max depth: 5, got: %d", maxDepth)
+	}
+	if depth := tok.Depth(); depth != 0 {
+		t.Fatalf("expected depth after </gpx>: 0, got: %d", depth)
+	}
+
+	tok = xmltokenizer.New(strings.NewReader("<a><b/></a>"), xmltokenizer.WithSyntheticEndElements(true))
+	for _, expected := range []int{1, 1, 1, 0} { // <a>, <b/>, synthetic </b>, </a>
+		if _, err := tok.Token(); err != nil {
+			t.Fatal(err)
+		}
+		if tok.Depth() != expected {
+			t.Fatalf("expected depth: %d, got: %d", expected, tok.Depth())
+		}
+	}
+}
+
+func TestNewFromBytes(t *testing.T) {
+	const bom = "\xEF\xBB\xBF"
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<!DOCTYPE note [<!ENTITY x "y">]>` + "\n" +
+		`<note a="1"><to>Tove</to><![CDATA[<x>]]><empty/></note>`
+
+	tt := []struct {
+		name string
+		xml  string
+	}{
+		{name: "no leading junk", xml: doc},
+		{name: "bom", xml: bom + doc},
+		{name: "whitespace", xml: " \r\n\t" + doc},
+		{name: "bom and whitespace", xml: bom + "\n\n" + doc},
+		{name: "copyright comment", xml: "<!-- Copyright 2024 -->\n" + doc},
+		{name: "bom, copyright comment and whitespace", xml: bom + "<!--\n  Copyright 2024\n-->\n  " + doc},
+		{name: "trailing whitespace", xml: doc + "\n\n"},
+		{name: "trailing text", xml: doc + "text"},
+		{name: "truncated", xml: doc + "<note><!-- c"},
+		{name: "empty", xml: ""},
+		{name: "bom only", xml: bom},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			data := []byte(tc.xml)
+			tok := xmltokenizer.NewFromBytes(data, xmltokenizer.WithKeepRaw(true))
+			stream := xmltokenizer.New(strings.NewReader(tc.xml),
+				xmltokenizer.WithKeepRaw(true),
+				xmltokenizer.WithReadBufferSize(1),
+			)
+
+			var raws [][]byte
+			for i := 0; ; i++ {
+				expected, err := stream.Token()
+				token, err2 := tok.Token()
+				if fmt.Sprint(err2) != fmt.Sprint(err) {
+					t.Fatalf("[%d] expected error: %v, got: %v", i, err, err2)
+				}
+				if err != nil {
+					break
+				}
+				if diff := cmp.Diff(token, expected, ignoreUnexported); diff != "" {
+					t.Fatalf("[%d]: %s", i, diff)
+				}
+				if string(token.Raw()) != string(expected.Raw()) {
+					t.Fatalf("[%d]: expected Raw: %q, got: %q", i, expected.Raw(), token.Raw())
+				}
+				if stream.InputOffset() != tok.InputOffset() {
+					t.Fatalf("[%d]: expected offset: %d, got: %d", i, stream.InputOffset(), tok.InputOffset())
+				}
+				raws = append(raws, token.Raw())
+			}
+
+			if string(data) != tc.xml {
+				t.Fatalf("the data is modified: %q", data)
+			}
+			for _, raw := range raws { // The tokens alias data, they remain valid.
+				if len(raw) > 0 && !strings.Contains(tc.xml, string(raw)) {
+					t.Fatalf("expected %q to remain valid", raw)
+				}
+			}
+
+			tok.Reset(strings.NewReader("<a/>")) // Must not reuse the data as its buffer.
+			if token, err := tok.Token(); err != nil || string(token.Name.Full) != "a" {
+				t.Fatalf("expected <a/> after Reset, got: %s, %v", token, err)
+			}
+			if string(data) != tc.xml {
+				t.Fatalf("the data is modified by Reset: %q", data)
+			}
+		})
+	}
+}
+
+func TestIsCDATA(t *testing.T) {
+	tt := []struct {
+		name      string
+		xml       string
+		opts      []xmltokenizer.Option
+		expecteds []bool // IsCDATA of every token
+	}{
+		{
+			name:      "sole cdata",
+			xml:       "<a><![CDATA[Some text here.]]></a>",
+			expecteds: []bool{true, false},
+		},
+		{
+			name:      "cdata surrounded by whitespace",
+			xml:       "<a>\n  <![CDATA[ text ]]>\n</a>",
+			expecteds: []bool{true, false},
+		},
+		{
+			name:      "cdata surrounded by whitespace merged",
+			xml:       "<a>\n  <![CDATA[ text ]]>\n</a>",
+			opts:      []xmltokenizer.Option{xmltokenizer.WithMergeCharData(true)},
+			expecteds: []bool{true, false},
+		},
+		{
+			name:      "text is not cdata",
+			xml:       "<a>text</a><b/>",
+			expecteds: []bool{false, false, false},
+		},
+		{
+			name:      "text and cdata merged",
+			xml:       "<a><![CDATA[text]]>more</a>",
+			opts:      []xmltokenizer.Option{xmltokenizer.WithMergeCharData(true)},
+			expecteds: []bool{false, false},
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(tc.xml), tc.opts...)
+			var results []bool
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				results = append(results, token.IsCDATA)
+			}
+			if diff := cmp.Diff(results, tc.expecteds); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestCharDataThenCDATA(t *testing.T) {
+	const xml = `<a>x &amp; y<![CDATA[ &amp; z]]>tail</a>`
+
+	tt := []struct {
+		entityDecoding bool
+		expecteds      []string
+	}{
+		{entityDecoding: false, expecteds: []string{"x &amp; y &amp; z", "tail", ""}},
+		{entityDecoding: true, expecteds: []string{"x & y &amp; z", "tail", ""}},
+	}
+
+	for i, tc := range tt {
+		for _, size := range []int{1, 4096} {
+			t.Run(fmt.Sprintf("[%d]: entity decoding %t, read buffer %d", i, tc.entityDecoding, size), func(t *testing.T) {
+				tok := xmltokenizer.New(strings.NewReader(xml),
+					xmltokenizer.WithEntityDecoding(tc.entityDecoding),
+					xmltokenizer.WithReadBufferSize(size),
+				)
+				var datas []string
+				for {
+					token, err := tok.Token()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if token.IsCDATA {
+						t.Fatalf("expected a mixed CharData is not flagged as IsCDATA")
+					}
+					datas = append(datas, string(token.Data))
+				}
+				if diff := cmp.Diff(datas, tc.expecteds); diff != "" {
+					t.Fatal(diff)
+				}
+			})
+		}
+	}
+}
+
+func TestCollectEntities(t *testing.T) {
+	t.Run("dtd.xml footer", func(t *testing.T) {
+		f, err := os.Open(filepath.Join("testdata", "dtd.xml"))
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+
+		tok := xmltokenizer.New(f, xmltokenizer.WithCollectEntities(true))
+		for {
+			token, err := tok.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(token.Name.Local) != "footer" {
+				continue
+			}
+			expected := [][]byte{[]byte("&writer;"), []byte("&nbsp;"), []byte("&copyright;")}
+			if diff := cmp.Diff(token.Entities(), expected); diff != "" {
+				t.Fatal(diff)
+			}
+			break
+		}
+	})
+
+	t.Run("retained by CopyDeepInto", func(t *testing.T) {
+		// A small read buffer overwrites the bytes the previous token's entities alias.
+		tok := xmltokenizer.New(strings.NewReader(`<a>&x; &#169;</a><b>&y;</b>`),
+			xmltokenizer.WithCollectEntities(true),
+			xmltokenizer.WithReadBufferSize(4),
+		)
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var arena []byte
+		var retained xmltokenizer.Token
+		retained.CopyDeepInto(token, &arena)
+		for {
+			if _, err = tok.Token(); err != nil {
+				break
+			}
+		}
+		expected := [][]byte{[]byte("&x;"), []byte("&#169;")}
+		if diff := cmp.Diff(retained.Entities(), expected); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	tt := []struct {
+		name            string
+		xml             string
+		collectEntities bool
+		entityDecoding  bool
+		expected        []string
+	}{
+		{
+			name:            "references in order",
+			xml:             `<a>&#169; 2024 &amp; &#xA9;</a>`,
+			collectEntities: true,
+			expected:        []string{"&#169;", "&amp;", "&#xA9;"},
+		},
+		{
+			name:            "collected regardless of decoding",
+			xml:             `<a>&lt;b&gt;</a>`,
+			collectEntities: true,
+			entityDecoding:  true,
+			expected:        []string{"&lt;", "&gt;"},
+		},
+		{
+			name:            "cdata and malformed references are skipped",
+			xml:             `<a>AT&T &x <![CDATA[&cdata;]]></a>`,
+			collectEntities: true,
+		},
+		{
+			name:            "text token",
+			xml:             `<a><b/>&e;</a>`,
+			collectEntities: true,
+			expected:        []string{"&e;"},
+		},
+		{
+			name: "disabled",
+			xml:  `<a>&e;</a>`,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(tc.xml),
+				xmltokenizer.WithCollectEntities(tc.collectEntities),
+				xmltokenizer.WithEntityDecoding(tc.entityDecoding),
+			)
+			var entities []string
+			for {
+				token, err := tok.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, entity := range token.Entities() {
+					entities = append(entities, string(entity))
+				}
+			}
+			if diff := cmp.Diff(entities, tc.expected); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	const xml = `<a><!-- c -->x &amp; y<b><!-- c -->x &amp; y</b><!-- c -->x &amp; y</a>`
+
+	for _, size := range []int{1, 4096} {
+		t.Run(fmt.Sprintf("read buffer %d", size), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(xml), xmltokenizer.WithReadBufferSize(size))
+			next := func() string {
+				token, err := tok.Token()
+				if err != nil {
+					t.Fatal(err)
+				}
+				return string(token.Data)
+			}
+
+			var datas []string
+			datas = append(datas, next(), next(), next()) // <a>, <!-- c -->, x &amp; y
+			tok.SetOptions(xmltokenizer.WithCommentTrim(true), xmltokenizer.WithEntityDecoding(true))
+			datas = append(datas, next(), next(), next()) // <b>, <!--c-->, x & y
+			tok.SetOptions()
+			datas = append(datas, next(), next(), next()) // </b>, <!-- c -->, x &amp; y
+
+			expected := []string{
+				"", "<!-- c -->", "x &amp; y",
+				"", "<!--c-->", "x & y",
+				"", "<!-- c -->", "x &amp; y",
+			}
+			if diff := cmp.Diff(datas, expected); diff != "" {
+				t.Fatal(diff)
+			}
+			if token, err := tok.Token(); err != nil || string(token.Name.Local) != "a" || !token.IsEndElement {
+				t.Fatalf("expected </a>, got: %q, %v", token.Name.Full, err)
+			}
+		})
+	}
+}
+
+func TestSetOptionsKeepsBuffers(t *testing.T) {
+	xml := "<a>" + strings.Repeat(`<b c="d">e</b>`, 100) + "</a>"
+
+	for _, readAhead := range []bool{false, true} {
+		t.Run(fmt.Sprintf("read ahead %t", readAhead), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(xml),
+				xmltokenizer.WithReadBufferSize(16),
+				xmltokenizer.WithAutoGrowBufferMaxLimitSize(64),
+				xmltokenizer.WithAttrBufferSize(2),
+				xmltokenizer.WithReadAhead(readAhead),
+			)
+			defer tok.Close()
+
+			var n int
+			for ; ; n++ {
+				if n == 10 {
+					// Inconsistent with WithStrictBufferConfig, Reset would return ErrInvalidBufferConfig.
+					tok.SetOptions(
+						xmltokenizer.WithReadBufferSize(128),
+						xmltokenizer.WithAutoGrowBufferMaxLimitSize(32),
+						xmltokenizer.WithAttrBufferSize(8),
+						xmltokenizer.WithStrictBufferConfig(true),
+						xmltokenizer.WithReadAhead(!readAhead),
+					)
+					if size := tok.ReadBufferSize(); size != 16 {
+						t.Fatalf("expected ReadBufferSize: 16, got: %d", size)
+					}
+					if size := tok.AutoGrowBufferMaxLimitSize(); size != 64 {
+						t.Fatalf("expected AutoGrowBufferMaxLimitSize: 64, got: %d", size)
+					}
+					if size := tok.AttrBufferSize(); size != 2 {
+						t.Fatalf("expected AttrBufferSize: 2, got: %d", size)
+					}
+				}
+				if _, err := tok.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n != 202 {
+				t.Fatalf("expected tokens: 202, got: %d", n)
+			}
+		})
+	}
+}
+
+func TestPlainToken(t *testing.T) {
+	// A Tokenizer with no option takes a fast path, it must return the same tokens as the one
+	// with an option that only takes the full path, e.g. a limit that is never reached.
+	format := func(token xmltokenizer.Token) string {
+		return fmt.Sprintf("%q %q %q %q %q %v %v %v", token.Name.Prefix, token.Name.Local, token.Name.Full,
+			token.Attrs, token.Data, token.SelfClosing, token.IsEndElement, token.IsCDATA)
+	}
+	filepath.Walk("testdata", func(path string, info fs.FileInfo, _ error) error {
+		if info.IsDir() {
+			return nil
+		}
+		t.Run(strings.TrimPrefix(path, "testdata/"), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plain := xmltokenizer.New(bytes.NewReader(data))
+			full := xmltokenizer.New(bytes.NewReader(data), xmltokenizer.WithMaxTokens(math.MaxInt))
+			for i := 0; ; i++ {
+				token, err := plain.Token()
+				expected, expectedErr := full.Token()
+				if fmt.Sprint(err) != fmt.Sprint(expectedErr) {
+					t.Fatalf("[%d] expected err: %v, got: %v", i, expectedErr, err)
+				}
+				if err != nil {
+					break
+				}
+				if format(token) != format(expected) { // Faster than cmp.Diff on the large files.
+					t.Fatalf("[%d] %s", i, cmp.Diff(token, expected, ignoreUnexported))
+				}
+				if plain.Depth() != full.Depth() {
+					t.Fatalf("[%d] expected depth: %d, got: %d", i, full.Depth(), plain.Depth())
+				}
+			}
+		})
+		return nil
+	})
+}
+
+type readCounter struct {
+	r     io.Reader
+	reads int
+}
+
+func (r *readCounter) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	if n > 0 {
+		r.reads++
+	}
+	return n, err
+}
+
+func TestProgress(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "ride_sembalun.gpx"))
+	if err != nil {
+		panic(err)
+	}
+
+	r := &readCounter{r: bytes.NewReader(data)}
+	var progress []int64
+	tok := xmltokenizer.New(r,
+		xmltokenizer.WithReadBufferSize(1<<10),
+		xmltokenizer.WithProgress(func(bytesRead int64) { progress = append(progress, bytesRead) }),
+	)
+	var tokens int
+	for {
+		if _, err = tok.Token(); err != nil {
+			break
+		}
+		tokens++
+	}
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+
+	if len(progress) < 2 {
+		t.Fatalf("expected a multi-fill document, got: %d fills", len(progress))
+	}
+	if len(progress) != r.reads || len(progress) >= tokens {
+		t.Fatalf("expected one invocation per read: %d, got: %d (tokens: %d)", r.reads, len(progress), tokens)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] <= progress[i-1] {
+			t.Fatalf("[%d]: expected monotonically increasing, got: %d after %d", i, progress[i], progress[i-1])
+		}
+	}
+	if last := progress[len(progress)-1]; last != int64(len(data)) {
+		t.Fatalf("expected the last progress: %d, got: %d", len(data), last)
+	}
+}
+
+func TestReadAhead(t *testing.T) {
+	// Run with -race flag, the reader is read by the goroutine while the tokens are returned.
+	data, err := os.ReadFile(filepath.Join("testdata", "xlsx_sheet1.xml"))
+	if err != nil {
+		panic(err)
+	}
+
+	tokens := func(tok *xmltokenizer.Tokenizer) ([]string, error) {
+		var result []string
+		for {
+			token, err := tok.Token()
+			if err != nil {
+				return result, err
+			}
+			result = append(result, token.String()+string(token.Data))
+		}
+	}
+
+	tt := []struct {
+		name string
+		r    func(r io.Reader) io.Reader
+		size int
+	}{
+		{name: "default", r: func(r io.Reader) io.Reader { return r }},
+		{name: "small buffer", r: func(r io.Reader) io.Reader { return r }, size: 64},
+		{name: "one byte reader", r: iotest.OneByteReader},
+		{name: "half reader", r: iotest.HalfReader, size: 64},
+		{name: "data err reader", r: iotest.DataErrReader, size: 64},
+		{name: "timeout reader", r: iotest.TimeoutReader, size: 1 << 10},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			expected, expectedErr := tokens(xmltokenizer.New(tc.r(bytes.NewReader(data)),
+				xmltokenizer.WithReadBufferSize(tc.size),
+			))
+			result, err := tokens(xmltokenizer.New(tc.r(bytes.NewReader(data)),
+				xmltokenizer.WithReadBufferSize(tc.size),
+				xmltokenizer.WithReadAhead(true),
+			))
+			if fmt.Sprint(err) != fmt.Sprint(expectedErr) {
+				t.Fatalf("expected error: %v, got: %v", expectedErr, err)
+			}
+			if diff := cmp.Diff(result, expected); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+
+	t.Run("reset before EOF", func(t *testing.T) {
+		r := bytes.NewReader(data)
+		tok := xmltokenizer.New(r, xmltokenizer.WithReadBufferSize(64), xmltokenizer.WithReadAhead(true))
+		for i := 0; i < 10; i++ {
+			if _, err := tok.Token(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tok.Reset(nil) // The goroutine may still be reading r, so r must not be reused.
+		tok.Reset(bytes.NewReader(data), xmltokenizer.WithReadAhead(true))
+		result, err := tokens(tok)
+		if err != io.EOF {
+			t.Fatal(err)
+		}
+		expected, _ := tokens(xmltokenizer.New(bytes.NewReader(data)))
+		if diff := cmp.Diff(result, expected); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("progress", func(t *testing.T) {
+		var last int64
+		tok := xmltokenizer.New(bytes.NewReader(data),
+			xmltokenizer.WithReadBufferSize(64),
+			xmltokenizer.WithReadAhead(true),
+			xmltokenizer.WithProgress(func(bytesRead int64) { last = bytesRead }),
+		)
+		if _, err := tokens(tok); err != io.EOF {
+			t.Fatal(err)
+		}
+		if last != int64(len(data)) {
+			t.Fatalf("expected the last progress: %d, got: %d", len(data), last)
+		}
+	})
+}
+
+func TestUnread(t *testing.T) {
+	const xml = `<a><b x="1">text</b><c/></a>`
+
+	for _, size := range []int{1, 4096} {
+		t.Run(fmt.Sprintf("read buffer %d", size), func(t *testing.T) {
+			tok := xmltokenizer.New(strings.NewReader(xml),
+				xmltokenizer.WithReadBufferSize(size),
+				xmltokenizer.WithSyntheticEndElements(true),
+			)
+			var result []string
+			next := func() {
+				token, err := tok.Token()
+				if err != nil {
+					t.Fatal(err)
+				}
+				result = append(result, token.String()+string(token.Data))
+			}
+
+			next()       // <a>
+			next()       // <b x="1">text
+			tok.Unread() // Only one level, the second is the same as the first.
+			tok.Unread()
+			if depth := tok.Depth(); depth != 2 {
+				t.Fatalf("expected depth after unread: 2, got: %d", depth)
+			}
+			next()       // <b x="1">text again
+			next()       // </b>
+			next()       // <c/>
+			tok.Unread() // The synthetic end element is still pending.
+			next()       // <c/> again
+			next()       // </c>
+			next()       // </a>
+
+			expected := []string{`<a>`, `<b x="1">text`, `<b x="1">text`, `</b>`, `<c/>`, `<c/>`, `</c>`, `</a>`}
+			if diff := cmp.Diff(result, expected); diff != "" {
+				t.Fatal(diff)
+			}
+
+			tok.Unread()
+			next() // </a> again
+			tok.Token()
+			tok.Unread() // After an error, it does nothing.
+			if _, err := tok.Token(); err != io.EOF {
+				t.Fatalf("expected: %v, got: %v", io.EOF, err)
+			}
+		})
+	}
+
+	t.Run("after RawToken", func(t *testing.T) {
+		tok := xmltokenizer.New(strings.NewReader(xml))
+		tok.Token()
+		tok.RawToken()
+		tok.Unread()
+		token, err := tok.Token()
+		if err != nil || !token.IsEndElementOf(&xmltokenizer.Token{Name: xmltokenizer.Name{Full: []byte("b")}}) {
+			t.Fatalf("expected </b>, got: %s, %v", token, err)
+		}
+	})
+}
+
+func TestTokenOnGPXFiles(t *testing.T) {
+	filepath.Walk("testdata", func(path string, info fs.FileInfo, _ error) error {
+		t.Run(path, func(t *testing.T) {
+			if info.IsDir() {
+				return
+			}
+			if strings.ToLower(filepath.Ext(path)) != ".gpx" {
+				return
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Skip(err)
+			}
+
+			gpx1, err := gpx.UnmarshalWithXMLTokenizer(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("xmltokenizer: %v", err)
+			}
+
+			gpx2, err := gpx.UnmarshalWithStdlibXML(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("xml: %v", err)
+			}
+
+			if diff := cmp.Diff(gpx1, gpx2,
+				cmp.Transformer("float64", func(x float64) uint64 {
+					return math.Float64bits(x)
+				}),
+			); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		return nil
+	})
+}
+
+func TestUnmarshalGPXWaypointAllocs(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "ride_dps_bedugul.gpx"))
+	if err != nil {
+		panic(err)
+	}
+	start := bytes.Index(data, []byte("<trkpt "))
+	end := bytes.Index(data[start:], []byte("</trkpt>")) + len("</trkpt>")
+	trkpt := data[start : start+end]
+
+	r := bytes.NewReader(trkpt)
+	tok := xmltokenizer.New(r)
+	se := xmltokenizer.GetToken()
+	defer xmltokenizer.PutToken(se)
+
+	// The names, the attribute values and the Data are only converted to string to be compared
+	// or parsed, e.g. switch string(token.Name.Local) and strconv.ParseFloat(string(token.Data), 64),
+	// so the hot path does not allocate once the buffers are grown.
+	var w gpxschema.Waypoint
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Reset(trkpt)
+		tok.Reset(r)
+		token, err := tok.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.UnmarshalToken(tok, se.Copy(token)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected alloc: 0, got: %g", allocs)
+	}
+	if w.TrackpointExtension.HeartRate == 0 || w.Time.IsZero() {
+		t.Fatalf("expected the heart rate and the time to be unmarshaled, got: %+v", w)
+	}
+}
+
+func TestTokenOnTCXFiles(t *testing.T) {
+	filepath.Walk("testdata", func(path string, info fs.FileInfo, _ error) error {
+		t.Run(path, func(t *testing.T) {
+			if info.IsDir() {
+				return
+			}
+			if strings.ToLower(filepath.Ext(path)) != ".tcx" {
+				return
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Skip(err)
+			}
+
+			tcx1, err := tcx.UnmarshalWithXMLTokenizer(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("xmltokenizer: %v", err)
+			}
+
+			// Reading one byte at a time puts a buffer boundary at every depth.
+			tcx2, err := tcx.UnmarshalWithXMLTokenizer(iotest.OneByteReader(bytes.NewReader(data)))
+			if err != nil {
+				t.Fatalf("xmltokenizer (one byte reader): %v", err)
+			}
+
+			tcx3, err := tcx.UnmarshalWithStdlibXML(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("xml: %v", err)
+			}
+
+			if len(tcx3.Activities) == 0 {
+				t.Fatalf("expected activities, got none")
+			}
+			if diff := cmp.Diff(tcx1, tcx3); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tcx2, tcx3); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		return nil
+	})
+}
+
+func TestConcurrentTokenizers(t *testing.T) {
+	// Run with -race flag to detect any shared mutable state.
+	data, err := os.ReadFile(filepath.Join("testdata", "hike_mt_prau.gpx"))
+	if err != nil {
+		panic(err)
+	}
+
+	expected, err := gpx.UnmarshalWithXMLTokenizer(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := gpx.UnmarshalWithXMLTokenizer(bytes.NewReader(data))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if diff := cmp.Diff(result, expected,
+				cmp.Transformer("float64", func(x float64) uint64 {
+					return math.Float64bits(x)
+				}),
+			); diff != "" {
+				errs[i] = fmt.Errorf("goroutine %d: %s", i, diff)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTokenOnXLSXFiles(t *testing.T) {
+	path := filepath.Join("testdata", "xlsx_sheet1.xml")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	sheet1, err := xlsx.UnmarshalWithXMLTokenizer(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("xmltokenizer: %v", err)
+	}
+	sheet2, err := xlsx.UnmarshalWithStdlibXML(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("xml: %v", err)
+	}
+
+	if diff := cmp.Diff(sheet1, sheet2); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestTokenOnXLSXMultiSheets(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "xlsx_multi_sheets.xml"))
+	if err != nil {
+		t.Skip(err)
+	}
+
+	sheet1, err := xlsx.UnmarshalWithXMLTokenizer(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("xmltokenizer: %v", err)
+	}
+	sheet2, err := xlsx.UnmarshalWithStdlibXML(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("xml: %v", err)
+	}
+
+	// The rows of every sheet are collected, including the ones after an empty <sheetData/>.
+	if len(sheet1.Rows) != 3 {
+		t.Fatalf("expected rows: 3, got: %d", len(sheet1.Rows))
+	}
+	if diff := cmp.Diff(sheet1, sheet2); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestTokenOnPlistFiles(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "info.plist"))
+	if err != nil {
+		t.Skip(err)
+	}
+
+	plist1, err := plist.UnmarshalWithXMLTokenizer(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("xmltokenizer: %v", err)
+	}
+	// Reading one byte at a time puts a buffer boundary within every <key> and value pair.
+	plist2, err := plist.UnmarshalWithXMLTokenizer(iotest.OneByteReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("xmltokenizer (one byte reader): %v", err)
+	}
+	plist3, err := plist.UnmarshalWithStdlibXML(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("xml: %v", err)
+	}
+
+	if len(plist3.Root.Dict) == 0 {
+		t.Fatalf("expected dict entries, got none")
+	}
+	if diff := cmp.Diff(plist1, plist3); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(plist2, plist3); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// Round-trip: encoding/xml writes <true></true> instead of <true/>, and never self-closes an empty <dict>.
+	b, err := xml.Marshal(plist1)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	plist4, err := plist.UnmarshalWithXMLTokenizer(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("xmltokenizer (round-trip): %v", err)
+	}
+	if diff := cmp.Diff(plist4, plist1); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestAutoGrowBufferCorrectness(t *testing.T) {
+	path := filepath.Join("testdata", "xlsx_sheet1.xml")
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	tok := xmltokenizer.New(f,
+		xmltokenizer.WithReadBufferSize(1),
+	)
+
+	var token xmltokenizer.Token
+	var sheetData1 schema.SheetData
+loop:
+	for {
+		token, err = tok.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch string(token.Name.Local) {
+		case "sheetData":
+			se := xmltokenizer.GetToken().Copy(token)
+			err = sheetData1.UnmarshalToken(tok, se)
+			xmltokenizer.PutToken(se)
+			if err != nil {
+				t.Fatal(err)
+			}
+			break loop
+		}
+	}
+
+	f2, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f2.Close()
+
+	sheetData2, err := xlsx.UnmarshalWithStdlibXML(f2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(sheetData1, sheetData2); diff != "" {
+		t.Fatal(err)
+	}
+}
+
+func TestRawTokenWithInmemXML(t *testing.T) {
+	tt := []struct {
+		name      string
+		xml       string
+		expecteds []string
+		err       error
+	}{
+		{
+			name: "simple xml happy flow",
+			xml: `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN"
+	"http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<body xmlns:foo="ns1" xmlns="ns2" xmlns:tag="ns3" ` +
+				"\r\n\t" + `  >
+	<hello lang="en">World &lt;&gt;&apos;&quot; &#x767d;&#40300;翔</hello>
+	<query>&何; &is-it;</query>
+	<goodbye />
+	<outer foo:attr="value" xmlns:tag="ns4">
+	<inner/>
+	</outer>
+	<tag:name>
+	<![CDATA[Some text here.]]>
+	</tag:name>
+</body><!-- missing final newline -->`, // Note: retrieved from stdlib xml test.
+			expecteds: []string{
+				"<?xml version=\"1.0\" encoding=\"UTF-8\"?>",
+				"<!DOCTYPE html PUBLIC \"-//W3C//DTD XHTML 1.0 Transitional//EN\"\n" +
+					"	\"http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd\">",
+				"<body xmlns:foo=\"ns1\" xmlns=\"ns2\" xmlns:tag=\"ns3\" " +
+					"\r\n\t" + "  >",
+				"<hello lang=\"en\">World &lt;&gt;&apos;&quot; &#x767d;&#40300;翔",
+				"</hello>",
+				"<query>&何; &is-it;",
+				"</query>",
+				"<goodbye />",
+				"<outer foo:attr=\"value\" xmlns:tag=\"ns4\">",
+				"<inner/>",
+				"</outer>",
+				"<tag:name>\n	<![CDATA[Some text here.]]>",
+				"</tag:name>",
+				"</body>",
+				"<!-- missing final newline -->",
+			},
+		},
+		{
+			name: "right angle bracket inside attribute value",
+			xml:  `<sample path="foo>bar" alt='<x>'>text</sample>`,
+			expecteds: []string{
+				`<sample path="foo>bar" alt='<x>'>text`,
+				"</sample>",
 			},
 		},
 		{
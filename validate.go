@@ -0,0 +1,232 @@
+package xmltokenizer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	// ErrMismatchedEndElement is returned by Validate when an end element does
+	// not match the last open element, e.g. <a></b>, or there is no open element.
+	ErrMismatchedEndElement = errorString("mismatched end element")
+
+	// ErrDuplicateAttr is returned by Validate when an element has more than
+	// one attribute of the same name, e.g. <a b="1" b="2">.
+	ErrDuplicateAttr = errorString("duplicate attribute")
+
+	// ErrMalformedStartElement is returned by Validate when a start element is not well-formed,
+	// e.g. <1a/>, <a b/>, <a b=x/>, <a b="<"/> or <a b="1"c="2"/>.
+	ErrMalformedStartElement = errorString("malformed start element")
+
+	// ErrNoRootElement is returned by Validate when the document has no root element,
+	// e.g. an empty input or an input of only whitespace or comments.
+	ErrNoRootElement = errorString("no root element")
+)
+
+// Validate reads r to the end and reports whether it is a well-formed XML document,
+// it returns nil if it is, otherwise, it returns the first error. In addition to the
+// validation of WithStrict, it validates that the document has a root element, the end
+// elements match the start elements, no element is left unclosed, no element has duplicate
+// attributes, and every start element is well-formed: its name is a valid XML name and its
+// attributes are in the form of name="value" or name='value', separated by whitespace, and
+// without '<' in the value. No token is materialized for the caller. The opts are applied
+// before the options required by the validation, i.e. WithStrict(true), WithLazyAttrs(false),
+// WithNamesOnly(false), WithSyntheticEndElements(false) and WithKeepRaw(true).
+func Validate(r io.Reader, opts ...Option) error {
+	opts = append(opts[:len(opts):len(opts)],
+		WithStrict(true),
+		WithLazyAttrs(false),
+		WithNamesOnly(false),
+		WithSyntheticEndElements(false),
+		WithKeepRaw(true),
+	)
+	t := New(r, opts...)
+
+	var names []byte // the names of the open elements, so they remain valid after the buffer moves
+	var ends []int   // the end position of every name in names
+	for {
+		token, err := t.Token()
+		if err == io.EOF {
+			if len(ends) > 0 {
+				name := names[endOf(ends, len(ends)-2):]
+				return fmt.Errorf("byte pos %d: unclosed element <%s>: %w", t.n, name, io.ErrUnexpectedEOF)
+			}
+			if !t.root {
+				return fmt.Errorf("byte pos %d: %w", t.n, ErrNoRootElement)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(token.Name.Full) == 0 {
+			continue
+		}
+
+		if token.IsEndElement {
+			if len(ends) == 0 {
+				return SyntaxError{
+					Offset: t.offset,
+					Msg:    fmt.Sprintf("unexpected </%s>", token.Name.Full),
+					Err:    ErrMismatchedEndElement,
+				}
+			}
+			start := endOf(ends, len(ends)-2)
+			if name := names[start:]; !bytes.Equal(name, token.Name.Full) {
+				return SyntaxError{
+					Offset: t.offset,
+					Msg:    fmt.Sprintf("expected </%s>, got </%s>", name, token.Name.Full),
+					Err:    ErrMismatchedEndElement,
+				}
+			}
+			names, ends = names[:start], ends[:len(ends)-1]
+			continue
+		}
+
+		if err = t.checkStartElement(&token); err != nil {
+			return err
+		}
+		if err = t.checkDuplicateAttrs(&token); err != nil {
+			return err
+		}
+		if !token.SelfClosing {
+			names = append(names, token.Name.Full...)
+			ends = append(ends, len(names))
+		}
+	}
+}
+
+// endOf returns ends[i], or zero if i is out of range, e.g. the start of the first name.
+func endOf(ends []int, i int) int {
+	if i < 0 {
+		return 0
+	}
+	return ends[i]
+}
+
+// checkStartElement returns SyntaxError if the start element is not well-formed, see Validate.
+// It scans the token's Raw, since the attributes that are not well-formed are not in the Attrs.
+func (t *Tokenizer) checkStartElement(token *Token) error {
+	raw := token.Raw() // Its capacity ends with the tag, so b's position in raw is derived from cap(b).
+	malformed := func(b []byte, msg string) error {
+		return SyntaxError{Offset: t.offset + int64(len(raw)-cap(b)), Msg: msg, Err: ErrMalformedStartElement}
+	}
+
+	name := token.Name.Full
+	if !bytes.HasPrefix(raw[1:], name) { // e.g. < a>
+		return malformed(raw[1:], fmt.Sprintf("element %q: whitespace before name", name))
+	}
+	if j := invalidNameChar(name); j >= 0 {
+		return malformed(raw[1+j:], fmt.Sprintf("element %q", name))
+	}
+	if len(token.Name.Local) == 0 { // e.g. <a:/>
+		return malformed(raw[1:], fmt.Sprintf("element %q: no local name", name))
+	}
+
+	b := raw[1+len(name) : len(raw)-1] // The attributes, without the '>'.
+	if token.SelfClosing {
+		b = b[:len(b)-1]
+	}
+	for {
+		rest := t.ws.trimPrefix(b)
+		if len(rest) == 0 {
+			return nil
+		}
+		if len(rest) == len(b) { // e.g. b="1"c="2"
+			return malformed(b, "no whitespace before attr")
+		}
+		b = rest
+
+		i := 0
+		for i < len(b) && b[i] != '=' && !t.ws.is(b[i]) {
+			i++
+		}
+		name := b[:i]
+		if b = t.ws.trimPrefix(b[i:]); len(b) == 0 || b[0] != '=' { // e.g. <a b/>
+			return malformed(name, fmt.Sprintf("attr %q: no value", name))
+		}
+		if b = t.ws.trimPrefix(b[1:]); len(b) == 0 || (b[0] != '"' && b[0] != '\'') { // e.g. <a b=x/>
+			return malformed(name, fmt.Sprintf("attr %q: unquoted value", name))
+		}
+		end := bytes.IndexByte(b[1:], b[0])
+		if end < 0 {
+			return malformed(name, fmt.Sprintf("attr %q: unclosed value", name))
+		}
+		if j := bytes.IndexByte(b[1:end+1], '<'); j >= 0 {
+			return malformed(b[1+j:], fmt.Sprintf("attr %q: '<' in value", name))
+		}
+		b = b[end+2:]
+	}
+}
+
+// checkDuplicateAttrs returns SyntaxError if the token has more than one attribute of the same name.
+// The few attributes are compared pairwise, the many are checked using a set of their names.
+func (t *Tokenizer) checkDuplicateAttrs(token *Token) error {
+	nsDecls := token.NamespaceDecls()
+	n := len(token.Attrs) + len(nsDecls)
+	if n < minIndexedAttrs {
+		for i := 1; i < n; i++ {
+			a := attrAt(token.Attrs, nsDecls, i)
+			for j := 0; j < i; j++ {
+				if bytes.Equal(a.Name.Full, attrAt(token.Attrs, nsDecls, j).Name.Full) {
+					return t.duplicateAttr(a)
+				}
+			}
+		}
+		return nil
+	}
+	t.attrNames.reset()
+	for i := 0; i < n; i++ {
+		if a := attrAt(token.Attrs, nsDecls, i); !t.attrNames.add(a.Name.Full) {
+			return t.duplicateAttr(a)
+		}
+	}
+	return nil
+}
+
+// duplicateAttr returns SyntaxError of the duplicate attribute a, see checkDuplicateAttrs.
+func (t *Tokenizer) duplicateAttr(a *Attr) error {
+	return SyntaxError{
+		Offset: t.offsetOf(a.Name.Full),
+		Msg:    fmt.Sprintf("attr %s", a.Name.Full),
+		Err:    ErrDuplicateAttr,
+	}
+}
+
+// attrSet is a set of attribute names, see checkDuplicateAttrs. It is owned by the Tokenizer and
+// reused between tokens: the names are kept, a name is only in the set if it is marked with the
+// current generation, so neither emptying the set nor adding a name seen before allocates.
+type attrSet struct {
+	gen   int
+	names map[string]*int // name -> the generation that marked it
+}
+
+// reset empties the set.
+func (s *attrSet) reset() {
+	if s.names == nil || len(s.names) > maxInternedNames {
+		s.names = make(map[string]*int)
+	}
+	s.gen++
+}
+
+// add adds name to the set, it reports false if name is already in the set.
+func (s *attrSet) add(name []byte) bool {
+	gen, ok := s.names[string(name)]
+	if !ok {
+		gen = new(int)
+		s.names[string(name)] = gen
+	} else if *gen == s.gen {
+		return false
+	}
+	*gen = s.gen
+	return true
+}
+
+// attrAt returns the i-th attribute of the attrs followed by the nsDecls.
+func attrAt(attrs, nsDecls []Attr, i int) *Attr {
+	if i < len(attrs) {
+		return &attrs[i]
+	}
+	return &nsDecls[i-len(attrs)]
+}
@@ -0,0 +1,107 @@
+package xmltokenizer_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/muktihari/xmltokenizer"
+)
+
+func TestValidateFiles(t *testing.T) {
+	tt := []struct {
+		filename string
+		err      error
+	}{
+		{filename: "cdata.xml"},
+		{filename: "cdata_after_text.xml"},
+		{filename: "cdata_clrf.xml"},
+		{filename: "comment_in_content.xml"},
+		{filename: "dtd.xml"},
+		{filename: "dtd_attlist.xml"},
+		{filename: "empty_elements.xml"},
+		{filename: "hike_mt_prau.gpx"},
+		{filename: "info.plist"},
+		{filename: "preserve_whitespace.xml"},
+		{filename: "prolog.xml"},
+		{filename: "ride_bedugul_laps.tcx"},
+		{filename: "xlsx_sheet1.xml"},
+		{filename: "xml_ids.xml"},
+		{filename: filepath.Join("corrupted", "cdata_truncated.xml"), err: io.ErrUnexpectedEOF},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.filename, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tc.filename))
+			if err != nil {
+				panic(err)
+			}
+			defer f.Close()
+
+			if err = xmltokenizer.Validate(f); !errors.Is(err, tc.err) {
+				t.Fatalf("expected: %v, got: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tt := []struct {
+		name   string
+		xml    string
+		offset int64
+		err    error
+	}{
+		{name: "well-formed", xml: `<a b="1"><c/>text</a>`},
+		{name: "mismatched end element", xml: `<a><b></a></b>`, offset: 6, err: xmltokenizer.ErrMismatchedEndElement},
+		{name: "end element without start", xml: `</a>`, offset: 0, err: xmltokenizer.ErrMismatchedEndElement},
+		{name: "duplicate attr", xml: `<a><b x="1" y="2" x="3"/></a>`, offset: 18, err: xmltokenizer.ErrDuplicateAttr},
+		{name: "unclosed element", xml: `<a><b></b>`, err: io.ErrUnexpectedEOF},
+		{name: "content after root", xml: `<a/><b/>`, offset: 4, err: xmltokenizer.ErrContentAfterRoot},
+		{name: "bare ampersand", xml: `<a>AT&T</a>`, offset: 5, err: xmltokenizer.ErrBareAmpersand},
+		{name: "single quotes", xml: `<a b='1' c="2"><d e='it"s' f = "it's"/></a>`},
+		{name: "empty", xml: ``, err: xmltokenizer.ErrNoRootElement},
+		{name: "only whitespace", xml: "   \n", err: xmltokenizer.ErrNoRootElement},
+		{name: "only comment", xml: `<!-- only comment -->`, err: xmltokenizer.ErrNoRootElement},
+		{name: "unquoted value", xml: `<a b=x/>`, offset: 3, err: xmltokenizer.ErrMalformedStartElement},
+		{name: "no value", xml: `<a><c b/></a>`, offset: 6, err: xmltokenizer.ErrMalformedStartElement},
+		{name: "invalid element name", xml: `<1a/>`, offset: 1, err: xmltokenizer.ErrMalformedStartElement},
+		{name: "no local name", xml: `<a:/>`, offset: 1, err: xmltokenizer.ErrMalformedStartElement},
+		{name: "'<' in value", xml: `<a b="x<y"/>`, offset: 7, err: xmltokenizer.ErrMalformedStartElement},
+		{name: "no whitespace between attrs", xml: `<a b="1"c="2"/>`, offset: 8, err: xmltokenizer.ErrMalformedStartElement},
+		{name: "many attrs", xml: "<r><a " + manyAttrs(20) + "/><a " + manyAttrs(20) + "/></r>"},
+		{
+			name:   "duplicate attr of many",
+			xml:    "<a " + manyAttrs(20) + ` a3="x"/>`,
+			offset: int64(len("<a " + manyAttrs(20) + " ")),
+			err:    xmltokenizer.ErrDuplicateAttr,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("[%d]: %s", i, tc.name), func(t *testing.T) {
+			err := xmltokenizer.Validate(strings.NewReader(tc.xml), xmltokenizer.WithReadBufferSize(1))
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+
+			var syntaxErr xmltokenizer.SyntaxError
+			if errors.As(err, &syntaxErr) && syntaxErr.Offset != tc.offset {
+				t.Fatalf("expected offset: %d, got: %d", tc.offset, syntaxErr.Offset)
+			}
+		})
+	}
+}
+
+// manyAttrs returns n attributes of distinct names, e.g. a0="0" a1="1".
+func manyAttrs(n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, ` a%d="%d"`, i, i)
+	}
+	return sb.String()
+}